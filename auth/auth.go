@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/mikestefanello/otcscanner/config"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HashPassword returns the bcrypt hash of a password, to be stored in place of the password
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword determines if a password matches a hash returned by HashPassword
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// APITokenPrefix starts every API token, so they can be recognized, for example by secret scanners
+const APITokenPrefix = "otc_"
+
+// NewToken generates a random token, such as a session token
+func NewToken() (string, error) {
+	return randomHex(32)
+}
+
+// NewAPIToken generates a random API token
+func NewAPIToken() (string, error) {
+	token, err := NewToken()
+	if err != nil {
+		return "", err
+	}
+	return APITokenPrefix + token, nil
+}
+
+// NewID generates a random ID which is not secret, such as the ID of an API token
+func NewID() (string, error) {
+	return randomHex(8)
+}
+
+// HashToken returns the SHA-256 hash of a token. Tokens are random and long, so unlike passwords they
+// do not need a slow hash, and only their hashes are stored so a copy of the database cannot be used
+// to log in
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Sign returns a signature of a value, keyed by a secret, so values stored by clients such as cookies
+// cannot be forged or tampered with
+func Sign(secret, value string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify determines if a signature returned by Sign matches a value
+func Verify(secret, value, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, value)), []byte(signature))
+}
+
+// SeedAdmin creates an admin user with the configured credentials if there are no users, so an
+// existing installation which used a single basic auth user keeps working. It reports if a user was
+// created
+func SeedAdmin(users repository.UserRepository, cfg config.HTTPAuthConfig) (bool, error) {
+	if cfg.User == "" || cfg.Password == "" {
+		return false, nil
+	}
+
+	count, err := users.Count()
+	if err != nil || count > 0 {
+		return false, err
+	}
+
+	hash, err := HashPassword(cfg.Password)
+	if err != nil {
+		return false, err
+	}
+
+	err = users.Save(&models.User{
+		Username:     cfg.User,
+		PasswordHash: hash,
+		Role:         models.RoleAdmin,
+		Active:       true,
+		Created:      time.Now(),
+	})
+
+	return err == nil, err
+}
+
+// CheckCredentials returns the active user with a given username and password, or ErrNotFound if
+// there is no such user or the password does not match
+func CheckCredentials(users repository.UserRepository, username, password string) (*models.User, error) {
+	user, err := users.LoadByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.Active || !CheckPassword(user.PasswordHash, password) {
+		return nil, repository.ErrNotFound
+	}
+
+	return user, nil
+}
+
+// ApprovalRequired determines if destructive operations require supervisor approval, which they do
+// when a supervisor is configured
+func ApprovalRequired(cfg config.SupervisorConfig) bool {
+	return cfg.User != "" && cfg.Password != ""
+}
+
+// VerifySupervisor checks the credentials of someone approving a change made by a given actor against
+// those of the configured supervisor and of the users with the supervisor role or a more privileged
+// one. Actors cannot approve their own changes. An error is only returned if the users could not be
+// loaded
+func VerifySupervisor(cfg config.SupervisorConfig, users repository.UserRepository, actor, user, password string) (bool, error) {
+	if actor != "" && user == actor {
+		return false, nil
+	}
+
+	userMatch := subtle.ConstantTimeCompare([]byte(user), []byte(cfg.User))
+	passwordMatch := subtle.ConstantTimeCompare([]byte(password), []byte(cfg.Password))
+	if ApprovalRequired(cfg) && userMatch == 1 && passwordMatch == 1 {
+		return true, nil
+	}
+
+	u, err := CheckCredentials(users, user, password)
+	if err == repository.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return u.HasRole(models.RoleSupervisor), nil
+}
+
+// randomHex returns a given number of random bytes, hex encoded
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mikestefanello/otcscanner/auth"
+	"github.com/mikestefanello/otcscanner/config"
+	"github.com/mikestefanello/otcscanner/export"
+	"github.com/mikestefanello/otcscanner/importer"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/purge"
+	"github.com/mikestefanello/otcscanner/repository"
+	"github.com/mikestefanello/otcscanner/webhook"
+)
+
+// commandActor is the actor recorded for changes made from the command line
+const commandActor = "command-line"
+
+// exportFilters maps the filters of the export command to order statuses
+var exportFilters = map[string]string{
+	"all":        models.OrderStatusAll,
+	"completed":  models.OrderStatusCompleted,
+	"incomplete": models.OrderStatusIncomplete,
+}
+
+// importOrders imports the orders in a file, as an upload from the database page does
+func importOrders(cfg config.Config, fs *flag.FlagSet, args []string) error {
+	format := fs.String("format", "", "format of the file: csv, xlsx or jsonl (default from the file extension)")
+	sheet := fs.String("sheet", "", "worksheet to import from workbooks (default the first sheet)")
+	profileName := fs.String("profile", "", "import profile which maps the file's columns (default detected from the header row)")
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return usageError(fs, "A file to import is required.")
+	}
+	path := fs.Arg(0)
+
+	opts := importer.Options{
+		Format: *format,
+		Sheet:  *sheet,
+	}
+	if opts.Format == "" {
+		opts.Format = importer.FormatFromFilename(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	repos, err := repository.NewMongoRepositories(cfg.Mongo)
+	if err != nil {
+		return fmt.Errorf("Unable to connect to repository: %s", err.Error())
+	}
+	defer repos.Orders.Close()
+
+	if *profileName != "" {
+		opts.Profile, err = repos.ImportProfiles.LoadByName(*profileName)
+		if err == repository.ErrNotFound {
+			return fmt.Errorf("Import profile not found: %s", *profileName)
+		}
+	} else {
+		opts.Profiles, err = repos.ImportProfiles.LoadAll()
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to load import profiles: %s", err.Error())
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	err = ensureIndexes(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	result, err := importer.New(repos.Orders, validator.New()).Import(ctx, file, opts)
+	if err != nil {
+		for _, msg := range importer.ErrorMessages(err, 0) {
+			fmt.Fprintln(os.Stderr, msg)
+		}
+		if result.Added > 0 {
+			fmt.Fprintf(os.Stderr, "%d orders were added before the import failed. Import the file again to add the rest.\n", result.Added)
+		}
+		return fmt.Errorf("Unable to import %s", path)
+	}
+
+	log.Info().Str("file", path).Int("count", result.Added).Str("profile", result.Profile).Msg("Imported orders from the command line.")
+
+	hooks := webhook.New(cfg.Webhook, repos.Webhooks, repos.Deliveries)
+	hooks.Trigger(models.WebhookEventOrdersImported, webhook.ImportEvent{
+		Source:   webhook.ImportSourceCommand,
+		Filename: path,
+		Count:    result.Added,
+		Profile:  result.Profile,
+		Actor:    commandActor,
+	})
+	hooks.DeliverQueued()
+	hooks.Stop()
+
+	fmt.Printf("Added %d orders.\n", result.Added)
+	if result.Skipped > 0 {
+		fmt.Printf("Skipped %d orders which already exist.\n", result.Skipped)
+	}
+	if result.Profile != "" {
+		fmt.Printf("Columns were mapped using the import profile \"%s\".\n", result.Profile)
+	}
+	if len(result.Unmatched) > 0 {
+		fmt.Printf("These columns were not imported: %s\n", strings.Join(result.Unmatched, ", "))
+	}
+
+	return nil
+}
+
+// exportOrders writes orders to a file or standard output, as a download from the database page does
+func exportOrders(cfg config.Config, fs *flag.FlagSet, args []string) error {
+	filter := fs.String("filter", "completed", "orders to export: all, completed or incomplete")
+	format := fs.String("format", export.DefaultFormat, fmt.Sprintf("format of the file: %s", strings.Join(export.FormatNames(), ", ")))
+	profileName := fs.String("profile", "", "export profile which chooses the columns (default every column)")
+	output := fs.String("output", "-", "file to write, or - for standard output")
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	status, ok := exportFilters[*filter]
+	if !ok {
+		return usageError(fs, "Unsupported filter: %s", *filter)
+	}
+
+	f, ok := export.GetFormat(*format)
+	if !ok {
+		return usageError(fs, "Unsupported export format: %s", *format)
+	}
+
+	repos, err := repository.NewMongoRepositories(cfg.Mongo)
+	if err != nil {
+		return fmt.Errorf("Unable to connect to repository: %s", err.Error())
+	}
+	defer repos.Orders.Close()
+
+	columns := export.DefaultColumns()
+	if *profileName != "" {
+		profile, err := repos.ExportProfiles.LoadByName(*profileName)
+		if err != nil {
+			if err == repository.ErrNotFound {
+				return fmt.Errorf("Export profile not found: %s", *profileName)
+			}
+			return fmt.Errorf("Unable to load export profile: %s", err.Error())
+		}
+		columns = profile.Columns
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	it, err := repos.Orders.IterateByQuery(ctx, models.OrderQuery{Status: status})
+	if err != nil {
+		return fmt.Errorf("Unable to load orders: %s", err.Error())
+	}
+	defer it.Close()
+
+	count, err := export.WriteAll(f.NewWriter(w, columns), it)
+	if err != nil {
+		if *output != "-" {
+			os.Remove(*output)
+		}
+		return fmt.Errorf("Unable to write orders: %s", err.Error())
+	}
+
+	log.Info().Str("filter", *filter).Str("format", f.Name).Str("output", *output).Int("count", count).Msg("Exported orders from the command line.")
+
+	return nil
+}
+
+// purgeOrders deletes completed or all orders, as the delete forms on the database page do. A reason
+// is required so it can be sent to webhook subscribers. If a supervisor is configured, the purge must be
+// approved by a supervisor, whose password is read from standard input
+func purgeOrders(cfg config.Config, fs *flag.FlagSet, args []string) error {
+	completed := fs.Bool("completed", false, "delete completed orders")
+	all := fs.Bool("all", false, "delete every order")
+	reason := fs.String("reason", "", "why the orders are being deleted")
+	approver := fs.String("approver", "", "supervisor approving the purge, if approval is required")
+	dryRun := fs.Bool("dry-run", false, "show how many orders would be deleted without deleting them")
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *completed == *all {
+		return usageError(fs, "Exactly one of --completed or --all is required.")
+	}
+
+	if strings.TrimSpace(*reason) == "" && !*dryRun {
+		return usageError(fs, "A reason is required to delete orders.")
+	}
+
+	if auth.ApprovalRequired(cfg.Supervisor) && *approver == "" && !*dryRun {
+		return usageError(fs, "Supervisor approval is required, so --approver is required.")
+	}
+
+	operation := purge.OperationCompleted
+	if *all {
+		operation = purge.OperationAll
+	}
+
+	repos, err := repository.NewMongoRepositories(cfg.Mongo)
+	if err != nil {
+		return fmt.Errorf("Unable to connect to repository: %s", err.Error())
+	}
+	defer repos.Orders.Close()
+
+	hooks := webhook.New(cfg.Webhook, repos.Webhooks, repos.Deliveries)
+	purger := purge.New(cfg.Supervisor, repos.Orders, repos.Users, hooks)
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	if *dryRun {
+		count, err := purger.Count(ctx, operation)
+		if err != nil {
+			return fmt.Errorf("Unable to count orders to delete: %s", err.Error())
+		}
+		fmt.Printf("%d orders would be deleted.\n", count)
+		return nil
+	}
+
+	password := ""
+	if *approver != "" {
+		password, err = readPassword(fmt.Sprintf("Password for %s: ", *approver))
+		if err != nil {
+			return fmt.Errorf("Unable to read password: %s", err.Error())
+		}
+	}
+
+	deleted, err := purger.Purge(ctx, purge.Request{
+		Operation:        operation,
+		Reason:           *reason,
+		Actor:            commandActor,
+		Approver:         *approver,
+		ApproverPassword: password,
+		Log:              &log.Logger,
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to delete orders: %s", err.Error())
+	}
+
+	hooks.DeliverQueued()
+	hooks.Stop()
+
+	fmt.Printf("Deleted %d orders.\n", deleted)
+
+	return nil
+}
+
+// readPassword prompts for a password on standard error and reads it from standard input. Passwords
+// typed at a terminal are not echoed, and piped passwords are read up to the end of the first line
+func readPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(password), err
+	}
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(password, "\r\n"), nil
+}
+
+// showStats writes the order counts shown on the database page to standard output
+func showStats(cfg config.Config, fs *flag.FlagSet, args []string) error {
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	repos, err := repository.NewMongoRepositories(cfg.Mongo)
+	if err != nil {
+		return fmt.Errorf("Unable to connect to repository: %s", err.Error())
+	}
+	defer repos.Orders.Close()
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	all, err := repos.Orders.CountAll(ctx)
+	if err != nil {
+		return fmt.Errorf("Unable to count orders: %s", err.Error())
+	}
+
+	completed, err := repos.Orders.CountCompleted(ctx)
+	if err != nil {
+		return fmt.Errorf("Unable to count completed orders: %s", err.Error())
+	}
+
+	manifests, err := repos.Orders.LoadManifests(ctx)
+	if err != nil {
+		return fmt.Errorf("Unable to load manifests: %s", err.Error())
+	}
+
+	fmt.Printf("Orders:     %d\n", all)
+	fmt.Printf("Completed:  %d\n", completed)
+	fmt.Printf("Incomplete: %d\n", all-completed)
+	fmt.Printf("Manifests:  %d\n", len(manifests))
+	if len(manifests) > 0 {
+		fmt.Printf("Latest:     %s\n", manifests[0])
+	}
+
+	return nil
+}
+
+// migrate creates the database indexes, which is safe to repeat and to run while the application is
+// serving requests
+func migrate(cfg config.Config, fs *flag.FlagSet, args []string) error {
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	indexes, err := repository.MigrateMongo(ctx, cfg.Mongo)
+	for collection, names := range indexes {
+		log.Info().Str("collection", collection).Strs("indexes", names).Msg("Created indexes.")
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to create indexes: %s", err.Error())
+	}
+
+	fmt.Println("The database is up to date.")
+
+	return nil
+}
+
+// ensureIndexes creates the database indexes before orders can be imported, since imports rely on the
+// unique package ID index to skip orders that already exist
+func ensureIndexes(ctx context.Context, cfg config.Config) error {
+	_, err := repository.MigrateMongo(ctx, cfg.Mongo)
+	if err != nil {
+		return fmt.Errorf("Unable to create indexes. Orders which share a package ID must be removed first: %s", err.Error())
+	}
+	return nil
+}
+
+// configCommand writes the effective configuration as YAML, which can be used as a config file once
+// the redacted secrets are replaced
+func configCommand(cfg config.Config, fs *flag.FlagSet, args []string) error {
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 || fs.Arg(0) != "print" {
+		return usageError(fs, "The only config command is print.")
+	}
+
+	fmt.Println("# Effective configuration, with secrets redacted")
+
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	err = enc.Encode(cfg.Redacted())
+	if err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
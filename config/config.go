@@ -1,46 +1,202 @@
 package config
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
-	"github.com/joeshaw/envdecode"
+	"gopkg.in/yaml.v3"
 )
 
 // Config stores all configuration
 type Config struct {
-	HTTP  HTTPConfig
-	Mongo MongoConfig
-	App   AppConfig
+	HTTP        HTTPConfig            `yaml:"http"`
+	Mongo       MongoConfig           `yaml:"mongo"`
+	App         AppConfig             `yaml:"app"`
+	Supervisor  SupervisorConfig      `yaml:"supervisor"`
+	Manifest    ManifestConfig        `yaml:"manifest"`
+	ImportWatch ImportWatchConfig     `yaml:"importWatch"`
+	Export      ScheduledExportConfig `yaml:"export"`
+	Webhook     WebhookConfig         `yaml:"webhook"`
+	Log         LogConfig             `yaml:"log"`
+	// Stations can only be provided by the config file, as they cannot be set by environment variables
+	Stations []StationConfig `yaml:"stations" validate:"unique=Name,dive"`
 }
 
 // HTTPConfig stores HTTP configuration
 type HTTPConfig struct {
-	Hostname string `env:"HTTP_HOSTNAME"`
-	Port     uint16 `env:"HTTP_PORT,default=5000"`
-	Auth     HTTPAuthConfig
+	Hostname string         `env:"HTTP_HOSTNAME" yaml:"hostname"`
+	Port     uint16         `env:"HTTP_PORT,default=5000" yaml:"port" validate:"min=1"`
+	Auth     HTTPAuthConfig `yaml:"auth"`
+	// ReadTimeout limits how long reading a request, including uploaded files, may take
+	ReadTimeout time.Duration `env:"HTTP_READ_TIMEOUT,default=5m" yaml:"readTimeout" validate:"gt=0"`
+	// WriteTimeout limits how long writing a response may take, which must allow for the longest
+	// download, so it is longer than the Mongo export timeout
+	WriteTimeout time.Duration `env:"HTTP_WRITE_TIMEOUT,default=15m" yaml:"writeTimeout" validate:"gt=0"`
+	// IdleTimeout limits how long an idle keep-alive connection is kept open
+	IdleTimeout time.Duration `env:"HTTP_IDLE_TIMEOUT,default=2m" yaml:"idleTimeout" validate:"gt=0"`
+	// ShutdownTimeout limits how long in-flight requests are waited for when the application stops
+	ShutdownTimeout time.Duration `env:"HTTP_SHUTDOWN_TIMEOUT,default=30s" yaml:"shutdownTimeout" validate:"gt=0"`
+	// SecureCookies marks cookies as only being sent over HTTPS, which should be enabled when the
+	// application is served over HTTPS, such as behind a proxy. Cookies are always marked as secure for
+	// requests made over HTTPS directly
+	SecureCookies bool `env:"HTTP_SECURE_COOKIES,default=false" yaml:"secureCookies"`
 }
 
 // HTTPAuthConfig stores HTTP authentication configuration
+// The user and password are used to create an admin user when there are no users. If there are no
+// users and these are not provided, anyone can use the application without logging in
 type HTTPAuthConfig struct {
-	User     string `env:"HTTP_AUTH_USER"`
-	Password string `env:"HTTP_AUTH_PASSWORD"`
+	User       string        `env:"HTTP_AUTH_USER" yaml:"user" validate:"required_with=Password"`
+	Password   string        `env:"HTTP_AUTH_PASSWORD" yaml:"password" validate:"required_with=User" secret:"true"`
+	SessionTTL time.Duration `env:"HTTP_SESSION_TTL,default=12h" yaml:"sessionTTL" validate:"gt=0"`
 }
 
 // MongoConfig stores Mongo DB configuration
 type MongoConfig struct {
-	URL     string        `env:"MONGO_URL,default=mongodb://localhost:27017"`
-	DB      string        `env:"MONGO_DB,default=scanner"`
-	Timeout time.Duration `env:"MONGO_TIMEOUT,default=5s"`
+	URL string `env:"MONGO_URL,default=mongodb://localhost:27017" yaml:"url" validate:"required"`
+	DB  string `env:"MONGO_DB,default=scanner" yaml:"db" validate:"required"`
+	// Timeout limits connecting to the database and operations on everything except orders
+	Timeout time.Duration `env:"MONGO_TIMEOUT,default=5s" yaml:"timeout" validate:"gt=0"`
+	// LookupTimeout limits order operations that read, count or write a single page of orders or a
+	// single order, such as scans and searches
+	LookupTimeout time.Duration `env:"MONGO_LOOKUP_TIMEOUT,default=5s" yaml:"lookupTimeout" validate:"gt=0"`
+	// BulkWriteTimeout limits order operations that write many orders, such as imports, deletes and
+	// closing manifests
+	BulkWriteTimeout time.Duration `env:"MONGO_BULK_WRITE_TIMEOUT,default=2m" yaml:"bulkWriteTimeout" validate:"gt=0"`
+	// ExportTimeout limits order operations that read every matching order, such as downloads and exports
+	ExportTimeout time.Duration `env:"MONGO_EXPORT_TIMEOUT,default=10m" yaml:"exportTimeout" validate:"gt=0"`
 }
 
 // AppConfig stores application configuration
 type AppConfig struct {
-	Name string `env:"APP_NAME,default=OTC Scanner"`
+	Name string `env:"APP_NAME,default=OTC Scanner" yaml:"name" validate:"required"`
+	// Secret signs cookies and CSRF tokens. A random secret is used if this is not provided, which
+	// means previous scans and forms that were loaded before a restart are no longer accepted
+	Secret string `env:"APP_SECRET" yaml:"secret" secret:"true"`
+	// DevDir is a source checkout which templates and static files are read from on every request, so
+	// changes show without rebuilding. The files embedded in the binary are used if this is not provided
+	DevDir string `env:"APP_DEV_DIR" yaml:"devDir" validate:"omitempty,dir"`
 }
 
-// GetConfig loads and returns configuration
-func GetConfig() (Config, error) {
-	var cfg Config
-	err := envdecode.StrictDecode(&cfg)
-	return cfg, err
+// LogConfig stores logging configuration
+type LogConfig struct {
+	// Level is the minimum level of logged lines: trace, debug, info, warn, error, fatal or panic
+	Level string `env:"LOG_LEVEL,default=info" yaml:"level" validate:"oneof=trace debug info warn error fatal panic"`
+	// Format is either json, for log collectors, or console, for people reading the output directly
+	Format string `env:"LOG_FORMAT,default=json" yaml:"format" validate:"oneof=json console"`
+}
+
+// SupervisorConfig stores the credentials of the supervisor who must approve destructive operations
+// Approval is not required if these are not provided
+type SupervisorConfig struct {
+	User     string `env:"SUPERVISOR_USER" yaml:"user" validate:"required_with=Password"`
+	Password string `env:"SUPERVISOR_PASSWORD" yaml:"password" validate:"required_with=User" secret:"true"`
+}
+
+// ManifestConfig stores carrier manifest configuration
+type ManifestConfig struct {
+	Formats  ServiceFormats `env:"MANIFEST_FORMATS,default=IPA:edi;Orange:fixed;RRD:fixed" yaml:"formats"`
+	SenderID string         `env:"MANIFEST_SENDER_ID,default=OTCSCANNER" yaml:"senderId"`
+}
+
+// ImportWatchConfig stores configuration for automatically importing files dropped in to a directory
+// Files are not imported automatically if no directory is provided
+type ImportWatchConfig struct {
+	Dir      string        `env:"IMPORT_WATCH_DIR" yaml:"dir"`
+	Interval time.Duration `env:"IMPORT_WATCH_INTERVAL,default=1m" yaml:"interval" validate:"gt=0"`
+	// Settle is how long a file must go unmodified before it is imported, so files that are still
+	// being written are skipped
+	Settle time.Duration `env:"IMPORT_WATCH_SETTLE,default=30s" yaml:"settle" validate:"gte=0"`
+}
+
+// ScheduledExportConfig stores configuration for exporting completed orders on a schedule
+// Orders are not exported on a schedule if no schedule is provided
+type ScheduledExportConfig struct {
+	// Schedule is a cron expression, such as "0 17 * * *" to export at 5pm every day
+	Schedule string `env:"EXPORT_SCHEDULE" yaml:"schedule"`
+	// Destination is a local directory or an SFTP URL, such as sftp://user@host:22/path
+	Destination string `env:"EXPORT_DESTINATION,default=exports" yaml:"destination" validate:"required"`
+	Format      string `env:"EXPORT_FORMAT,default=csv" yaml:"format" validate:"oneof=csv jsonl ndjson xlsx"`
+	// Profile is the name of the export profile that determines the exported columns; all columns are
+	// exported if not provided
+	Profile string `env:"EXPORT_PROFILE" yaml:"profile"`
+	// MarkExported marks exported orders so they are not exported again
+	MarkExported bool       `env:"EXPORT_MARK_EXPORTED,default=true" yaml:"markExported"`
+	SFTP         SFTPConfig `yaml:"sftp"`
+}
+
+// SFTPConfig stores the credentials used to export orders to an SFTP server
+// The password or private key is used to authenticate, and the server's host key is checked against
+// the known hosts file unless checking is explicitly disabled
+type SFTPConfig struct {
+	Password        string        `env:"EXPORT_SFTP_PASSWORD" yaml:"password" secret:"true"`
+	KeyFile         string        `env:"EXPORT_SFTP_KEY_FILE" yaml:"keyFile"`
+	KnownHostsFile  string        `env:"EXPORT_SFTP_KNOWN_HOSTS" yaml:"knownHostsFile"`
+	InsecureHostKey bool          `env:"EXPORT_SFTP_INSECURE_HOST_KEY,default=false" yaml:"insecureHostKey"`
+	Timeout         time.Duration `env:"EXPORT_SFTP_TIMEOUT,default=30s" yaml:"timeout" validate:"gt=0"`
+}
+
+// WebhookConfig stores configuration for delivering webhook events
+type WebhookConfig struct {
+	Workers     int           `env:"WEBHOOK_WORKERS,default=2" yaml:"workers" validate:"min=1"`
+	Timeout     time.Duration `env:"WEBHOOK_TIMEOUT,default=10s" yaml:"timeout" validate:"gt=0"`
+	MaxAttempts int           `env:"WEBHOOK_MAX_ATTEMPTS,default=5" yaml:"maxAttempts" validate:"min=1"`
+	// Backoff is the delay before the first retry of a failed delivery, which doubles for each later retry
+	Backoff time.Duration `env:"WEBHOOK_BACKOFF,default=30s" yaml:"backoff" validate:"gt=0"`
+	// PollInterval is how often pending deliveries are loaded from the database and queued, so those
+	// that could not be queued are still delivered
+	PollInterval time.Duration `env:"WEBHOOK_POLL_INTERVAL,default=1m" yaml:"pollInterval" validate:"gt=0"`
+}
+
+// StationConfig stores a packing bench station which is created, or replaced, when the application
+// starts. Stations can also be registered from the stations page
+type StationConfig struct {
+	Name string `yaml:"name" validate:"required"`
+	// Service and Account default the scan form until the first scan at the station
+	Service string `yaml:"service" validate:"omitempty,oneof=IPA Orange RRD"`
+	Account string `yaml:"account" validate:"omitempty,oneof=OTC WAB"`
+	// UnitSystem is imperial, for pounds and inches, or metric, for kilograms and centimetres
+	UnitSystem string `yaml:"unitSystem" validate:"omitempty,oneof=imperial metric"`
+	// Scale and Printer identify the scale and label printer bound to the station
+	Scale   string `yaml:"scale"`
+	Printer string `yaml:"printer"`
+}
+
+// ServiceFormats maps services to the manifest format their carrier accepts
+// It is decoded from a list of service:format pairs separated by semicolons, such as "IPA:edi;RRD:fixed"
+type ServiceFormats map[string]string
+
+// Decode decodes service formats from an environment variable
+func (f *ServiceFormats) Decode(value string) error {
+	formats := make(ServiceFormats)
+
+	for _, pair := range strings.Split(value, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return fmt.Errorf("invalid service manifest format: %s", pair)
+		}
+
+		formats[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	*f = formats
+	return nil
+}
+
+// UnmarshalYAML decodes service formats from a config file mapping, replacing the default formats
+// rather than adding to them, as the environment variable does
+func (f *ServiceFormats) UnmarshalYAML(value *yaml.Node) error {
+	formats := make(map[string]string)
+	err := value.Decode(&formats)
+	if err != nil {
+		return err
+	}
+
+	*f = formats
+	return nil
 }
@@ -0,0 +1,278 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv is the environment variable that names the optional config file
+const FileEnv = "CONFIG_FILE"
+
+// redacted replaces the values of secrets when configuration is shown
+const redacted = "[redacted]"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// decoder is implemented by types that decode themselves from environment variables
+type decoder interface {
+	Decode(value string) error
+}
+
+// InvalidError describes every invalid value in a configuration
+type InvalidError struct {
+	Problems []string
+}
+
+func (e InvalidError) Error() string {
+	return "Invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// setting is a configuration value that can be set by an environment variable
+type setting struct {
+	value      reflect.Value
+	env        string
+	key        string
+	namespace  string
+	def        string
+	hasDefault bool
+	secret     bool
+}
+
+// GetConfig loads configuration in layers which each override the last: the defaults, then the config
+// file named by the CONFIG_FILE environment variable, if any, then environment variables. An
+// InvalidError is returned if any value is invalid
+func GetConfig() (Config, error) {
+	var cfg Config
+	all := settings(&cfg)
+
+	for _, s := range all {
+		if s.hasDefault {
+			err := s.set(s.def)
+			if err != nil {
+				return cfg, fmt.Errorf("Invalid default for %s: %s", s.env, err.Error())
+			}
+		}
+	}
+
+	if path := os.Getenv(FileEnv); path != "" {
+		err := loadFile(path, &cfg)
+		if err != nil {
+			return cfg, err
+		}
+	}
+
+	// Empty environment variables are ignored, as they are often left blank in env files
+	problems := []string{}
+	for _, s := range all {
+		if value := os.Getenv(s.env); value != "" {
+			err := s.set(value)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s (%s) %s", s.env, s.key, err.Error()))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return cfg, InvalidError{Problems: problems}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Validate checks every value of the configuration, returning an InvalidError if any are invalid
+func (c Config) Validate() error {
+	err := validator.New().Struct(c)
+	if err == nil {
+		return nil
+	}
+
+	fieldErrs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return err
+	}
+
+	byNamespace := make(map[string]setting)
+	for _, s := range settings(&c) {
+		byNamespace[s.namespace] = s
+	}
+
+	problems := make([]string, 0, len(fieldErrs))
+	for _, fieldErr := range fieldErrs {
+		s, ok := byNamespace[fieldErr.StructNamespace()]
+		if !ok {
+			// Values that can only be provided by the config file, such as stations, have no environment variable
+			problems = append(problems, fmt.Sprintf("%s %s", fileKey(fieldErr.StructNamespace()), describe(fieldErr, s, byNamespace)))
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("%s (%s) %s", s.env, s.key, describe(fieldErr, s, byNamespace)))
+	}
+
+	return InvalidError{Problems: problems}
+}
+
+// Redacted returns a copy of the configuration with secrets, including any password in the Mongo URL,
+// replaced so it can be shown
+func (c Config) Redacted() Config {
+	for _, s := range settings(&c) {
+		if s.secret && s.value.String() != "" {
+			s.value.SetString(redacted)
+		}
+	}
+
+	if u, err := url.Parse(c.Mongo.URL); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			c.Mongo.URL = u.Redacted()
+		}
+	}
+
+	return c
+}
+
+// loadFile decodes a YAML config file on top of a configuration. Keys which are not configuration
+// settings are rejected, so mistakes are not silently ignored
+func loadFile(path string, cfg *Config) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Unable to read config file: %s", err.Error())
+	}
+	defer file.Close()
+
+	dec := yaml.NewDecoder(file)
+	dec.KnownFields(true)
+
+	err = dec.Decode(cfg)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("Invalid config file %s: %s", path, strings.TrimPrefix(err.Error(), "yaml: "))
+	}
+
+	return nil
+}
+
+// settings returns every setting of a configuration in the order they are declared
+func settings(cfg *Config) []setting {
+	var all []setting
+
+	var walk func(v reflect.Value, key, namespace string)
+	walk = func(v reflect.Value, key, namespace string) {
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			fieldKey := strings.TrimPrefix(key+"."+field.Tag.Get("yaml"), ".")
+			fieldNamespace := namespace + "." + field.Name
+
+			tag, ok := field.Tag.Lookup("env")
+			if !ok {
+				if field.Type.Kind() == reflect.Struct {
+					walk(v.Field(i), fieldKey, fieldNamespace)
+				}
+				continue
+			}
+
+			name, opts, _ := strings.Cut(tag, ",")
+			s := setting{
+				value:     v.Field(i),
+				env:       name,
+				key:       fieldKey,
+				namespace: fieldNamespace,
+				secret:    field.Tag.Get("secret") == "true",
+			}
+			if strings.HasPrefix(opts, "default=") {
+				s.def, s.hasDefault = strings.TrimPrefix(opts, "default="), true
+			}
+			all = append(all, s)
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "", "Config")
+
+	return all
+}
+
+// set parses a value from an environment variable or default and sets it
+func (s setting) set(value string) error {
+	if d, ok := s.value.Addr().Interface().(decoder); ok {
+		return d.Decode(value)
+	}
+
+	switch s.value.Kind() {
+	case reflect.String:
+		s.value.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("must be true or false, not %q", value)
+		}
+		s.value.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		if s.value.Type() == durationType {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("must be a duration such as 30s, 5m or 12h, not %q", value)
+			}
+			s.value.SetInt(int64(d))
+			break
+		}
+		n, err := strconv.ParseInt(value, 10, s.value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a whole number, not %q", value)
+		}
+		s.value.SetInt(n)
+	case reflect.Uint16:
+		n, err := strconv.ParseUint(value, 10, s.value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a whole number up to 65535, not %q", value)
+		}
+		s.value.SetUint(n)
+	default:
+		return fmt.Errorf("has an unsupported type: %s", s.value.Type())
+	}
+
+	return nil
+}
+
+// fileKey returns the config file key of a value from its struct namespace, such as stations[0].name
+// for Config.Stations[0].Name, as the fields of values that can only be provided by the config file are
+// named like their keys
+func fileKey(namespace string) string {
+	parts := strings.Split(strings.TrimPrefix(namespace, "Config."), ".")
+	for i, part := range parts {
+		parts[i] = strings.ToLower(part[:1]) + part[1:]
+	}
+	return strings.Join(parts, ".")
+}
+
+// describe explains why a setting failed validation
+func describe(fieldErr validator.FieldError, s setting, byNamespace map[string]setting) string {
+	param := fieldErr.Param()
+	if s.value.IsValid() && s.value.Type() == durationType {
+		if d, err := time.ParseDuration(param); err == nil {
+			param = d.String()
+		}
+	}
+
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "required_with":
+		other := byNamespace[strings.TrimSuffix(s.namespace, fieldErr.StructField())+param]
+		return fmt.Sprintf("is required when %s is set", other.env)
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", strings.ReplaceAll(param, " ", ", "))
+	case "min", "gte":
+		return fmt.Sprintf("must be at least %s", param)
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", param)
+	case "dir":
+		return "must be an existing directory"
+	case "unique":
+		return fmt.Sprintf("must not repeat a %s", strings.ToLower(param))
+	default:
+		return fmt.Sprintf("failed the %s check", fieldErr.Tag())
+	}
+}
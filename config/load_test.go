@@ -0,0 +1,177 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetConfig(t *testing.T) {
+	tests := []struct {
+		name             string
+		file             string
+		env              map[string]string
+		wantPort         uint16
+		wantReadTimeout  time.Duration
+		wantMongoURL     string
+		wantMongoDB      string
+		wantMarkExported bool
+		wantFormats      ServiceFormats
+		wantStations     []StationConfig
+		wantErr          string
+	}{
+		{
+			name:             "defaults",
+			wantPort:         5000,
+			wantReadTimeout:  5 * time.Minute,
+			wantMongoURL:     "mongodb://localhost:27017",
+			wantMongoDB:      "scanner",
+			wantMarkExported: true,
+			wantFormats:      ServiceFormats{"IPA": "edi", "Orange": "fixed", "RRD": "fixed"},
+		},
+		{
+			name:             "file overrides defaults",
+			file:             "http:\n  port: 6000\nmongo:\n  db: orders\nmanifest:\n  formats:\n    IPA: fixed\nstations:\n  - name: bench-1\n    unitSystem: metric\n",
+			wantPort:         6000,
+			wantReadTimeout:  5 * time.Minute,
+			wantMongoURL:     "mongodb://localhost:27017",
+			wantMongoDB:      "orders",
+			wantMarkExported: true,
+			wantFormats:      ServiceFormats{"IPA": "fixed"},
+			wantStations:     []StationConfig{{Name: "bench-1", UnitSystem: "metric"}},
+		},
+		{
+			name: "environment overrides file",
+			file: "http:\n  port: 6000\n  readTimeout: 1m\nexport:\n  markExported: true\n",
+			env: map[string]string{
+				"HTTP_PORT":            "7000",
+				"EXPORT_MARK_EXPORTED": "false",
+				"MANIFEST_FORMATS":     "IPA:edi; RRD : fixed ;",
+				"MONGO_DB":             "",
+			},
+			wantPort:        7000,
+			wantReadTimeout: time.Minute,
+			wantMongoURL:    "mongodb://localhost:27017",
+			wantMongoDB:     "scanner",
+			wantFormats:     ServiceFormats{"IPA": "edi", "RRD": "fixed"},
+		},
+		{
+			name:    "unknown file key",
+			file:    "http:\n  prot: 6000\n",
+			wantErr: "field prot not found",
+		},
+		{
+			name: "invalid environment values",
+			env: map[string]string{
+				"HTTP_PORT":       "70000",
+				"WEBHOOK_TIMEOUT": "10",
+			},
+			wantErr: "HTTP_PORT (http.port) must be a whole number up to 65535, not \"70000\"\n  WEBHOOK_TIMEOUT (webhook.timeout) must be a duration such as 30s, 5m or 12h, not \"10\"",
+		},
+		{
+			name:    "supervisor without a password",
+			env:     map[string]string{"SUPERVISOR_USER": "boss"},
+			wantErr: "SUPERVISOR_PASSWORD (supervisor.password) is required when SUPERVISOR_USER is set",
+		},
+		{
+			name:    "invalid file values",
+			file:    "log:\n  level: loud\nstations:\n  - name: bench-1\n  - name: bench-1\n",
+			wantErr: "LOG_LEVEL (log.level) must be one of: trace, debug, info, warn, error, fatal, panic\n  stations must not repeat a name",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Empty variables are ignored, so every setting starts from its default
+			t.Setenv(FileEnv, "")
+			for _, s := range settings(&Config{}) {
+				t.Setenv(s.env, "")
+			}
+
+			if tc.file != "" {
+				path := filepath.Join(t.TempDir(), "config.yaml")
+				if err := os.WriteFile(path, []byte(tc.file), 0644); err != nil {
+					t.Fatal(err)
+				}
+				t.Setenv(FileEnv, path)
+			}
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := GetConfig()
+
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if cfg.HTTP.Port != tc.wantPort || cfg.HTTP.ReadTimeout != tc.wantReadTimeout {
+				t.Errorf("expected port %d and read timeout %s, got %d and %s", tc.wantPort, tc.wantReadTimeout, cfg.HTTP.Port, cfg.HTTP.ReadTimeout)
+			}
+			if cfg.Mongo.URL != tc.wantMongoURL || cfg.Mongo.DB != tc.wantMongoDB {
+				t.Errorf("expected mongo %s/%s, got %s/%s", tc.wantMongoURL, tc.wantMongoDB, cfg.Mongo.URL, cfg.Mongo.DB)
+			}
+			if cfg.Export.MarkExported != tc.wantMarkExported {
+				t.Errorf("expected mark exported to be %t", tc.wantMarkExported)
+			}
+			if !reflect.DeepEqual(cfg.Manifest.Formats, tc.wantFormats) {
+				t.Errorf("expected manifest formats %v, got %v", tc.wantFormats, cfg.Manifest.Formats)
+			}
+			if !reflect.DeepEqual(cfg.Stations, tc.wantStations) {
+				t.Errorf("expected stations %+v, got %+v", tc.wantStations, cfg.Stations)
+			}
+		})
+	}
+}
+
+func TestConfigRedacted(t *testing.T) {
+	tests := []struct {
+		name     string
+		mongoURL string
+		wantURL  string
+	}{
+		{"url with password", "mongodb://scanner:hunter2@db:27017/scanner", "mongodb://scanner:xxxxx@db:27017/scanner"},
+		{"url without password", "mongodb://scanner@db:27017", "mongodb://scanner@db:27017"},
+		{"url without user", "mongodb://db:27017", "mongodb://db:27017"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := Config{}
+			cfg.Mongo.URL = tc.mongoURL
+			cfg.App.Secret = "app-secret"
+			cfg.HTTP.Auth.User = "admin"
+			cfg.HTTP.Auth.Password = "admin-password"
+			cfg.Supervisor.Password = "supervisor-password"
+
+			redactedCfg := cfg.Redacted()
+
+			if redactedCfg.Mongo.URL != tc.wantURL {
+				t.Errorf("expected URL %s, got %s", tc.wantURL, redactedCfg.Mongo.URL)
+			}
+			for _, secret := range []string{redactedCfg.App.Secret, redactedCfg.HTTP.Auth.Password, redactedCfg.Supervisor.Password} {
+				if secret != redacted {
+					t.Errorf("expected secrets to be redacted, got %q", secret)
+				}
+			}
+			if redactedCfg.HTTP.Auth.User != "admin" {
+				t.Errorf("expected values which are not secret to be kept, got %q", redactedCfg.HTTP.Auth.User)
+			}
+			if redactedCfg.Export.SFTP.Password != "" {
+				t.Errorf("expected empty secrets to stay empty, got %q", redactedCfg.Export.SFTP.Password)
+			}
+			if cfg.App.Secret != "app-secret" || cfg.Mongo.URL != tc.mongoURL {
+				t.Error("expected the original configuration to be unchanged")
+			}
+		})
+	}
+}
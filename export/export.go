@@ -0,0 +1,145 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+)
+
+// DefaultColumns returns export columns for every order field, in the order they are declared,
+// using the standard CSV headers
+func DefaultColumns() []models.ExportColumn {
+	orderColumns := models.OrderColumns()
+	columns := make([]models.ExportColumn, 0, len(orderColumns))
+
+	for _, col := range orderColumns {
+		columns = append(columns, models.ExportColumn{
+			Key:    col.Key,
+			Header: col.Header,
+		})
+	}
+
+	return columns
+}
+
+// ValidateColumns checks that export columns refer to order columns and have headers
+func ValidateColumns(columns []models.ExportColumn) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("At least one column must be exported")
+	}
+
+	order := models.Order{}
+	for _, col := range columns {
+		if _, ok := order.Get(col.Key); !ok {
+			return fmt.Errorf("Unknown column: %s", col.Key)
+		}
+
+		if col.Header == "" {
+			return fmt.Errorf("Column %s requires a header", col.Key)
+		}
+	}
+
+	return nil
+}
+
+// Writer writes orders to an exported file
+type Writer interface {
+	// Write writes a single order
+	Write(order *models.Order) error
+
+	// Close writes any buffered data and completes the file. It does not close the underlying writer
+	Close() error
+}
+
+// discarder is implemented by writers which hold resources, such as temporary files, that must be
+// released if the file is not completed
+type discarder interface {
+	Discard()
+}
+
+// WriteAll writes every order from an iterator using a given writer and closes the writer,
+// returning the number of orders written. If an order cannot be written, the writer is discarded
+func WriteAll(w Writer, it repository.OrderIterator) (int, error) {
+	count := 0
+
+	for it.Next() {
+		err := w.Write(it.Order())
+		if err != nil {
+			discard(w)
+			return count, err
+		}
+		count++
+	}
+
+	err := it.Err()
+	if err != nil {
+		discard(w)
+		return count, err
+	}
+
+	return count, w.Close()
+}
+
+// discard releases the resources held by a writer which will not be closed
+func discard(w Writer) {
+	if d, ok := w.(discarder); ok {
+		d.Discard()
+	}
+}
+
+// csvWriter writes orders as CSV with a given set of columns
+type csvWriter struct {
+	cw      *csv.Writer
+	columns []models.ExportColumn
+	row     []string
+	started bool
+}
+
+// NewCSVWriter creates a writer which writes orders as CSV with a given set of columns
+func NewCSVWriter(w io.Writer, columns []models.ExportColumn) Writer {
+	return &csvWriter{
+		cw:      csv.NewWriter(w),
+		columns: columns,
+		row:     make([]string, len(columns)),
+	}
+}
+
+func (w *csvWriter) Write(order *models.Order) error {
+	err := w.writeHeader()
+	if err != nil {
+		return err
+	}
+
+	for i, col := range w.columns {
+		w.row[i], _ = order.Get(col.Key)
+	}
+
+	return w.cw.Write(w.row)
+}
+
+func (w *csvWriter) Close() error {
+	err := w.writeHeader()
+	if err != nil {
+		return err
+	}
+
+	w.cw.Flush()
+	return w.cw.Error()
+}
+
+// writeHeader writes the header row, if it has not been written yet
+func (w *csvWriter) writeHeader() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+
+	for i, col := range w.columns {
+		w.row[i] = col.Header
+	}
+
+	return w.cw.Write(w.row)
+}
@@ -0,0 +1,67 @@
+package export
+
+import (
+	"io"
+	"sort"
+
+	"github.com/mikestefanello/otcscanner/models"
+)
+
+// Format describes a file format that orders can be exported as
+type Format struct {
+	// Name identifies the format and is used as the file extension
+	Name string
+
+	// ContentType is the MIME type of files in this format
+	ContentType string
+
+	// NewWriter creates a writer for this format
+	NewWriter func(w io.Writer, columns []models.ExportColumn) Writer
+}
+
+// formats contains the supported export formats, keyed by name
+var formats = map[string]Format{
+	"csv": {
+		Name:        "csv",
+		ContentType: "text/csv",
+		NewWriter:   NewCSVWriter,
+	},
+	"jsonl": {
+		Name:        "jsonl",
+		ContentType: "application/x-ndjson",
+		NewWriter:   NewJSONLWriter,
+	},
+	"xlsx": {
+		Name:        "xlsx",
+		ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		NewWriter:   NewXLSXWriter,
+	},
+}
+
+// formatAliases maps alternative format names to supported formats
+var formatAliases = map[string]string{
+	"ndjson": "jsonl",
+}
+
+// DefaultFormat is the name of the format used when none is specified
+const DefaultFormat = "csv"
+
+// GetFormat returns the export format with a given name or alias
+func GetFormat(name string) (Format, bool) {
+	if alias, ok := formatAliases[name]; ok {
+		name = alias
+	}
+
+	f, ok := formats[name]
+	return f, ok
+}
+
+// FormatNames returns the names of all supported export formats, sorted
+func FormatNames() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,59 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/mikestefanello/otcscanner/models"
+)
+
+// jsonlWriter writes orders as JSON Lines, with one object per order. Objects are keyed by column key,
+// which matches the order's JSON field names, and contain the given columns in order
+type jsonlWriter struct {
+	w       *bufio.Writer
+	columns []models.ExportColumn
+	keys    [][]byte
+}
+
+// NewJSONLWriter creates a writer which writes orders as JSON Lines with a given set of columns
+func NewJSONLWriter(w io.Writer, columns []models.ExportColumn) Writer {
+	jw := &jsonlWriter{
+		w:       bufio.NewWriter(w),
+		columns: columns,
+		keys:    make([][]byte, len(columns)),
+	}
+
+	for i, col := range columns {
+		jw.keys[i], _ = json.Marshal(col.Key)
+	}
+
+	return jw
+}
+
+func (w *jsonlWriter) Write(order *models.Order) error {
+	w.w.WriteByte('{')
+
+	for i, col := range w.columns {
+		if i > 0 {
+			w.w.WriteByte(',')
+		}
+
+		value, _ := order.Get(col.Key)
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+
+		w.w.Write(w.keys[i])
+		w.w.WriteByte(':')
+		w.w.Write(encoded)
+	}
+
+	w.w.WriteByte('}')
+	return w.w.WriteByte('\n')
+}
+
+func (w *jsonlWriter) Close() error {
+	return w.w.Flush()
+}
@@ -0,0 +1,104 @@
+package export
+
+import (
+	"io"
+
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/xuri/excelize/v2"
+)
+
+// xlsxSheetName is the name of the worksheet orders are exported to
+const xlsxSheetName = "Orders"
+
+// xlsxWriter writes orders as an Excel workbook with a given set of columns. Rows are written with a
+// stream writer, which moves them from memory to a temporary file as the sheet grows, so large exports
+// are never held in memory. The workbook is written to the underlying writer when the writer is closed
+type xlsxWriter struct {
+	w       io.Writer
+	file    *excelize.File
+	stream  *excelize.StreamWriter
+	columns []models.ExportColumn
+	row     []interface{}
+	rowNum  int
+	err     error
+}
+
+// NewXLSXWriter creates a writer which writes orders as an Excel workbook with a given set of columns
+func NewXLSXWriter(w io.Writer, columns []models.ExportColumn) Writer {
+	xw := &xlsxWriter{
+		w:       w,
+		file:    excelize.NewFile(),
+		columns: columns,
+		row:     make([]interface{}, len(columns)),
+	}
+
+	xw.err = xw.file.SetSheetName(xw.file.GetSheetName(0), xlsxSheetName)
+	if xw.err == nil {
+		xw.stream, xw.err = xw.file.NewStreamWriter(xlsxSheetName)
+	}
+
+	return xw
+}
+
+func (w *xlsxWriter) Write(order *models.Order) error {
+	err := w.writeHeader()
+	if err != nil {
+		return err
+	}
+
+	for i, col := range w.columns {
+		w.row[i], _ = order.Get(col.Key)
+	}
+
+	return w.writeRow()
+}
+
+func (w *xlsxWriter) Close() error {
+	defer w.file.Close()
+
+	err := w.writeHeader()
+	if err != nil {
+		return err
+	}
+
+	err = w.stream.Flush()
+	if err != nil {
+		return err
+	}
+
+	return w.file.Write(w.w)
+}
+
+// Discard releases the workbook and its temporary files without writing it
+func (w *xlsxWriter) Discard() {
+	w.file.Close()
+}
+
+// writeHeader writes the header row, if it has not been written yet
+func (w *xlsxWriter) writeHeader() error {
+	if w.err != nil {
+		return w.err
+	}
+
+	if w.rowNum > 0 {
+		return nil
+	}
+
+	for i, col := range w.columns {
+		w.row[i] = col.Header
+	}
+
+	return w.writeRow()
+}
+
+// writeRow writes the current row values to the next row of the sheet
+func (w *xlsxWriter) writeRow() error {
+	w.rowNum++
+
+	cell, err := excelize.CoordinatesToCellName(1, w.rowNum)
+	if err != nil {
+		return err
+	}
+
+	return w.stream.SetRow(cell, w.row)
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-playground/validator/v10"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+	"github.com/rs/zerolog/log"
+)
+
+type apiError struct {
+	Error   string   `json:"error"`
+	Details []string `json:"details,omitempty"`
+}
+
+type apiOrderUpdate struct {
+	Order   *models.Order        `json:"order"`
+	Changes []models.FieldChange `json:"changes"`
+}
+
+// APIOrder handles get requests to load a single order via the API
+func (h *HTTPHandler) APIOrder(w http.ResponseWriter, r *http.Request) {
+	order, err := h.repo.LoadByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			writeJSONError(w, http.StatusNotFound, err)
+		} else {
+			requestLog(r).Error().Err(err).Msg("Unable to load order from database.")
+			writeJSONError(w, http.StatusInternalServerError, errDatabase)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, order)
+}
+
+// APIUpdateOrder handles put requests to edit a single order via the API
+func (h *HTTPHandler) APIUpdateOrder(w http.ResponseWriter, r *http.Request) {
+	var edit orderEdit
+	err := json.NewDecoder(r.Body).Decode(&edit)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	order, err := h.repo.LoadByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			writeJSONError(w, http.StatusNotFound, err)
+		} else {
+			requestLog(r).Error().Err(err).Msg("Unable to load order from database.")
+			writeJSONError(w, http.StatusInternalServerError, errDatabase)
+		}
+		return
+	}
+
+	updated, changes, err := h.updateOrder(r, order, edit)
+	if err != nil {
+		writeJSONError(w, apiErrorStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apiOrderUpdate{
+		Order:   updated,
+		Changes: changes,
+	})
+}
+
+// APIExport handles get requests to download filtered orders as a file via the API
+func (h *HTTPHandler) APIExport(w http.ResponseWriter, r *http.Request) {
+	err := h.serveExport(w, r, r.URL.Query())
+	if err != nil {
+		writeJSONError(w, apiErrorStatus(err), err)
+	}
+}
+
+// APIExportProfiles handles get requests to list the export profiles via the API
+func (h *HTTPHandler) APIExportProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles, err := h.exportProfiles.LoadAll()
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to load export profiles from the database.")
+		writeJSONError(w, http.StatusInternalServerError, errDatabase)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, profiles)
+}
+
+// APISaveExportProfile handles put requests to create or replace an export profile via the API
+func (h *HTTPHandler) APISaveExportProfile(w http.ResponseWriter, r *http.Request) {
+	var profile models.ExportProfile
+	err := json.NewDecoder(r.Body).Decode(&profile)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	if profile.Name == "" {
+		profile.Name = name
+	}
+
+	err = h.saveExportProfile(r, name, &profile)
+	if err != nil {
+		writeJSONError(w, apiErrorStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, profile)
+}
+
+// APIDeleteExportProfile handles delete requests to remove an export profile via the API
+func (h *HTTPHandler) APIDeleteExportProfile(w http.ResponseWriter, r *http.Request) {
+	err := h.exportProfiles.Delete(chi.URLParam(r, "name"))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			writeJSONError(w, http.StatusNotFound, err)
+		} else {
+			requestLog(r).Error().Err(err).Msg("Unable to delete export profile.")
+			writeJSONError(w, http.StatusInternalServerError, errDatabase)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiErrorStatus returns the HTTP status code that describes a given error
+func apiErrorStatus(err error) int {
+	switch err.(type) {
+	case validator.ValidationErrors, inputError:
+		return http.StatusUnprocessableEntity
+	}
+
+	switch err {
+	case repository.ErrNotFound:
+		return http.StatusNotFound
+	case errOrderClosed:
+		return http.StatusForbidden
+	}
+
+	return http.StatusInternalServerError
+}
+
+// writeJSON writes a given value as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to encode JSON response.")
+	}
+}
+
+// writeJSONError writes a given error as a JSON response
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	resp := apiError{
+		Error: http.StatusText(status),
+	}
+
+	msgs := errorMessages(err)
+	if len(msgs) == 1 {
+		resp.Error = msgs[0]
+	} else {
+		resp.Details = msgs
+	}
+
+	writeJSON(w, status, resp)
+}
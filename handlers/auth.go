@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mikestefanello/otcscanner/auth"
+	"github.com/mikestefanello/otcscanner/logging"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+)
+
+// sessionCookie is the name of the cookie that stores the session token
+const sessionCookie = "session"
+
+// contextKey is the type of the keys of values stored in request contexts
+type contextKey string
+
+// Request context keys of the authenticated user and, for machine clients, their API token
+const (
+	userContextKey  contextKey = "user"
+	tokenContextKey contextKey = "token"
+)
+
+// tokenLastUsedInterval is how often the last used time of an API token is updated, so a client
+// making many requests does not write to the database for each one
+const tokenLastUsedInterval = time.Minute
+
+// anonymousUser is the user of requests made when there are no users, so no one has to log in
+var anonymousUser = models.User{
+	Role:   models.RoleAdmin,
+	Active: true,
+}
+
+type loginPage struct {
+	Username string
+	Next     string
+}
+
+// Authenticate is middleware which identifies the user making a request from their session cookie or,
+// for scripts, a bearer API token or basic auth credentials, and stores them in the request context.
+// Requests without a user are redirected to the login page, or rejected if they are API requests. If
+// there are no users, every request is allowed
+func (h *HTTPHandler) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		token, err := h.authenticatedToken(r)
+		if token != nil {
+			ctx = context.WithValue(ctx, tokenContextKey, token)
+			ctx = context.WithValue(ctx, userContextKey, &models.User{
+				Username: token.Actor(),
+				Active:   true,
+			})
+			logging.SetActor(ctx, token.Actor())
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		var user *models.User
+		if err == nil {
+			user, err = h.authenticatedUser(r)
+		}
+
+		if err == repository.ErrNotFound {
+			var count int64
+			count, err = h.users.Count()
+			if err == nil && count == 0 {
+				user = &anonymousUser
+			}
+		}
+
+		if err != nil && err != repository.ErrNotFound {
+			requestLog(r).Error().Err(err).Msg("Unable to authenticate request.")
+			http.Error(w, "Unable to communicate with the database", http.StatusInternalServerError)
+			return
+		}
+
+		if user == nil {
+			if isAPIRequest(r) {
+				w.Header().Add("WWW-Authenticate", `Bearer realm="app"`)
+				w.Header().Add("WWW-Authenticate", `Basic realm="app"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+			return
+		}
+
+		ctx = context.WithValue(ctx, userContextKey, user)
+		if user.Username != "" {
+			logging.SetActor(ctx, user.Username)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Authorize returns middleware which only allows requests from users with a given role or a more
+// privileged one, and from API tokens with a given scope. It must be used after Authenticate
+func (h *HTTPHandler) Authorize(role, scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var allowed bool
+			if token := requestToken(r); token != nil {
+				allowed = token.HasScope(scope)
+			} else if user := requestUser(r); user != nil {
+				allowed = user.HasRole(role)
+			}
+
+			if !allowed {
+				requestLog(r).Warn().Str("path", r.URL.Path).Str("role", role).Str("scope", scope).Msg("Request denied for insufficient role or scope.")
+
+				if isAPIRequest(r) {
+					http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+					return
+				}
+
+				w.WriteHeader(http.StatusForbidden)
+				page := Page{
+					Title: "Access denied",
+				}
+				page.AddMessage("danger", "You do not have permission to access this page.")
+				h.Render(w, r, "text", page)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// LoginForm handles both get and post requests on the login form
+func (h *HTTPHandler) LoginForm(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Log in",
+	}
+
+	content := loginPage{
+		Next: safeRedirect(r.FormValue("next")),
+	}
+
+	if r.Method == http.MethodPost {
+		content.Username = strings.TrimSpace(r.FormValue("username"))
+
+		user, err := h.checkCredentials(content.Username, r.FormValue("password"))
+		switch {
+		case err == repository.ErrNotFound:
+			requestLog(r).Warn().Str("user", content.Username).Msg("Failed login attempt.")
+			page.AddMessage("danger", "Invalid username or password.")
+		case err != nil:
+			requestLog(r).Error().Err(err).Msg("Unable to load user from the database.")
+			page.AddMessage("danger", "Unable to communicate with the database.")
+		default:
+			err = h.startSession(w, r, user)
+			if err != nil {
+				requestLog(r).Error().Err(err).Msg("Unable to create session.")
+				page.AddMessage("danger", "Unable to log in.")
+				break
+			}
+
+			requestLog(r).Info().Str("user", user.Username).Msg("User logged in.")
+			http.Redirect(w, r, content.Next, http.StatusSeeOther)
+			return
+		}
+	}
+
+	page.Content = content
+	h.Render(w, r, "login", page)
+}
+
+// Logout handles post requests to end the current session
+func (h *HTTPHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		err = h.sessions.Delete(auth.HashToken(cookie.Value))
+		if err != nil {
+			requestLog(r).Error().Err(err).Msg("Unable to delete session.")
+		}
+	}
+
+	h.setCookie(w, r, &http.Cookie{
+		Name:   sessionCookie,
+		MaxAge: -1,
+	})
+
+	requestLog(r).Info().Msg("User logged out.")
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// authenticatedToken returns the API token given as a request's bearer token. It returns nil and no
+// error if the request does not have a bearer token, and ErrNotFound if the token is not valid
+func (h *HTTPHandler) authenticatedToken(r *http.Request) (*models.APIToken, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, nil
+	}
+
+	token, err := h.apiTokens.LoadByHash(auth.HashToken(strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))))
+	if err != nil {
+		return nil, err
+	}
+
+	if now := time.Now(); now.Sub(token.LastUsed) > tokenLastUsedInterval {
+		token.LastUsed = now
+		err = h.apiTokens.UpdateLastUsed(token.ID, now)
+		if err != nil {
+			requestLog(r).Error().Err(err).Str("token", token.ID).Msg("Unable to update API token last used time.")
+		}
+	}
+
+	return token, nil
+}
+
+// authenticatedUser returns the active user identified by a request's session cookie or basic auth
+// credentials, or ErrNotFound if there is none
+func (h *HTTPHandler) authenticatedUser(r *http.Request) (*models.User, error) {
+	if username, password, ok := r.BasicAuth(); ok {
+		return h.checkCredentials(username, password)
+	}
+
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, repository.ErrNotFound
+	}
+
+	session, err := h.sessions.LoadByID(auth.HashToken(cookie.Value))
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(session.Expires) {
+		return nil, repository.ErrNotFound
+	}
+
+	user, err := h.users.LoadByUsername(session.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.Active {
+		return nil, repository.ErrNotFound
+	}
+
+	return user, nil
+}
+
+// checkCredentials returns the active user with a given username and password, or ErrNotFound if
+// there is no such user or the password does not match
+func (h *HTTPHandler) checkCredentials(username, password string) (*models.User, error) {
+	return auth.CheckCredentials(h.users, username, password)
+}
+
+// startSession creates a session for a user and sets its cookie. Expired sessions are removed at
+// the same time
+func (h *HTTPHandler) startSession(w http.ResponseWriter, r *http.Request, user *models.User) error {
+	token, err := auth.NewToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	session := &models.Session{
+		ID:       auth.HashToken(token),
+		Username: user.Username,
+		Created:  now,
+		Expires:  now.Add(h.config.HTTP.Auth.SessionTTL),
+	}
+
+	err = h.sessions.InsertOne(session)
+	if err != nil {
+		return err
+	}
+
+	err = h.sessions.DeleteExpired()
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to delete expired sessions.")
+	}
+
+	h.setCookie(w, r, &http.Cookie{
+		Name:    sessionCookie,
+		Value:   token,
+		Expires: session.Expires,
+	})
+
+	return nil
+}
+
+// requestUser returns the user making a given request, if they have been authenticated
+func requestUser(r *http.Request) *models.User {
+	user, _ := r.Context().Value(userContextKey).(*models.User)
+	return user
+}
+
+// requestToken returns the API token used to make a given request, if one was used
+func requestToken(r *http.Request) *models.APIToken {
+	token, _ := r.Context().Value(tokenContextKey).(*models.APIToken)
+	return token
+}
+
+// isAPIRequest determines if a request was made to the API or with credentials in its headers, such as
+// by a script or handheld device, rather than from a browser session
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") || r.Header.Get("Authorization") != ""
+}
+
+// safeRedirect returns a given redirect path if it is local to the application, or the home page
+// otherwise, so the login form cannot be used to send users to another site
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikestefanello/otcscanner/auth"
+	"github.com/mikestefanello/otcscanner/config"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+	"github.com/rs/zerolog"
+)
+
+func TestMain(m *testing.M) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+// fakeUsers is a user repository which stores users in memory
+type fakeUsers struct {
+	repository.UserRepository
+	users map[string]models.User
+}
+
+func (f *fakeUsers) LoadByUsername(username string) (*models.User, error) {
+	user, ok := f.users[username]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &user, nil
+}
+
+func (f *fakeUsers) Count() (int64, error) {
+	return int64(len(f.users)), nil
+}
+
+// fakeSessions is a session repository which stores sessions in memory
+type fakeSessions struct {
+	repository.SessionRepository
+	sessions map[string]models.Session
+}
+
+func (f *fakeSessions) LoadByID(id string) (*models.Session, error) {
+	session, ok := f.sessions[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &session, nil
+}
+
+// fakeTokens is an API token repository which stores tokens in memory
+type fakeTokens struct {
+	repository.APITokenRepository
+	tokens map[string]models.APIToken
+}
+
+func (f *fakeTokens) LoadByHash(hash string) (*models.APIToken, error) {
+	token, ok := f.tokens[hash]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &token, nil
+}
+
+func (f *fakeTokens) UpdateLastUsed(id string, t time.Time) error {
+	return nil
+}
+
+func TestAuthenticateAuthorize(t *testing.T) {
+	users := &fakeUsers{users: map[string]models.User{}}
+	for username, role := range map[string]string{"ada": models.RoleAdmin, "sam": models.RoleSupervisor, "sky": models.RoleScanner, "ivy": models.RoleSupervisor} {
+		hash, err := auth.HashPassword(username + "-password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		users.users[username] = models.User{Username: username, PasswordHash: hash, Role: role, Active: username != "ivy"}
+	}
+	sessions := &fakeSessions{sessions: map[string]models.Session{
+		auth.HashToken("sky-session"): {Username: "sky", Expires: time.Now().Add(time.Hour)},
+		auth.HashToken("ada-expired"): {Username: "ada", Expires: time.Now().Add(-time.Minute)},
+		auth.HashToken("ivy-session"): {Username: "ivy", Expires: time.Now().Add(time.Hour)},
+	}}
+
+	tokens := &fakeTokens{tokens: map[string]models.APIToken{
+		auth.HashToken("otc_read"):  {ID: "read-id", Name: "dashboard", Scopes: []string{models.TokenScopeRead}, LastUsed: time.Now()},
+		auth.HashToken("otc_admin"): {ID: "admin-id", Name: "dashboard", Scopes: []string{models.TokenScopeAdmin}, LastUsed: time.Now()},
+	}}
+
+	// The templates are read from disk, along with stand-ins for the third party static files
+	cfg := config.Config{}
+	cfg.App.Name = "Test"
+	cfg.App.Secret = "test-secret"
+	cfg.App.DevDir = "testdata"
+
+	withUsers, err := NewHTTPHandler(cfg, repository.Repositories{Users: users, Sessions: sessions, APITokens: tokens}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutUsers, err := NewHTTPHandler(cfg, repository.Repositories{Users: &fakeUsers{}, Sessions: sessions, APITokens: tokens}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := func(token string) func(r *http.Request) {
+		return func(r *http.Request) {
+			r.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+		}
+	}
+	basic := func(username, password string) func(r *http.Request) {
+		return func(r *http.Request) {
+			r.SetBasicAuth(username, password)
+		}
+	}
+	bearer := func(token string) func(r *http.Request) {
+		return func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	tests := []struct {
+		name       string
+		noUsers    bool
+		path       string
+		role       string
+		scope      string
+		credential func(r *http.Request)
+		wantStatus int
+		wantActor  string
+		wantHeader string
+	}{
+		{
+			name:       "anonymous page request",
+			path:       "/orders?page=2",
+			role:       models.RoleScanner,
+			scope:      models.TokenScopeRead,
+			wantStatus: http.StatusSeeOther,
+			wantHeader: "/login?next=%2Forders%3Fpage%3D2",
+		},
+		{
+			name:       "anonymous API request",
+			path:       "/api/orders",
+			role:       models.RoleScanner,
+			scope:      models.TokenScopeRead,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "anyone is an admin when there are no users",
+			noUsers:    true,
+			path:       "/users",
+			role:       models.RoleAdmin,
+			scope:      models.TokenScopeAdmin,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "session of a scanner",
+			path:       "/scan",
+			role:       models.RoleScanner,
+			scope:      models.TokenScopeScan,
+			credential: session("sky-session"),
+			wantStatus: http.StatusOK,
+			wantActor:  "sky",
+		},
+		{
+			name:       "session of a scanner on a supervisor page",
+			path:       "/database",
+			role:       models.RoleSupervisor,
+			scope:      models.TokenScopeRead,
+			credential: session("sky-session"),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "expired session",
+			path:       "/scan",
+			role:       models.RoleScanner,
+			scope:      models.TokenScopeScan,
+			credential: session("ada-expired"),
+			wantStatus: http.StatusSeeOther,
+			wantHeader: "/login?next=%2Fscan",
+		},
+		{
+			name:       "session of an inactive user",
+			path:       "/scan",
+			role:       models.RoleScanner,
+			scope:      models.TokenScopeScan,
+			credential: session("ivy-session"),
+			wantStatus: http.StatusSeeOther,
+			wantHeader: "/login?next=%2Fscan",
+		},
+		{
+			name:       "unknown session",
+			path:       "/scan",
+			role:       models.RoleScanner,
+			scope:      models.TokenScopeScan,
+			credential: session("forged"),
+			wantStatus: http.StatusSeeOther,
+			wantHeader: "/login?next=%2Fscan",
+		},
+		{
+			name:       "basic auth of an admin",
+			path:       "/api/users",
+			role:       models.RoleAdmin,
+			scope:      models.TokenScopeAdmin,
+			credential: basic("ada", "ada-password"),
+			wantStatus: http.StatusOK,
+			wantActor:  "ada",
+		},
+		{
+			name:       "basic auth of a supervisor on an admin route",
+			path:       "/api/users",
+			role:       models.RoleAdmin,
+			scope:      models.TokenScopeAdmin,
+			credential: basic("sam", "sam-password"),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "basic auth with the wrong password",
+			path:       "/api/orders",
+			role:       models.RoleScanner,
+			scope:      models.TokenScopeRead,
+			credential: basic("ada", "sam-password"),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "basic auth of an inactive user",
+			path:       "/api/orders",
+			role:       models.RoleScanner,
+			scope:      models.TokenScopeRead,
+			credential: basic("ivy", "ivy-password"),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "token with the required scope",
+			path:       "/api/orders",
+			role:       models.RoleSupervisor,
+			scope:      models.TokenScopeRead,
+			credential: bearer("otc_read"),
+			wantStatus: http.StatusOK,
+			wantActor:  "token:read-id",
+		},
+		{
+			name:       "token without the required scope",
+			path:       "/api/scan",
+			role:       models.RoleScanner,
+			scope:      models.TokenScopeScan,
+			credential: bearer("otc_read"),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "admin token has every scope",
+			path:       "/api/import",
+			role:       models.RoleAdmin,
+			scope:      models.TokenScopeImport,
+			credential: bearer("otc_admin"),
+			wantStatus: http.StatusOK,
+			wantActor:  "token:admin-id",
+		},
+		{
+			name:       "unknown token",
+			path:       "/api/orders",
+			role:       models.RoleScanner,
+			scope:      models.TokenScopeRead,
+			credential: bearer("otc_forged"),
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := withUsers
+			if tc.noUsers {
+				h = withoutUsers
+			}
+
+			var actor string
+			handler := h.Authenticate(h.Authorize(tc.role, tc.scope)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				actor = requestActor(r)
+			})))
+
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.credential != nil {
+				tc.credential(r)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.wantStatus, w.Code, w.Body.String())
+			}
+			if actor != tc.wantActor {
+				t.Errorf("expected actor %q, got %q", tc.wantActor, actor)
+			}
+
+			switch w.Code {
+			case http.StatusSeeOther:
+				if location := w.Header().Get("Location"); location != tc.wantHeader {
+					t.Errorf("expected a redirect to %s, got %s", tc.wantHeader, location)
+				}
+			case http.StatusUnauthorized:
+				if got := w.Header().Values("WWW-Authenticate"); len(got) != 2 {
+					t.Errorf("expected bearer and basic challenges, got %v", got)
+				}
+			case http.StatusForbidden:
+				isPage := strings.Contains(w.Body.String(), "You do not have permission to access this page.")
+				if isPage == strings.HasPrefix(tc.path, "/api/") {
+					t.Errorf("expected API requests to be denied without a page, got %q", w.Body.String())
+				}
+			}
+		})
+	}
+}
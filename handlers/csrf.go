@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/mikestefanello/otcscanner/auth"
+)
+
+// csrfCookie is the name of the cookie that stores the value CSRF tokens are derived from
+const csrfCookie = "csrf"
+
+// csrfField is the name of the form field, and csrfHeader the name of the header, that a CSRF token
+// is submitted in
+const (
+	csrfField  = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+)
+
+// csrfContextKey is the request context key of the request's CSRF token
+const csrfContextKey contextKey = "csrf"
+
+// csrfMultipartLimit is the number of bytes at the start of a multipart form that are searched for the
+// CSRF token, so uploads are not read before the request is known to be allowed. Forms include the
+// token before any files
+const csrfMultipartLimit = 64 << 10
+
+// maxCSRFTokenSize is the maximum size of a submitted CSRF token
+const maxCSRFTokenSize = 1 << 10
+
+// CSRF is middleware which protects against cross-site request forgery. Each browser is given a random
+// cookie, and forms must include a token which is the cookie's signature, so a page on another site
+// cannot submit a form on behalf of a user.
+//
+// Only post requests are checked, because browsers do not allow other sites to make put and delete
+// requests without the application's permission. Requests with API tokens are not checked, because
+// browsers never send them automatically
+func (h *HTTPHandler) CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := ""
+		if cookie, err := r.Cookie(csrfCookie); err == nil {
+			value = cookie.Value
+		}
+
+		if value == "" {
+			var err error
+			value, err = auth.NewToken()
+			if err != nil {
+				requestLog(r).Error().Err(err).Msg("Unable to generate CSRF cookie.")
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			h.setCookie(w, r, &http.Cookie{
+				Name:  csrfCookie,
+				Value: value,
+			})
+		}
+
+		token := auth.Sign(h.secret, csrfCookie+":"+value)
+
+		if r.Method == http.MethodPost && !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			submitted := r.Header.Get(csrfHeader)
+			if submitted == "" {
+				submitted = submittedCSRFToken(r)
+			}
+
+			if subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+				requestLog(r).Warn().Str("path", r.URL.Path).Str("ip", r.RemoteAddr).Msg("Request denied for invalid CSRF token.")
+
+				if isAPIRequest(r) {
+					http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+					return
+				}
+
+				w.WriteHeader(http.StatusForbidden)
+				page := Page{
+					Title: "Access denied",
+				}
+				page.AddMessage("danger", "The form has expired. Go back, reload the page and try again.")
+				h.Render(w, r, "text", page)
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), csrfContextKey, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// submittedCSRFToken returns the CSRF token submitted in a request's form. Only the start of a
+// multipart form is read, and what was read is put back so the handler can read the whole form
+func submittedCSRFToken(r *http.Request) string {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return r.PostFormValue(csrfField)
+	}
+
+	var read bytes.Buffer
+	body := r.Body
+	defer func() {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(&read, body), body}
+	}()
+
+	parts := multipart.NewReader(io.TeeReader(io.LimitReader(body, csrfMultipartLimit), &read), params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err != nil {
+			return ""
+		}
+
+		if part.FormName() == csrfField {
+			token, _ := io.ReadAll(io.LimitReader(part, maxCSRFTokenSize))
+			return string(token)
+		}
+	}
+}
+
+// requestCSRFToken returns the CSRF token that forms must include in requests from the same browser
+func requestCSRFToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfContextKey).(string)
+	return token
+}
+
+// setCookie sets a cookie which is only sent to the application, cannot be read by scripts, and is
+// only sent over HTTPS if the application is served over HTTPS
+func (h *HTTPHandler) setCookie(w http.ResponseWriter, r *http.Request, cookie *http.Cookie) {
+	cookie.Path = "/"
+	cookie.HttpOnly = true
+	cookie.SameSite = http.SameSiteLaxMode
+	cookie.Secure = h.config.HTTP.SecureCookies || r.TLS != nil
+	http.SetCookie(w, cookie)
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mikestefanello/otcscanner/auth"
+	"github.com/mikestefanello/otcscanner/config"
+	"github.com/mikestefanello/otcscanner/repository"
+)
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func TestCSRF(t *testing.T) {
+	const cookie = "browser-cookie"
+	valid := auth.Sign("test-secret", csrfCookie+":"+cookie)
+
+	cfg := config.Config{}
+	cfg.App.Name = "Test"
+	cfg.App.Secret = "test-secret"
+	cfg.App.DevDir = "testdata"
+
+	h, err := NewHTTPHandler(cfg, repository.Repositories{Users: &fakeUsers{}}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	small := []byte("Package ID\nPKG1\n")
+	large := bytes.Repeat([]byte("PKG1234567890\n"), 2*csrfMultipartLimit/14)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		noCookie    bool
+		header      http.Header
+		form        url.Values
+		multipart   bool
+		tokenFirst  bool
+		file        []byte
+		token       string
+		wantStatus  int
+		wantMaxRead int
+	}{
+		{
+			name:       "get requests are not checked",
+			method:     http.MethodGet,
+			path:       "/orders",
+			noCookie:   true,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "form with a valid token",
+			method:     http.MethodPost,
+			path:       "/scan",
+			form:       url.Values{csrfField: {valid}, "packageId": {"PKG1"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "form without a token",
+			method:     http.MethodPost,
+			path:       "/scan",
+			form:       url.Values{"packageId": {"PKG1"}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "form with another browser's token",
+			method:     http.MethodPost,
+			path:       "/scan",
+			form:       url.Values{csrfField: {auth.Sign("test-secret", csrfCookie+":another-cookie")}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "form without a cookie",
+			method:     http.MethodPost,
+			path:       "/scan",
+			noCookie:   true,
+			form:       url.Values{csrfField: {valid}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "header with a valid token",
+			method:     http.MethodPost,
+			path:       "/api/scan",
+			header:     http.Header{csrfHeader: {valid}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "API request without a token",
+			method:     http.MethodPost,
+			path:       "/api/scan",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "API token requests are not checked",
+			method:     http.MethodPost,
+			path:       "/api/scan",
+			noCookie:   true,
+			header:     http.Header{"Authorization": {"Bearer otc_token"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "basic auth requests are checked",
+			method:     http.MethodPost,
+			path:       "/api/scan",
+			noCookie:   true,
+			header:     http.Header{"Authorization": {"Basic YWRhOnB3"}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "upload with the token before the file",
+			method:     http.MethodPost,
+			path:       "/database/upload",
+			multipart:  true,
+			tokenFirst: true,
+			file:       large,
+			token:      valid,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "upload with the token after a small file",
+			method:     http.MethodPost,
+			path:       "/database/upload",
+			multipart:  true,
+			file:       small,
+			token:      valid,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "upload with the token after a large file",
+			method:      http.MethodPost,
+			path:        "/database/upload",
+			multipart:   true,
+			file:        large,
+			token:       valid,
+			wantStatus:  http.StatusForbidden,
+			wantMaxRead: csrfMultipartLimit,
+		},
+		{
+			name:        "upload with an invalid token",
+			method:      http.MethodPost,
+			path:        "/database/upload",
+			multipart:   true,
+			tokenFirst:  true,
+			file:        large,
+			token:       "forged",
+			wantStatus:  http.StatusForbidden,
+			wantMaxRead: csrfMultipartLimit,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var body io.Reader
+			contentType := ""
+			switch {
+			case tc.multipart:
+				// The token is written before or after the file, since only tokens before large files
+				// can be checked without buffering the file
+				var buf bytes.Buffer
+				mw := multipart.NewWriter(&buf)
+				if tc.tokenFirst {
+					mw.WriteField(csrfField, tc.token)
+				}
+				fw, err := mw.CreateFormFile("file", "orders.csv")
+				if err != nil {
+					t.Fatal(err)
+				}
+				fw.Write(tc.file)
+				if !tc.tokenFirst {
+					mw.WriteField(csrfField, tc.token)
+				}
+				mw.Close()
+				contentType = mw.FormDataContentType()
+				body = &buf
+			case tc.form != nil:
+				contentType = "application/x-www-form-urlencoded"
+				body = strings.NewReader(tc.form.Encode())
+			}
+			counter := &countingReader{r: body}
+			if body == nil {
+				counter.r = strings.NewReader("")
+			}
+
+			var uploaded []byte
+			var packageID, token string
+			handler := h.CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				token = requestCSRFToken(r)
+				if tc.multipart {
+					file, _, err := r.FormFile("file")
+					if err != nil {
+						t.Fatalf("unable to read the uploaded file: %v", err)
+					}
+					uploaded, _ = io.ReadAll(file)
+					return
+				}
+				packageID = r.FormValue("packageId")
+			}))
+
+			r := httptest.NewRequest(tc.method, tc.path, counter)
+			if contentType != "" {
+				r.Header.Set("Content-Type", contentType)
+			}
+			for key, values := range tc.header {
+				for _, value := range values {
+					r.Header.Add(key, value)
+				}
+			}
+			if !tc.noCookie {
+				r.AddCookie(&http.Cookie{Name: csrfCookie, Value: cookie})
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d", tc.wantStatus, w.Code)
+			}
+
+			if tc.wantStatus != http.StatusOK {
+				if tc.wantMaxRead > 0 && counter.read > tc.wantMaxRead {
+					t.Errorf("expected at most %d bytes of the request to be read, got %d", tc.wantMaxRead, counter.read)
+				}
+				return
+			}
+
+			if tc.noCookie && !tc.multipart && tc.header == nil {
+				if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Name != csrfCookie || !cookies[0].HttpOnly {
+					t.Errorf("expected a CSRF cookie to be set, got %v", cookies)
+				}
+			} else if !tc.noCookie && token != valid {
+				t.Errorf("expected the request's token to be %s, got %s", valid, token)
+			}
+
+			if tc.multipart && !bytes.Equal(uploaded, tc.file) {
+				t.Errorf("expected the handler to read the whole file of %d bytes, got %d", len(tc.file), len(uploaded))
+			}
+			if tc.form != nil && packageID != tc.form.Get("packageId") {
+				t.Errorf("expected the handler to read the form, got package ID %q", packageID)
+			}
+		})
+	}
+}
@@ -1,16 +1,24 @@
 package handlers
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
-	"github.com/gocarina/gocsv"
+	"github.com/mikestefanello/otcscanner/auth"
+	"github.com/mikestefanello/otcscanner/export"
+	"github.com/mikestefanello/otcscanner/importer"
+	"github.com/mikestefanello/otcscanner/manifest"
+	"github.com/mikestefanello/otcscanner/metrics"
 	"github.com/mikestefanello/otcscanner/models"
-	"github.com/rs/zerolog/log"
+	"github.com/mikestefanello/otcscanner/purge"
+	"github.com/mikestefanello/otcscanner/repository"
+	"github.com/mikestefanello/otcscanner/scheduler"
+	"github.com/mikestefanello/otcscanner/watcher"
+	"github.com/mikestefanello/otcscanner/webhook"
 )
 
 type orderStats struct {
@@ -19,41 +27,102 @@ type orderStats struct {
 	Incomplete int64
 }
 
+type databasePage struct {
+	Stats           orderStats
+	ExportProfiles  []models.ExportProfile
+	ImportProfiles  []models.ImportProfile
+	ExportFormats   []string
+	Manifests       []string
+	ManifestFormats []manifestService
+	Watcher         watcher.Status
+	ScheduledExport scheduler.Status
+	DeleteAll       deleteConfirmation
+	DeleteCompleted deleteConfirmation
+}
+
+type manifestService struct {
+	Service string
+	Format  string
+}
+
+type deleteConfirmation struct {
+	ID               string
+	Phrase           string
+	ApprovalRequired bool
+}
+
 // DatabasePage handles get requests for the database route
 func (h *HTTPHandler) DatabasePage(w http.ResponseWriter, r *http.Request) {
 	page := Page{
 		Title: "Database",
 	}
 
-	stats, err := h.getOrderStats()
+	stats, err := h.getOrderStats(r)
 	if err != nil {
 		page.AddMessage("danger", "Unable to communicate with the database.")
-	} else {
-		page.Content = stats
 	}
 
-	h.Render(w, "database", page)
+	exportProfiles, err := h.exportProfiles.LoadAll()
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to load export profiles from the database.")
+		page.AddMessage("warning", "Unable to load export profiles.")
+	}
+
+	importProfiles, err := h.importProfiles.LoadAll()
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to load import profiles from the database.")
+		page.AddMessage("warning", "Unable to load import profiles.")
+	}
+
+	manifests, err := h.repo.LoadManifests(r.Context())
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to load manifests from the database.")
+		page.AddMessage("warning", "Unable to load manifests.")
+	}
+
+	page.Content = databasePage{
+		Stats:           stats,
+		ExportProfiles:  exportProfiles,
+		ImportProfiles:  importProfiles,
+		ExportFormats:   export.FormatNames(),
+		Manifests:       manifests,
+		ManifestFormats: h.manifestServices(),
+		Watcher:         h.watcher.Status(),
+		ScheduledExport: h.scheduler.Status(),
+		DeleteAll: deleteConfirmation{
+			ID:               "all",
+			Phrase:           deleteConfirmationPhrase(stats.All),
+			ApprovalRequired: h.approvalRequired(),
+		},
+		DeleteCompleted: deleteConfirmation{
+			ID:               "complete",
+			Phrase:           deleteConfirmationPhrase(stats.Completed),
+			ApprovalRequired: h.approvalRequired(),
+		},
+	}
+
+	h.Render(w, r, "database", page)
 }
 
 // getOrderStats gets order stats from the database
-func (h *HTTPHandler) getOrderStats() (orderStats, error) {
+func (h *HTTPHandler) getOrderStats(r *http.Request) (orderStats, error) {
 	var stats orderStats
 
-	all, err := h.repo.CountAll()
+	all, err := h.repo.CountAll(r.Context())
 	if err != nil {
-		log.Error().Err(err).Msg("Unable to get count of all orders from the database.")
+		requestLog(r).Error().Err(err).Msg("Unable to get count of all orders from the database.")
 		return stats, err
 	}
 
-	completed, err := h.repo.CountCompleted()
+	completed, err := h.repo.CountCompleted(r.Context())
 	if err != nil {
-		log.Error().Err(err).Msg("Unable to get count of all completed orders from the database.")
+		requestLog(r).Error().Err(err).Msg("Unable to get count of all completed orders from the database.")
 		return stats, err
 	}
 
-	incomplete, err := h.repo.CountIncomplete()
+	incomplete, err := h.repo.CountIncomplete(r.Context())
 	if err != nil {
-		log.Error().Err(err).Msg("Unable to get count of all incomplete orders from the database.")
+		requestLog(r).Error().Err(err).Msg("Unable to get count of all incomplete orders from the database.")
 		return stats, err
 	}
 
@@ -64,22 +133,35 @@ func (h *HTTPHandler) getOrderStats() (orderStats, error) {
 	return stats, nil
 }
 
-// DatabaseUpload handles post requests to upload a CSV of orders to the database
+// DatabaseUpload handles post requests to upload a CSV, XLSX or JSON Lines file of orders to the database
 func (h *HTTPHandler) DatabaseUpload(w http.ResponseWriter, r *http.Request) {
 	page := Page{
 		Title: "Database",
 	}
 
-	added, err := h.processDatabaseUpload(r)
+	result, err := h.processDatabaseUpload(r)
 
 	if err != nil {
-		page.AddMessage("danger", err.Error())
+		for _, msg := range errorMessages(err) {
+			page.AddMessage("danger", msg)
+		}
 	} else {
-		log.Info().Int("count", added).Msg("Uploaded orders to the database.")
-		page.AddMessage("success", fmt.Sprintf("Added %d orders to the database.", added))
+		requestLog(r).Info().Int("count", result.Added).Str("profile", result.Profile).Msg("Uploaded orders to the database.")
+		page.AddMessage("success", fmt.Sprintf("Added %d orders to the database.", result.Added))
+		if result.Skipped > 0 {
+			page.AddMessage("info", fmt.Sprintf("Skipped %d orders which are already in the database.", result.Skipped))
+		}
 	}
 
-	h.Render(w, "text", page)
+	if result.Profile != "" {
+		page.AddMessage("info", fmt.Sprintf("Columns were mapped using the import profile \"%s\".", result.Profile))
+	}
+
+	if len(result.Unmatched) > 0 {
+		page.AddMessage("warning", fmt.Sprintf("These columns were not imported: %s", strings.Join(result.Unmatched, ", ")))
+	}
+
+	h.Render(w, r, "text", page)
 }
 
 // DatabaseDeleteAll handles post requests to delete the entire order database
@@ -88,17 +170,15 @@ func (h *HTTPHandler) DatabaseDeleteAll(w http.ResponseWriter, r *http.Request)
 		Title: "Database",
 	}
 
-	err := h.repo.DeleteAll()
+	deleted, err := h.processDelete(r, purge.OperationAll)
 
 	if err != nil {
-		log.Error().Err(err).Msg("Unable to delete entire database.")
-		page.AddMessage("danger", "Unable to delete entire database.")
+		page.AddMessage("danger", err.Error())
 	} else {
-		log.Info().Msg("Deleted all orders from the database.")
-		page.AddMessage("success", "Database deleted.")
+		page.AddMessage("success", fmt.Sprintf("Database deleted. Removed %d orders.", deleted))
 	}
 
-	h.Render(w, "text", page)
+	h.Render(w, r, "text", page)
 }
 
 // DatabaseDeleteCompleted handles post requests to delete completed orders from the database
@@ -107,129 +187,360 @@ func (h *HTTPHandler) DatabaseDeleteCompleted(w http.ResponseWriter, r *http.Req
 		Title: "Database",
 	}
 
-	err := h.repo.DeleteCompleted()
+	deleted, err := h.processDelete(r, purge.OperationCompleted)
+
+	if err != nil {
+		page.AddMessage("danger", err.Error())
+	} else {
+		page.AddMessage("success", fmt.Sprintf("Completed orders have been deleted. Removed %d orders.", deleted))
+	}
+
+	h.Render(w, r, "text", page)
+}
+
+// DatabaseCloseManifest handles post requests to close a manifest containing all completed orders
+// which are not already in a manifest. Orders in a closed manifest can only be edited with supervisor approval
+func (h *HTTPHandler) DatabaseCloseManifest(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Database",
+	}
+
+	manifest := time.Now().Format("20060102-150405")
+	count, err := h.repo.CloseManifest(r.Context(), manifest)
 
 	if err != nil {
-		log.Error().Err(err).Msg("Unable to delete completed orders from database.")
-		page.AddMessage("danger", "Unable to delete completed orders.")
+		requestLog(r).Error().Err(err).Msg("Unable to close manifest.")
+		page.AddMessage("danger", "Unable to close manifest.")
 	} else {
-		log.Info().Msg("Deleted completed orders from the database.")
-		page.AddMessage("success", "Completed orders have been deleted.")
+		requestLog(r).Info().Str("manifest", manifest).Int64("count", count).Msg("Closed manifest.")
+		page.AddMessage("success", fmt.Sprintf("Closed manifest %s with %d orders.", manifest, count))
+	}
+
+	h.Render(w, r, "text", page)
+}
+
+// DatabaseDownloadManifest handles post requests to download a closed manifest's orders for a given service
+// in the file format that the service's carrier accepts
+func (h *HTTPHandler) DatabaseDownloadManifest(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Database",
+	}
+
+	err := h.serveManifest(w, r, r.FormValue("manifest"), r.FormValue("service"))
+
+	if err != nil {
+		for _, msg := range errorMessages(err) {
+			page.AddMessage("danger", msg)
+		}
+		h.Render(w, r, "text", page)
+		return
+	}
+}
+
+// serveManifest streams the orders in a given closed manifest for a given service as a carrier manifest file.
+// As with serveOrders, an error is only returned if nothing has been written yet
+func (h *HTTPHandler) serveManifest(w http.ResponseWriter, r *http.Request, id, service string) error {
+	if id == "" {
+		return inputError{errors.New("A manifest is required")}
+	}
+
+	formatName, ok := h.config.Manifest.Formats[service]
+	if !ok {
+		return inputError{fmt.Errorf("No manifest format is configured for service: %s", service)}
+	}
+
+	f, ok := manifest.GetFormat(formatName)
+	if !ok {
+		return inputError{fmt.Errorf("Unsupported manifest format: %s", formatName)}
+	}
+
+	// Start iterating the orders
+	it, err := h.repo.IterateByQuery(r.Context(), models.OrderQuery{
+		Status:   models.OrderStatusCompleted,
+		Service:  service,
+		Manifest: id,
+	})
+
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to load orders from the database.")
+		return errors.New("Unable to load orders")
+	}
+	defer it.Close()
+
+	filename := fmt.Sprintf("manifest-%s-%s.%s", id, service, f.Extension)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Type", f.ContentType)
+
+	header := manifest.Header{
+		ID:         id,
+		Service:    service,
+		SenderID:   h.config.Manifest.SenderID,
+		ReceiverID: service,
+		Created:    time.Now(),
+	}
+
+	fw := newFlushWriter(w)
+	count, err := export.WriteAll(f.NewWriter(fw, header), it)
+
+	if err != nil {
+		requestLog(r).Error().Err(err).Str("filename", filename).Int("count", count).Msg("Unable to stream manifest.")
+		return fw.abort(errors.New("Unable to load orders"))
+	}
+
+	requestLog(r).Info().
+		Str("manifest", id).
+		Str("service", service).
+		Str("format", f.Name).
+		Int("count", count).
+		Msg("Exported carrier manifest.")
+
+	return nil
+}
+
+// manifestServices returns the services that carrier manifests can be downloaded for, sorted by service
+func (h *HTTPHandler) manifestServices() []manifestService {
+	services := make([]manifestService, 0, len(h.config.Manifest.Formats))
+	for service, format := range h.config.Manifest.Formats {
+		services = append(services, manifestService{
+			Service: service,
+			Format:  format,
+		})
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Service < services[j].Service
+	})
+
+	return services
+}
+
+// processDelete verifies that a delete operation has been confirmed, and approved if required, before
+// executing it. The confirmation phrase includes the number of affected orders so a stale or forged
+// form submission will not match. The number of orders actually deleted is returned
+func (h *HTTPHandler) processDelete(r *http.Request, operation string) (int64, error) {
+	deleted, err := h.purger.Purge(r.Context(), purge.Request{
+		Operation:        operation,
+		Reason:           r.FormValue("reason"),
+		Actor:            requestActor(r),
+		Approver:         r.FormValue("supervisor_user"),
+		ApproverPassword: r.FormValue("supervisor_password"),
+		Log:              requestLog(r),
+		Confirm: func(count int64) error {
+			expected := deleteConfirmationPhrase(count)
+			if strings.TrimSpace(r.FormValue("confirmation")) != expected {
+				return fmt.Errorf("Confirmation did not match. Type \"%s\" to proceed", expected)
+			}
+			return nil
+		},
+	})
+
+	var dbErr purge.DatabaseError
+	if errors.As(err, &dbErr) {
+		requestLog(r).Error().Err(dbErr.Err).Str("operation", operation).Msg(dbErr.Op + ".")
+		return 0, errors.New("Unable to communicate with the database")
+	}
+
+	return deleted, err
+}
+
+// approvalRequired determines if destructive operations require supervisor approval
+func (h *HTTPHandler) approvalRequired() bool {
+	return h.purger.ApprovalRequired()
+}
+
+// approvalAvailable determines if anyone can approve changes to orders in closed manifests, which the
+// configured supervisor and users with the supervisor role can
+func (h *HTTPHandler) approvalAvailable(r *http.Request) bool {
+	if h.approvalRequired() {
+		return true
 	}
 
-	h.Render(w, "text", page)
+	count, err := h.users.Count()
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to count users.")
+	}
+	return count > 0
+}
+
+// verifySupervisor checks the given credentials against those of the configured supervisor and of
+// the users with the supervisor role or a more privileged one. Users cannot approve their own requests
+func (h *HTTPHandler) verifySupervisor(r *http.Request, user, password string) bool {
+	ok, err := auth.VerifySupervisor(h.config.Supervisor, h.users, requestActor(r), user, password)
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to load user from the database.")
+	}
+	return ok
+}
+
+// deleteConfirmationPhrase returns the phrase that must be typed to confirm deleting a given number of orders
+func deleteConfirmationPhrase(count int64) string {
+	return fmt.Sprintf("DELETE %d ORDERS", count)
 }
 
-// DatabaseDownloadAll handles post requests to download the entire database as a CSV file
+// DatabaseDownloadAll handles post requests to download the entire database as a file
 func (h *HTTPHandler) DatabaseDownloadAll(w http.ResponseWriter, r *http.Request) {
 	page := Page{
 		Title: "Database",
 	}
 
-	// Load all orders
-	err := h.serveOrdersCsv(w, r, "all.csv", h.repo.LoadAll)
+	// Stream the orders
+	err := h.serveOrders(w, r, "all", r.FormValue("format"), export.DefaultColumns(), models.OrderQuery{Status: models.OrderStatusAll})
 
 	if err != nil {
-		page.AddMessage("danger", err.Error())
-		h.Render(w, "text", page)
+		for _, msg := range errorMessages(err) {
+			page.AddMessage("danger", msg)
+		}
+		h.Render(w, r, "text", page)
 		return
 	}
 }
 
-// DatabaseDownloadCompleted handles post requests to download completed orders from the database as a CSV file
+// DatabaseDownloadCompleted handles post requests to download completed orders from the database as a file
 func (h *HTTPHandler) DatabaseDownloadCompleted(w http.ResponseWriter, r *http.Request) {
 	page := Page{
 		Title: "Database",
 	}
 
-	// Load all orders
-	err := h.serveOrdersCsv(w, r, "completed.csv", h.repo.LoadCompleted)
+	// Stream the orders
+	err := h.serveOrders(w, r, "completed", r.FormValue("format"), export.DefaultColumns(), models.OrderQuery{Status: models.OrderStatusCompleted})
 
 	if err != nil {
-		page.AddMessage("danger", err.Error())
-		h.Render(w, "text", page)
+		for _, msg := range errorMessages(err) {
+			page.AddMessage("danger", msg)
+		}
+		h.Render(w, r, "text", page)
 		return
 	}
 }
 
-// DatabaseDownloadIncomplete handles post requests to download incomplete orders from the database as a CSV file
+// DatabaseDownloadIncomplete handles post requests to download incomplete orders from the database as a file
 func (h *HTTPHandler) DatabaseDownloadIncomplete(w http.ResponseWriter, r *http.Request) {
 	page := Page{
 		Title: "Database",
 	}
 
-	// Load all orders
-	err := h.serveOrdersCsv(w, r, "incomplete.csv", h.repo.LoadIncomplete)
+	// Stream the orders
+	err := h.serveOrders(w, r, "incomplete", r.FormValue("format"), export.DefaultColumns(), models.OrderQuery{Status: models.OrderStatusIncomplete})
 
 	if err != nil {
-		page.AddMessage("danger", err.Error())
-		h.Render(w, "text", page)
+		for _, msg := range errorMessages(err) {
+			page.AddMessage("danger", msg)
+		}
+		h.Render(w, r, "text", page)
 		return
 	}
 }
 
-// serveOrdersCsv gets data from a loader function and serves a CSV file with the data returned
-func (h *HTTPHandler) serveOrdersCsv(w http.ResponseWriter, r *http.Request, filename string, loader func() (*models.Orders, error)) error {
-	// Load all orders
-	orders, err := loader()
+// serveOrders streams the orders matching a given query as a file in a given format. Orders are written
+// to the response as they are loaded from the database so memory use does not grow with the number of orders.
+// An error is only returned if nothing has been written yet; later failures abort the response so the
+// client does not mistake a truncated file for a complete one
+func (h *HTTPHandler) serveOrders(w http.ResponseWriter, r *http.Request, name, format string, columns []models.ExportColumn, query models.OrderQuery) error {
+	if format == "" {
+		format = export.DefaultFormat
+	}
+
+	f, ok := export.GetFormat(format)
+	if !ok {
+		return inputError{fmt.Errorf("Unsupported export format: %s", format)}
+	}
+
+	// Start iterating the orders
+	it, err := h.repo.IterateByQuery(r.Context(), query)
 
 	if err != nil {
-		log.Error().Err(err).Msg("Unable to load orders from the database.")
+		requestLog(r).Error().Err(err).Msg("Unable to load orders from the database.")
 		return errors.New("Unable to load orders")
 	}
+	defer it.Close()
 
-	csv, err := gocsv.MarshalString(orders)
+	filename := fmt.Sprintf("%s.%s", name, f.Name)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Type", f.ContentType)
+
+	start := time.Now()
+	fw := newFlushWriter(w)
+	count, err := export.WriteAll(f.NewWriter(fw, columns), it)
 
 	if err != nil {
-		log.Error().Err(err).Msg("Unable to encode orders as CSV.")
-		return errors.New("Unable to process orders for export")
+		requestLog(r).Error().Err(err).Str("filename", filename).Int("count", count).Msg("Unable to stream orders for export.")
+		return fw.abort(errors.New("Unable to load orders"))
 	}
 
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-	w.Header().Set("Content-Type", "text/csv")
-	http.ServeContent(w, r, filename, time.Now(), bytes.NewReader([]byte(csv)))
+	metrics.ObserveExport(metrics.ExportDownload, f.Name, time.Since(start))
+
+	requestLog(r).Info().
+		Str("filename", filename).
+		Int("count", count).
+		Dur("duration", time.Since(start)).
+		Msg("Exported orders.")
+
 	return nil
 }
 
-// processDatabaseUpload processes CSV uploads and inserts records in to the database
-func (h *HTTPHandler) processDatabaseUpload(r *http.Request) (int, error) {
+// processDatabaseUpload processes CSV, XLSX and JSON Lines uploads and inserts records in to the database
+func (h *HTTPHandler) processDatabaseUpload(r *http.Request) (importer.Result, error) {
 	r.ParseMultipartForm(10 << 20)
 
 	// Get the uploaded file
-	file, _, err := r.FormFile("upload")
+	file, header, err := r.FormFile("upload")
 	if err != nil {
-		log.Error().Err(err).Msg("Unable to load database upload file.")
-		return 0, errors.New("Error reading the file")
+		requestLog(r).Error().Err(err).Msg("Unable to load database upload file.")
+		return importer.Result{}, errors.New("Error reading the file")
 	}
 	defer file.Close()
 
-	// Read the entire file
-	fileBytes, err := ioutil.ReadAll(file)
-	if err != nil {
-		log.Error().Err(err).Msg("Unable to read database upload file.")
-		return 0, errors.New("Error processing the file")
+	opts := importer.Options{
+		Format: importer.FormatFromFilename(header.Filename),
+		Sheet:  strings.TrimSpace(r.FormValue("sheet")),
 	}
 
-	// Parse in to orders
-	orders := &models.Orders{}
-	gocsv.UnmarshalString(string(fileBytes), orders)
-
-	// Validate the orders
-	for _, order := range *orders {
-		err = h.validator.Struct(order)
+	// Allow the format to be specified for files without a recognized extension
+	if format := r.FormValue("format"); format != "" {
+		opts.Format = format
+	}
 
+	// Determine the import profile; an empty value detects it and a dash uses the standard columns
+	switch name := r.FormValue("profile"); name {
+	case "":
+		opts.Profiles, err = h.importProfiles.LoadAll()
 		if err != nil {
-			return 0, err
+			requestLog(r).Error().Err(err).Msg("Unable to load import profiles from the database.")
+			return importer.Result{}, errDatabase
+		}
+	case importProfileStandard:
+	default:
+		opts.Profile, err = h.importProfiles.LoadByName(name)
+		if err != nil {
+			if err == repository.ErrNotFound {
+				return importer.Result{}, fmt.Errorf("Import profile not found: %s", name)
+			}
+			requestLog(r).Error().Err(err).Msg("Unable to load import profile from the database.")
+			return importer.Result{}, errDatabase
 		}
 	}
 
-	// Save the orders
-	err = h.repo.InsertMany(orders)
+	// Read, validate and save the orders
+	result, err := h.importer.Import(r.Context(), file, opts)
 
 	if err != nil {
-		log.Error().Err(err).Msg("Unable to save orders to database.")
-		return 0, errors.New("Unable to add items to the database")
+		if _, ok := err.(importer.SaveError); ok {
+			requestLog(r).Error().Err(err).Int("added", result.Added).Msg("Unable to save orders to database.")
+			if result.Added > 0 {
+				return result, fmt.Errorf("Unable to add items to the database. %d orders were added before the failure; upload the file again to add the rest", result.Added)
+			}
+			return result, errors.New("Unable to add items to the database")
+		}
+		return result, err
 	}
 
-	return len(*orders), nil
+	h.hooks.Trigger(models.WebhookEventOrdersImported, webhook.ImportEvent{
+		Source:   webhook.ImportSourceUpload,
+		Filename: header.Filename,
+		Count:    result.Added,
+		Profile:  result.Profile,
+		Actor:    requestActor(r),
+	})
+
+	return result, nil
 }
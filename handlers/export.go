@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/mikestefanello/otcscanner/export"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+)
+
+type exportProfilePage struct {
+	// Name is the name of the profile being edited, which is empty for new profiles
+	Name    string
+	Profile models.ExportProfile
+	Columns []exportProfileColumn
+}
+
+type exportProfileColumn struct {
+	Key           string
+	DefaultHeader string
+	Header        string
+	Include       bool
+	Position      int
+}
+
+// DatabaseExport handles post requests to download filtered orders as a file
+func (h *HTTPHandler) DatabaseExport(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Database",
+	}
+
+	r.ParseForm()
+	err := h.serveExport(w, r, r.Form)
+
+	if err != nil {
+		for _, msg := range errorMessages(err) {
+			page.AddMessage("danger", msg)
+		}
+		h.Render(w, r, "text", page)
+	}
+}
+
+// serveExport serves a file of the orders matching the filters in given request values.
+// Columns are taken from the export profile named in the values, from a comma-separated list of
+// column keys, or default to all columns
+func (h *HTTPHandler) serveExport(w http.ResponseWriter, r *http.Request, v url.Values) error {
+	// Build the query without pagination
+	query := parseOrderQuery(v)
+	query.Page = 0
+	query.PerPage = 0
+
+	// Determine the columns
+	filename := "orders"
+	columns := export.DefaultColumns()
+
+	if name := v.Get("profile"); name != "" {
+		profile, err := h.exportProfiles.LoadByName(name)
+		if err != nil {
+			if err == repository.ErrNotFound {
+				return inputError{fmt.Errorf("Export profile not found: %s", name)}
+			}
+			requestLog(r).Error().Err(err).Msg("Unable to load export profile from the database.")
+			return errDatabase
+		}
+		columns = profile.Columns
+		filename = profile.Name
+	} else if keys := v.Get("columns"); keys != "" {
+		columns = make([]models.ExportColumn, 0)
+		defaults := exportColumnHeaders()
+		for _, key := range strings.Split(keys, ",") {
+			key = strings.TrimSpace(key)
+			columns = append(columns, models.ExportColumn{
+				Key:    key,
+				Header: defaults[key],
+			})
+		}
+	}
+
+	err := export.ValidateColumns(columns)
+	if err != nil {
+		return inputError{err}
+	}
+
+	if query.Status != models.OrderStatusAll {
+		filename = fmt.Sprintf("%s-%s", filename, query.Status)
+	}
+
+	return h.serveOrders(w, r, filename, v.Get("format"), columns, query)
+}
+
+// ExportProfilesPage handles get requests to list the export profiles
+func (h *HTTPHandler) ExportProfilesPage(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Export profiles",
+	}
+
+	profiles, err := h.exportProfiles.LoadAll()
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to load export profiles from the database.")
+		page.AddMessage("danger", "Unable to communicate with the database.")
+	}
+
+	page.Content = profiles
+	h.Render(w, r, "export_profiles", page)
+}
+
+// ExportProfileForm handles both get and post requests on the export profile form, which is used to
+// create new profiles and edit existing ones
+func (h *HTTPHandler) ExportProfileForm(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Export profile",
+	}
+
+	content := exportProfilePage{
+		Name: chi.URLParam(r, "name"),
+	}
+
+	// Load the existing profile
+	if content.Name != "" {
+		profile, err := h.exportProfiles.LoadByName(content.Name)
+		if err != nil {
+			if err == repository.ErrNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				page.AddMessage("danger", "Export profile not found.")
+			} else {
+				requestLog(r).Error().Err(err).Msg("Unable to load export profile from the database.")
+				page.AddMessage("danger", "Unable to communicate with the database.")
+			}
+			h.Render(w, r, "text", page)
+			return
+		}
+		content.Profile = *profile
+	}
+
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		content.Profile = parseExportProfileForm(r.PostForm)
+
+		err := h.saveExportProfile(r, content.Name, &content.Profile)
+		if err != nil {
+			for _, msg := range errorMessages(err) {
+				page.AddMessage("danger", msg)
+			}
+		} else {
+			page.AddMessage("success", "Export profile saved.")
+			content.Name = content.Profile.Name
+		}
+	}
+
+	content.Columns = exportProfileColumns(content.Profile)
+	page.Content = content
+	h.Render(w, r, "export_profile", page)
+}
+
+// ExportProfileDelete handles post requests to delete an export profile
+func (h *HTTPHandler) ExportProfileDelete(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Export profiles",
+	}
+
+	name := chi.URLParam(r, "name")
+	err := h.exportProfiles.Delete(name)
+
+	if err != nil && err != repository.ErrNotFound {
+		requestLog(r).Error().Err(err).Msg("Unable to delete export profile.")
+		page.AddMessage("danger", "Unable to delete export profile.")
+	} else {
+		requestLog(r).Info().Str("name", name).Msg("Deleted export profile.")
+		page.AddMessage("success", "Export profile deleted.")
+	}
+
+	h.Render(w, r, "text", page)
+}
+
+// saveExportProfile validates and saves an export profile. If the profile was renamed, the profile
+// stored under its previous name is removed
+func (h *HTTPHandler) saveExportProfile(r *http.Request, previousName string, profile *models.ExportProfile) error {
+	profile.Name = strings.TrimSpace(profile.Name)
+
+	if profile.Name == profileNameNew {
+		return inputError{errors.New("This profile name is reserved")}
+	}
+
+	err := h.validator.Struct(profile)
+	if err != nil {
+		return err
+	}
+
+	err = export.ValidateColumns(profile.Columns)
+	if err != nil {
+		return inputError{err}
+	}
+
+	// Prevent renaming a profile over another one
+	if profile.Name != previousName {
+		_, err = h.exportProfiles.LoadByName(profile.Name)
+		if err == nil {
+			return inputError{errors.New("An export profile with this name already exists")}
+		} else if err != repository.ErrNotFound {
+			requestLog(r).Error().Err(err).Msg("Unable to load export profile from the database.")
+			return errDatabase
+		}
+	}
+
+	err = h.exportProfiles.Save(profile)
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to save export profile.")
+		return errors.New("Unable to save export profile")
+	}
+
+	if previousName != "" && previousName != profile.Name {
+		err = h.exportProfiles.Delete(previousName)
+		if err != nil && err != repository.ErrNotFound {
+			requestLog(r).Error().Err(err).Msg("Unable to delete renamed export profile.")
+		}
+	}
+
+	requestLog(r).Info().Str("name", profile.Name).Int("columns", len(profile.Columns)).Msg("Saved export profile.")
+
+	return nil
+}
+
+// parseExportProfileForm builds an export profile from the column chooser form. Included columns are
+// ordered by their position, and those without one are placed at the end in their default order
+func parseExportProfileForm(v url.Values) models.ExportProfile {
+	profile := models.ExportProfile{
+		Name:    v.Get("name"),
+		Columns: make([]models.ExportColumn, 0),
+	}
+
+	type positioned struct {
+		column   models.ExportColumn
+		position int
+	}
+	included := make([]positioned, 0)
+
+	for _, col := range export.DefaultColumns() {
+		if v.Get("include_"+col.Key) != "on" {
+			continue
+		}
+
+		header := strings.TrimSpace(v.Get("header_" + col.Key))
+		if header != "" {
+			col.Header = header
+		}
+
+		position, err := strconv.Atoi(v.Get("position_" + col.Key))
+		if err != nil || position < 1 {
+			position = math.MaxInt32
+		}
+
+		included = append(included, positioned{column: col, position: position})
+	}
+
+	sort.SliceStable(included, func(i, j int) bool {
+		return included[i].position < included[j].position
+	})
+
+	for _, p := range included {
+		profile.Columns = append(profile.Columns, p.column)
+	}
+
+	return profile
+}
+
+// exportProfileColumns builds the column chooser rows for a given profile, with the profile's columns
+// first, in order, followed by the remaining columns
+func exportProfileColumns(profile models.ExportProfile) []exportProfileColumn {
+	defaults := exportColumnHeaders()
+	columns := make([]exportProfileColumn, 0, len(defaults))
+	included := make(map[string]bool)
+
+	for i, col := range profile.Columns {
+		included[col.Key] = true
+		columns = append(columns, exportProfileColumn{
+			Key:           col.Key,
+			DefaultHeader: defaults[col.Key],
+			Header:        col.Header,
+			Include:       true,
+			Position:      i + 1,
+		})
+	}
+
+	for _, col := range export.DefaultColumns() {
+		if included[col.Key] {
+			continue
+		}
+		columns = append(columns, exportProfileColumn{
+			Key:           col.Key,
+			DefaultHeader: col.Header,
+			Header:        col.Header,
+		})
+	}
+
+	return columns
+}
+
+// exportColumnHeaders returns the default export headers keyed by column key
+func exportColumnHeaders() map[string]string {
+	headers := make(map[string]string)
+	for _, col := range export.DefaultColumns() {
+		headers[col.Key] = col.Header
+	}
+	return headers
+}
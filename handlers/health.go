@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/mikestefanello/otcscanner/version"
+)
+
+type healthStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Healthz handles get requests to check that the application is running
+func (h *HTTPHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, healthStatus{
+		Status: "ok",
+	})
+}
+
+// Readyz handles get requests to check that the application can serve requests, which requires the
+// database to be reachable
+func (h *HTTPHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	err := h.repo.Ping(r.Context())
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Readiness check failed to reach the database.")
+		writeJSON(w, http.StatusServiceUnavailable, healthStatus{
+			Status: "unavailable",
+			Error:  "Unable to communicate with the database",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, healthStatus{
+		Status: "ok",
+	})
+}
+
+// Version handles get requests for the build information of the application
+func (h *HTTPHandler) Version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, version.Get())
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/mikestefanello/otcscanner/importer"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+)
+
+// importProfileStandard is the upload form value which imports using the standard column headers
+const importProfileStandard = "-"
+
+// profileNameNew is the name in the URL of the forms which create profiles, so no profile can use it
+const profileNameNew = "new"
+
+type importProfilePage struct {
+	// Name is the name of the profile being edited, which is empty for new profiles
+	Name       string
+	Profile    models.ImportProfile
+	Fields     []importProfileField
+	Transforms []string
+}
+
+type importProfileField struct {
+	Key           string
+	DefaultHeader string
+	Headers       string
+	Separator     string
+	Value         string
+	Transform     string
+}
+
+// ImportProfilesPage handles get requests to list the import profiles
+func (h *HTTPHandler) ImportProfilesPage(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Import profiles",
+	}
+
+	profiles, err := h.importProfiles.LoadAll()
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to load import profiles from the database.")
+		page.AddMessage("danger", "Unable to communicate with the database.")
+	}
+
+	page.Content = profiles
+	h.Render(w, r, "import_profiles", page)
+}
+
+// ImportProfileForm handles both get and post requests on the import profile form, which is used to
+// create new profiles and edit existing ones
+func (h *HTTPHandler) ImportProfileForm(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Import profile",
+	}
+
+	content := importProfilePage{
+		Name:       chi.URLParam(r, "name"),
+		Transforms: models.ImportTransforms,
+	}
+
+	// Load the existing profile
+	if content.Name != "" {
+		profile, err := h.importProfiles.LoadByName(content.Name)
+		if err != nil {
+			if err == repository.ErrNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				page.AddMessage("danger", "Import profile not found.")
+			} else {
+				requestLog(r).Error().Err(err).Msg("Unable to load import profile from the database.")
+				page.AddMessage("danger", "Unable to communicate with the database.")
+			}
+			h.Render(w, r, "text", page)
+			return
+		}
+		content.Profile = *profile
+	}
+
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		content.Profile = parseImportProfileForm(r.PostForm)
+
+		err := h.saveImportProfile(r, content.Name, &content.Profile)
+		if err != nil {
+			for _, msg := range errorMessages(err) {
+				page.AddMessage("danger", msg)
+			}
+		} else {
+			page.AddMessage("success", "Import profile saved.")
+			content.Name = content.Profile.Name
+		}
+	}
+
+	content.Fields = importProfileFields(content.Profile)
+	page.Content = content
+	h.Render(w, r, "import_profile", page)
+}
+
+// ImportProfileDelete handles post requests to delete an import profile
+func (h *HTTPHandler) ImportProfileDelete(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Import profiles",
+	}
+
+	name := chi.URLParam(r, "name")
+	err := h.importProfiles.Delete(name)
+
+	if err != nil && err != repository.ErrNotFound {
+		requestLog(r).Error().Err(err).Msg("Unable to delete import profile.")
+		page.AddMessage("danger", "Unable to delete import profile.")
+	} else {
+		requestLog(r).Info().Str("name", name).Msg("Deleted import profile.")
+		page.AddMessage("success", "Import profile deleted.")
+	}
+
+	h.Render(w, r, "text", page)
+}
+
+// saveImportProfile validates and saves an import profile. If the profile was renamed, the profile
+// stored under its previous name is removed
+func (h *HTTPHandler) saveImportProfile(r *http.Request, previousName string, profile *models.ImportProfile) error {
+	profile.Name = strings.TrimSpace(profile.Name)
+
+	if profile.Name == importProfileStandard || profile.Name == profileNameNew {
+		return inputError{errors.New("This profile name is reserved")}
+	}
+
+	err := h.validator.Struct(profile)
+	if err != nil {
+		return err
+	}
+
+	err = importer.ValidateProfile(profile)
+	if err != nil {
+		return inputError{err}
+	}
+
+	// Prevent renaming a profile over another one
+	if profile.Name != previousName {
+		_, err = h.importProfiles.LoadByName(profile.Name)
+		if err == nil {
+			return inputError{errors.New("An import profile with this name already exists")}
+		} else if err != repository.ErrNotFound {
+			requestLog(r).Error().Err(err).Msg("Unable to load import profile from the database.")
+			return errDatabase
+		}
+	}
+
+	err = h.importProfiles.Save(profile)
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to save import profile.")
+		return errors.New("Unable to save import profile")
+	}
+
+	if previousName != "" && previousName != profile.Name {
+		err = h.importProfiles.Delete(previousName)
+		if err != nil && err != repository.ErrNotFound {
+			requestLog(r).Error().Err(err).Msg("Unable to delete renamed import profile.")
+		}
+	}
+
+	requestLog(r).Info().Str("name", profile.Name).Int("mappings", len(profile.Mappings)).Msg("Saved import profile.")
+
+	return nil
+}
+
+// parseImportProfileForm builds an import profile from the mapping form. Only fields with source
+// columns or a fixed value are mapped
+func parseImportProfileForm(v url.Values) models.ImportProfile {
+	profile := models.ImportProfile{
+		Name:     v.Get("name"),
+		Mappings: make([]models.ImportMapping, 0),
+	}
+
+	for _, col := range models.OrderColumns() {
+		m := models.ImportMapping{
+			Key:       col.Key,
+			Separator: v.Get("separator_" + col.Key),
+			Value:     strings.TrimSpace(v.Get("value_" + col.Key)),
+			Transform: v.Get("transform_" + col.Key),
+		}
+
+		for _, header := range strings.Split(v.Get("headers_"+col.Key), ",") {
+			if header = strings.TrimSpace(header); header != "" {
+				m.Headers = append(m.Headers, header)
+			}
+		}
+
+		if len(m.Headers) > 0 || m.Value != "" {
+			profile.Mappings = append(profile.Mappings, m)
+		}
+	}
+
+	return profile
+}
+
+// importProfileFields builds the mapping form rows for every order column of a given profile
+func importProfileFields(profile models.ImportProfile) []importProfileField {
+	mappings := make(map[string]models.ImportMapping)
+	for _, m := range profile.Mappings {
+		mappings[m.Key] = m
+	}
+
+	columns := models.OrderColumns()
+	fields := make([]importProfileField, 0, len(columns))
+
+	for _, col := range columns {
+		m := mappings[col.Key]
+		fields = append(fields, importProfileField{
+			Key:           col.Key,
+			DefaultHeader: col.Header,
+			Headers:       strings.Join(m.Headers, ", "),
+			Separator:     m.Separator,
+			Value:         m.Value,
+			Transform:     m.Transform,
+		})
+	}
+
+	return fields
+}
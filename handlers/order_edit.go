@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+)
+
+var (
+	// errOrderClosed indicates an order cannot be edited because it is in a closed manifest
+	errOrderClosed = errors.New("This order is in a closed manifest and can only be edited with supervisor approval")
+
+	// errOrderExists indicates an order's package ID cannot be changed because another order already uses it
+	errOrderExists = errors.New("An order with this package ID already exists")
+
+	// errDatabase indicates the database could not be reached
+	errDatabase = errors.New("Unable to communicate with the database")
+)
+
+// inputError indicates that a request failed because of invalid input
+type inputError struct {
+	error
+}
+
+// orderEdit describes a requested change to an order
+type orderEdit struct {
+	// Fields contains the new field values, keyed by column key. Omitted fields are not changed
+	Fields             map[string]string `json:"fields"`
+	Reason             string            `json:"reason"`
+	SupervisorUser     string            `json:"supervisorUser"`
+	SupervisorPassword string            `json:"supervisorPassword"`
+}
+
+type orderEditPage struct {
+	Order            *models.Order
+	Fields           []orderEditField
+	Reason           string
+	ApprovalRequired bool
+	ApprovalEnabled  bool
+}
+
+type orderEditField struct {
+	Key   string
+	Label string
+	Value string
+}
+
+// OrderEditForm handles both get and post requests on the order edit form route
+func (h *HTTPHandler) OrderEditForm(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Edit order",
+	}
+
+	order, err := h.repo.LoadByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			page.AddMessage("danger", "Order not found.")
+		} else {
+			requestLog(r).Error().Err(err).Msg("Unable to load order from database.")
+			page.AddMessage("danger", "Unable to communicate with the database.")
+		}
+		h.Render(w, r, "text", page)
+		return
+	}
+
+	content := orderEditPage{
+		Order:            order,
+		ApprovalRequired: order.IsClosed(),
+		ApprovalEnabled:  h.approvalAvailable(r),
+	}
+
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+
+		// Build the edit from the submitted fields
+		edit := orderEdit{
+			Fields:             make(map[string]string),
+			Reason:             r.FormValue("reason"),
+			SupervisorUser:     r.FormValue("supervisor_user"),
+			SupervisorPassword: r.FormValue("supervisor_password"),
+		}
+
+		for _, col := range models.OrderColumns() {
+			if _, ok := r.PostForm[col.Key]; ok {
+				edit.Fields[col.Key] = r.PostForm.Get(col.Key)
+			}
+		}
+
+		updated, changes, err := h.updateOrder(r, order, edit)
+		if err != nil {
+			for _, msg := range errorMessages(err) {
+				page.AddMessage("danger", msg)
+			}
+
+			// Show the submitted values so they can be corrected
+			submitted := *order
+			for key, value := range edit.Fields {
+				submitted.Set(key, value)
+			}
+			content.Reason = edit.Reason
+			content.Fields = orderEditFields(&submitted)
+			page.Content = content
+			h.Render(w, r, "order_edit", page)
+			return
+		}
+
+		if len(changes) == 0 {
+			page.AddMessage("info", "No changes were made.")
+		} else {
+			page.AddMessage("success", fmt.Sprintf("Order updated. Changed %d fields.", len(changes)))
+		}
+		content.Order = updated
+	}
+
+	content.Fields = orderEditFields(content.Order)
+	page.Content = content
+	h.Render(w, r, "order_edit", page)
+}
+
+// updateOrder applies an edit to a given order, validates and saves it, and records the change in the audit log
+func (h *HTTPHandler) updateOrder(r *http.Request, order *models.Order, edit orderEdit) (*models.Order, []models.FieldChange, error) {
+	// Orders in a closed manifest require supervisor approval
+	approver := ""
+	if order.IsClosed() {
+		if !h.verifySupervisor(r, edit.SupervisorUser, edit.SupervisorPassword) {
+			requestLog(r).Warn().Str("id", order.PackageID).Str("approver", edit.SupervisorUser).Msg("Supervisor approval failed for order edit.")
+			return nil, nil, errOrderClosed
+		}
+		approver = edit.SupervisorUser
+	}
+
+	// A reason must be provided
+	reason := strings.TrimSpace(edit.Reason)
+	if reason == "" {
+		return nil, nil, inputError{errors.New("A reason is required to edit an order")}
+	}
+
+	// Apply the changes to a copy of the order
+	updated := *order
+	for key, value := range edit.Fields {
+		if !updated.Set(key, strings.TrimSpace(value)) {
+			return nil, nil, inputError{fmt.Errorf("Unknown field: %s", key)}
+		}
+	}
+	updated.PackageID = strings.ToUpper(updated.PackageID)
+
+	// Recalculate the DIM, in the unit system the order was scanned in, and validate
+	err := updated.CalculateDim()
+	if err != nil {
+		return nil, nil, inputError{err}
+	}
+
+	err = h.validator.Struct(updated)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Determine what changed
+	changes := make([]models.FieldChange, 0)
+	for _, col := range models.OrderColumns() {
+		from, _ := order.Get(col.Key)
+		to, _ := updated.Get(col.Key)
+		if from != to {
+			changes = append(changes, models.FieldChange{
+				Field: col.Key,
+				From:  from,
+				To:    to,
+			})
+		}
+	}
+
+	if len(changes) == 0 {
+		return order, changes, nil
+	}
+
+	// Make sure a changed package ID is not already in use
+	if updated.PackageID != order.PackageID {
+		_, err = h.repo.LoadByID(r.Context(), updated.PackageID)
+		if err == nil {
+			return nil, nil, inputError{errOrderExists}
+		} else if err != repository.ErrNotFound {
+			requestLog(r).Error().Err(err).Msg("Unable to load order from database.")
+			return nil, nil, errDatabase
+		}
+	}
+
+	// Save the order. The package ID is unique, so a rename that races with another order using the
+	// same ID fails here
+	err = h.repo.UpdateByID(r.Context(), order.PackageID, &updated)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, nil, err
+		}
+		if err == repository.ErrDuplicate {
+			return nil, nil, inputError{errOrderExists}
+		}
+		requestLog(r).Error().Err(err).Str("id", order.PackageID).Msg("Unable to update order in database from edit.")
+		return nil, nil, errors.New("Unable to save order in the database")
+	}
+
+	// Record the change
+	entry := &models.AuditEntry{
+		PackageID: updated.PackageID,
+		Action:    "edit",
+		Actor:     requestActor(r),
+		Approver:  approver,
+		Reason:    reason,
+		Changes:   changes,
+		Time:      time.Now(),
+	}
+	if updated.PackageID != order.PackageID {
+		entry.PreviousPackageID = order.PackageID
+	}
+
+	err = h.audit.InsertOne(entry)
+	if err != nil {
+		requestLog(r).Error().Err(err).Interface("entry", entry).Msg("Unable to save audit entry for order edit.")
+	}
+
+	requestLog(r).Info().
+		Str("id", order.PackageID).
+		Str("approver", approver).
+		Int("changes", len(changes)).
+		Msg("Order edited.")
+
+	return &updated, changes, nil
+}
+
+// orderEditFields builds the form fields for every column of a given order
+func orderEditFields(order *models.Order) []orderEditField {
+	columns := models.OrderColumns()
+	fields := make([]orderEditField, 0, len(columns))
+
+	for _, col := range columns {
+		value, _ := order.Get(col.Key)
+		fields = append(fields, orderEditField{
+			Key:   col.Key,
+			Label: col.Header,
+			Value: value,
+		})
+	}
+
+	return fields
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+)
+
+const (
+	ordersPerPageDefault = 50
+	ordersPerPageMax     = 200
+)
+
+type ordersPage struct {
+	Query   models.OrderQuery
+	Orders  models.Orders
+	Total   int64
+	Pages   int
+	Columns []orderSortColumn
+	PrevURL string
+	NextURL string
+}
+
+type orderSortColumn struct {
+	Label  string
+	URL    string
+	Active bool
+	Desc   bool
+}
+
+type orderPage struct {
+	Order  *models.Order
+	Fields []orderField
+	Audit  []models.AuditEntry
+}
+
+type orderField struct {
+	Label string
+	Value string
+}
+
+// orderListColumns contains the sortable columns shown in the order list, keyed by column key
+var orderListColumns = []struct {
+	Key   string
+	Label string
+}{
+	{"packageId", "Package ID"},
+	{"recipientLastName", "Recipient"},
+	{"recipientCity", "City"},
+	{"country", "Country"},
+	{"service", "Service"},
+	{"account", "Account"},
+	{"date", "Date"},
+	{"weight", "Weight"},
+}
+
+// OrdersPage handles get requests to search and browse orders
+func (h *HTTPHandler) OrdersPage(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Orders",
+	}
+
+	query := parseOrderQuery(r.URL.Query())
+	content := ordersPage{
+		Query: query,
+	}
+
+	// Load the matching orders
+	total, err := h.repo.CountByQuery(r.Context(), query)
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to count orders matching query.")
+		page.AddMessage("danger", "Unable to communicate with the database.")
+		page.Content = content
+		h.Render(w, r, "orders", page)
+		return
+	}
+
+	orders, err := h.repo.LoadByQuery(r.Context(), query)
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to load orders matching query.")
+		page.AddMessage("danger", "Unable to communicate with the database.")
+		page.Content = content
+		h.Render(w, r, "orders", page)
+		return
+	}
+
+	content.Orders = *orders
+	content.Total = total
+	content.Pages = int((total + int64(query.PerPage) - 1) / int64(query.PerPage))
+
+	// Build the sortable column headers
+	for _, col := range orderListColumns {
+		sortQuery := query
+		sortQuery.Sort = col.Key
+		sortQuery.Page = 1
+		active := query.Sort == col.Key || (query.Sort == "" && col.Key == "packageId")
+		sortQuery.Desc = active && !query.Desc
+
+		content.Columns = append(content.Columns, orderSortColumn{
+			Label:  col.Label,
+			URL:    ordersURL(sortQuery),
+			Active: active,
+			Desc:   active && query.Desc,
+		})
+	}
+
+	// Build the pagination links
+	if query.Page > 1 {
+		prev := query
+		prev.Page--
+		content.PrevURL = ordersURL(prev)
+	}
+
+	if query.Page < content.Pages {
+		next := query
+		next.Page++
+		content.NextURL = ordersURL(next)
+	}
+
+	page.Content = content
+	h.Render(w, r, "orders", page)
+}
+
+// OrderPage handles get requests to view a single order
+func (h *HTTPHandler) OrderPage(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Order",
+	}
+
+	order, err := h.repo.LoadByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			page.AddMessage("danger", "Order not found.")
+		} else {
+			requestLog(r).Error().Err(err).Msg("Unable to load order from database.")
+			page.AddMessage("danger", "Unable to communicate with the database.")
+		}
+		h.Render(w, r, "text", page)
+		return
+	}
+
+	content := orderPage{
+		Order: order,
+	}
+
+	for _, col := range models.OrderColumns() {
+		value, _ := order.Get(col.Key)
+		content.Fields = append(content.Fields, orderField{
+			Label: col.Header,
+			Value: value,
+		})
+	}
+
+	content.Audit, err = h.orderHistory(order.PackageID)
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to load order audit log from database.")
+		page.AddMessage("warning", "Unable to load the order history.")
+	}
+
+	page.Title = order.PackageID
+	page.Content = content
+	h.Render(w, r, "order", page)
+}
+
+// orderHistory loads the audit entries of the order with a given package ID, newest first. If the
+// order's package ID was changed, the entries recorded under its previous IDs are included, up to the
+// time it was renamed
+func (h *HTTPHandler) orderHistory(id string) ([]models.AuditEntry, error) {
+	history := []models.AuditEntry{}
+	seen := make(map[string]bool)
+	var renamed time.Time
+
+	for id != "" && !seen[id] {
+		seen[id] = true
+
+		entries, err := h.audit.LoadByPackageID(id)
+		if err != nil {
+			return history, err
+		}
+
+		id = ""
+		for _, entry := range entries {
+			if !renamed.IsZero() && !entry.Time.Before(renamed) {
+				continue
+			}
+			history = append(history, entry)
+
+			if id == "" && entry.PreviousPackageID != "" {
+				id, renamed = entry.PreviousPackageID, entry.Time
+			}
+		}
+	}
+
+	return history, nil
+}
+
+// parseOrderQuery parses an order query from given request values
+func parseOrderQuery(v url.Values) models.OrderQuery {
+	q := models.OrderQuery{
+		Search:   strings.TrimSpace(v.Get("search")),
+		Status:   v.Get("status"),
+		Service:  v.Get("service"),
+		Account:  v.Get("account"),
+		Country:  strings.TrimSpace(v.Get("country")),
+		DateFrom: strings.TrimSpace(v.Get("date_from")),
+		DateTo:   strings.TrimSpace(v.Get("date_to")),
+		Desc:     v.Get("desc") == "1",
+	}
+
+	if models.IsSortable(v.Get("sort")) {
+		q.Sort = v.Get("sort")
+	}
+
+	if q.Status != models.OrderStatusCompleted && q.Status != models.OrderStatusIncomplete {
+		q.Status = models.OrderStatusAll
+	}
+
+	q.Page, _ = strconv.Atoi(v.Get("page"))
+	if q.Page < 1 {
+		q.Page = 1
+	}
+
+	q.PerPage, _ = strconv.Atoi(v.Get("per_page"))
+	if q.PerPage < 1 {
+		q.PerPage = ordersPerPageDefault
+	} else if q.PerPage > ordersPerPageMax {
+		q.PerPage = ordersPerPageMax
+	}
+
+	return q
+}
+
+// ordersURL builds the URL of the orders page for a given query
+func ordersURL(q models.OrderQuery) string {
+	v := url.Values{}
+
+	set := func(key, value string) {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+
+	set("search", q.Search)
+	set("status", q.Status)
+	set("service", q.Service)
+	set("account", q.Account)
+	set("country", q.Country)
+	set("date_from", q.DateFrom)
+	set("date_to", q.DateTo)
+	set("sort", q.Sort)
+
+	if q.Desc {
+		v.Set("desc", "1")
+	}
+
+	if q.Page > 1 {
+		v.Set("page", strconv.Itoa(q.Page))
+	}
+
+	if q.PerPage != ordersPerPageDefault {
+		v.Set("per_page", strconv.Itoa(q.PerPage))
+	}
+
+	if len(v) == 0 {
+		return "/orders"
+	}
+
+	return "/orders?" + v.Encode()
+}
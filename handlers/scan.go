@@ -4,71 +4,111 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
+
+	"github.com/mikestefanello/otcscanner/auth"
+	"github.com/mikestefanello/otcscanner/metrics"
 	"github.com/mikestefanello/otcscanner/models"
 	"github.com/mikestefanello/otcscanner/repository"
-	"github.com/rs/zerolog/log"
+	"github.com/mikestefanello/otcscanner/webhook"
 )
 
 const cookieNamePreviousScan = "previous_scan"
 
+// errScanNotMatched indicates that a scan's barcode does not match an order
+var errScanNotMatched = errors.New("Unable to match barcode to order")
+
+type scanPage struct {
+	Scan models.Scan
+
+	// Station is the station selected by the device, if any
+	Station *models.Station
+}
+
 // ScanForm handles both get and post requests on the scan form route
+// Once stations have been created, each device must select one, which defaults the form with its last
+// scan. Without a station, the form is defaulted from the previous scan stored in a cookie
 func (h *HTTPHandler) ScanForm(w http.ResponseWriter, r *http.Request) {
 	page := Page{
-		Title:   "Scan",
-		Content: models.Scan{},
+		Title: "Scan",
+	}
+
+	station, err := h.requestStation(r)
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to load station from the database.")
+		page.AddMessage("danger", "Unable to load the station of this device.")
+	}
+	content := scanPage{
+		Station: station,
 	}
 
 	if r.Method == http.MethodPost {
 		// Process the scan
-		scan, err := h.processScan(r)
+		start := time.Now()
+		scan, err := h.processScan(r, station)
+		metrics.ObserveScan(scan.Service, scan.Account, scanOutcome(err), time.Since(start))
 		if err != nil {
-			if _, ok := err.(validator.ValidationErrors); ok {
-				for _, valErr := range err.(validator.ValidationErrors) {
-					page.AddMessage("danger", fmt.Sprintf("%s failed validation: %s", valErr.Field(), valErr.Tag()))
-				}
-			} else {
-				page.AddMessage("danger", err.Error())
+			for _, msg := range errorMessages(err) {
+				page.AddMessage("danger", msg)
 			}
-
 		} else {
 			page.AddMessage("success", "Scan processed successfully.")
 		}
 
-		// Set the scan in a cookie so the values default the form
-		h.setPreviousScanCookie(w, scan)
+		// Store the scan so the values default the form
+		if station != nil {
+			err = h.stations.SaveLastScan(station.Name, scan)
+			if err != nil && err != repository.ErrNotFound {
+				requestLog(r).Error().Err(err).Msg("Unable to save the last scan of the station.")
+			}
+		} else {
+			h.setPreviousScanCookie(w, r, scan)
+		}
 
 		// Pass the scan to the page
-		page.Content = scan
+		content.Scan = scan
+	} else if station != nil {
+		content.Scan = station.DefaultScan()
 	} else {
+		// Devices must select a station once any have been created
+		stations, err := h.stations.LoadAll()
+		if err != nil {
+			requestLog(r).Error().Err(err).Msg("Unable to load stations from the database.")
+		} else if len(stations) > 0 {
+			http.Redirect(w, r, "/station", http.StatusSeeOther)
+			return
+		}
+
 		scan, err := h.getPreviousScanFromCookie(r)
 		if err == nil {
-			page.Content = scan
+			content.Scan = scan
 		}
 	}
 
-	h.Render(w, "scan", page)
+	page.Content = content
+	h.Render(w, r, "scan", page)
 }
 
-// setPreviousScanCookie encodes a scan in to a cookie and sets it in the response
-func (h *HTTPHandler) setPreviousScanCookie(w http.ResponseWriter, scan models.Scan) error {
+// setPreviousScanCookie encodes a scan in to a cookie and sets it in the response. The cookie is signed
+// so it cannot be tampered with
+func (h *HTTPHandler) setPreviousScanCookie(w http.ResponseWriter, r *http.Request, scan models.Scan) error {
 	json, err := json.Marshal(scan)
 
 	if err != nil {
-		log.Error().Err(err).Msg("Unable to encode scan as JSON for cookie.")
+		requestLog(r).Error().Err(err).Msg("Unable to encode scan as JSON for cookie.")
 		return err
 	}
 
 	encoded := base64.StdEncoding.EncodeToString(json)
 	c := http.Cookie{
 		Name:  cookieNamePreviousScan,
-		Value: encoded,
+		Value: encoded + "." + auth.Sign(h.secret, cookieNamePreviousScan+":"+encoded),
 	}
-	http.SetCookie(w, &c)
+	h.setCookie(w, r, &c)
 
 	return nil
 }
@@ -82,23 +122,30 @@ func (h *HTTPHandler) getPreviousScanFromCookie(r *http.Request) (models.Scan, e
 		return scan, err
 	}
 
-	decoded, err := base64.StdEncoding.DecodeString(cookie.Value)
+	encoded, signature, _ := strings.Cut(cookie.Value, ".")
+	if !auth.Verify(h.secret, cookieNamePreviousScan+":"+encoded, signature) {
+		requestLog(r).Warn().Msg("Ignoring scan cookie with an invalid signature.")
+		return scan, errors.New("Invalid scan cookie signature")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
-		log.Error().Err(err).Msg("Unable to decode base64 scan cookie.")
+		requestLog(r).Error().Err(err).Msg("Unable to decode base64 scan cookie.")
 		return scan, err
 	}
 
 	err = json.Unmarshal(decoded, &scan)
 	if err != nil {
-		log.Error().Err(err).Msg("Unable to decode json scan cookie.")
+		requestLog(r).Error().Err(err).Msg("Unable to decode json scan cookie.")
 		return scan, err
 	}
 
 	return scan, nil
 }
 
-// processScan processes scan input and attempts to update a matching order in the database
-func (h *HTTPHandler) processScan(r *http.Request) (models.Scan, error) {
+// processScan processes scan input and attempts to update a matching order in the database. Scans made
+// at a station record the station and its weight unit on the order
+func (h *HTTPHandler) processScan(r *http.Request, station *models.Station) (models.Scan, error) {
 	// Build a scan model from the form values
 	var s = models.Scan{
 		Barcode: strings.ToUpper(r.FormValue("barcode")),
@@ -117,6 +164,10 @@ func (h *HTTPHandler) processScan(r *http.Request) (models.Scan, error) {
 		s.CreateNew = true
 	}
 
+	if station != nil {
+		s.Station = station.Name
+	}
+
 	// Validate the input
 	err := h.validator.Struct(s)
 	if err != nil {
@@ -125,17 +176,17 @@ func (h *HTTPHandler) processScan(r *http.Request) (models.Scan, error) {
 
 	// Load an order with the given barcode
 	exists := true
-	order, err := h.repo.LoadByID(s.Barcode)
+	order, err := h.repo.LoadByID(r.Context(), s.Barcode)
 	if err != nil {
 		if err == repository.ErrNotFound {
 			if !s.CreateNew {
-				return s, errors.New("Unable to match barcode to order")
+				return s, errScanNotMatched
 			}
 			// Initialize a new order
 			order = &models.Order{}
 			exists = false
 		} else {
-			log.Error().Err(err).Msg("Unable to load order from database.")
+			requestLog(r).Error().Err(err).Msg("Unable to load order from database.")
 			return s, errors.New("Unable to communicate with database")
 		}
 	}
@@ -150,19 +201,56 @@ func (h *HTTPHandler) processScan(r *http.Request) (models.Scan, error) {
 	order.Date = s.Date
 	order.Service = s.Service
 	order.Account = s.Account
+	order.ScannedBy = requestActor(r)
+
+	// Scans made without a station are in imperial units. The imported weight unit is left alone, as
+	// it is the unit of the imported package weight
+	order.Station = ""
+	order.UnitSystem = models.UnitSystemImperial
+	if station != nil {
+		order.Station = station.Name
+		order.UnitSystem = station.UnitSystem
+	}
 	order.CalculateDim()
 
 	// Save the order
 	if exists {
-		err = h.repo.UpdateOne(order)
+		err = h.repo.UpdateOne(r.Context(), order)
 	} else {
-		err = h.repo.InsertOne(order)
+		err = h.repo.InsertOne(r.Context(), order)
 	}
 
 	if err != nil {
-		log.Error().Err(err).Msg("Unable to update order in database from scan.")
+		requestLog(r).Error().Err(err).Msg("Unable to update order in database from scan.")
 		return s, errors.New("Unable to save order in the database")
 	}
 
+	requestLog(r).Info().Str("id", order.PackageID).Str("station", s.Station).Bool("new", !exists).Msg("Scanned order.")
+
+	// Notify webhook subscribers
+	event := webhook.OrderEvent{
+		Order: order,
+		Actor: requestActor(r),
+	}
+	if !exists {
+		h.hooks.Trigger(models.WebhookEventOrderCreated, event)
+	}
+	h.hooks.Trigger(models.WebhookEventScanCompleted, event)
+
 	return s, nil
 }
+
+// scanOutcome returns the outcome of processing a scan that returned a given error, for metrics
+func scanOutcome(err error) string {
+	switch err.(type) {
+	case nil:
+		return metrics.ScanSuccess
+	case validator.ValidationErrors:
+		return metrics.ScanInvalid
+	}
+
+	if err == errScanNotMatched {
+		return metrics.ScanNotFound
+	}
+	return metrics.ScanError
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// staticMaxAge is how long browsers may use a static file before checking whether it has changed
+const staticMaxAge = 24 * time.Hour
+
+// Static handles get requests for static files, such as CSS and JavaScript
+// Browsers may cache files for a day and then check them using an ETag computed from their contents,
+// so a new version is picked up without files being downloaded again on every page. In dev mode files
+// are read from disk, so browsers must check them on every request
+func (h *HTTPHandler) Static(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "*")
+
+	if h.devMode {
+		info, err := fs.Stat(h.static, name)
+		if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		etag, ok := h.staticETags[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(staticMaxAge.Seconds())))
+		w.Header().Set("ETag", etag)
+	}
+
+	file, err := h.static.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, "Static file cannot be served", http.StatusInternalServerError)
+		return
+	}
+
+	// Serve the content, which also responds to conditional requests using the ETag
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// staticETags computes an ETag for every static file from a hash of its contents
+func staticETags(static fs.FS) (map[string]string, error) {
+	etags := make(map[string]string)
+
+	err := fs.WalkDir(static, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		data, err := fs.ReadFile(static, name)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(data)
+		etags[name] = fmt.Sprintf(`"%x"`, sum[:8])
+		return nil
+	})
+
+	return etags, err
+}
+
+// libVersions is the file listing the third party files in the lib directory and their pinned hashes
+const libVersions = "lib/VERSIONS"
+
+// libIntegrity returns the subresource integrity hashes pinned in lib/VERSIONS for the third party files
+// in the lib directory, keyed by file name, so pages only use files which match them. An error is
+// returned if any file is missing, has not been pinned or does not match its hash, since pages cannot
+// be used without them
+func libIntegrity(static fs.FS) (map[string]string, error) {
+	in, err := static.Open(libVersions)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	hashes := make(map[string]string)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("Invalid line in %s: %s", libVersions, line)
+		}
+		name, pinned := fields[0], fields[2]
+
+		data, err := fs.ReadFile(static, path.Join("lib", name))
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("%s is missing from the lib directory: %s", name, err.Error())
+		case pinned == "-":
+			return nil, fmt.Errorf("%s is not pinned in %s. Its hash is %s", name, libVersions, sriHash(data))
+		case sriHash(data) != pinned:
+			return nil, fmt.Errorf("%s does not match its hash in %s: got %s, want %s", name, libVersions, sriHash(data), pinned)
+		}
+
+		hashes[name] = pinned
+	}
+
+	return hashes, scanner.Err()
+}
+
+// sriHash returns the hash of a file in the format used by subresource integrity attributes
+func sriHash(data []byte) string {
+	sum := sha512.Sum384(data)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
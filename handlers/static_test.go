@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLibIntegrity(t *testing.T) {
+	css, js := []byte("body{}"), []byte("alert(1)")
+
+	tests := []struct {
+		name     string
+		versions string
+		files    map[string][]byte
+		want     map[string]string
+		wantErr  bool
+	}{
+		{
+			name:     "pinned files",
+			versions: "# comment\n\na.css https://example.com/a.css " + sriHash(css) + "\nb.js https://example.com/b.js " + sriHash(js) + "\n",
+			files:    map[string][]byte{"a.css": css, "b.js": js},
+			want:     map[string]string{"a.css": sriHash(css), "b.js": sriHash(js)},
+		},
+		{
+			name:     "unpinned file",
+			versions: "a.css https://example.com/a.css -\n",
+			files:    map[string][]byte{"a.css": css},
+			wantErr:  true,
+		},
+		{
+			name:     "missing file",
+			versions: "a.css https://example.com/a.css " + sriHash(css) + "\nb.js https://example.com/b.js " + sriHash(js) + "\n",
+			files:    map[string][]byte{"a.css": css},
+			wantErr:  true,
+		},
+		{
+			name:     "mismatched file",
+			versions: "a.css https://example.com/a.css " + sriHash(css) + "\n",
+			files:    map[string][]byte{"a.css": js},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid line",
+			versions: "a.css " + sriHash(css) + "\n",
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fsys := fstest.MapFS{libVersions: {Data: []byte(tc.versions)}}
+			for name, data := range tc.files {
+				fsys["lib/"+name] = &fstest.MapFile{Data: data}
+			}
+
+			got, err := libIntegrity(fsys)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
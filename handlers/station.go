@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/mikestefanello/otcscanner/auth"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+)
+
+const cookieNameStation = "station"
+
+// stationCookieMaxAge is how long a device keeps its station, which is renewed whenever it is selected
+const stationCookieMaxAge = 365 * 24 * time.Hour
+
+type stationPage struct {
+	// Name is the name of the station being edited, which is empty for new stations
+	Name        string
+	Station     models.Station
+	Services    []string
+	Accounts    []string
+	UnitSystems []string
+}
+
+type stationSelectPage struct {
+	Stations []models.Station
+	Current  string
+}
+
+// StationsPage handles get requests to list the stations
+func (h *HTTPHandler) StationsPage(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Stations",
+	}
+
+	stations, err := h.stations.LoadAll()
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to load stations from the database.")
+		page.AddMessage("danger", "Unable to communicate with the database.")
+	}
+
+	page.Content = stations
+	h.Render(w, r, "stations", page)
+}
+
+// StationForm handles both get and post requests on the station form, which is used to register new
+// stations and edit existing ones. Stations provided by the configuration cannot be changed
+func (h *HTTPHandler) StationForm(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Station",
+	}
+
+	content := stationPage{
+		Name: chi.URLParam(r, "name"),
+		Station: models.Station{
+			UnitSystem: models.UnitSystemImperial,
+		},
+		Services:    models.ScanServices,
+		Accounts:    models.ScanAccounts,
+		UnitSystems: models.UnitSystems,
+	}
+
+	// Load the existing station
+	if content.Name != "" {
+		station, err := h.stations.LoadByName(content.Name)
+		if err != nil {
+			if err == repository.ErrNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				page.AddMessage("danger", "Station not found.")
+			} else {
+				requestLog(r).Error().Err(err).Msg("Unable to load station from the database.")
+				page.AddMessage("danger", "Unable to communicate with the database.")
+			}
+			h.Render(w, r, "text", page)
+			return
+		}
+		content.Station = *station
+	}
+
+	if r.Method == http.MethodPost {
+		if content.Station.Configured {
+			page.AddMessage("danger", "This station is provided by the configuration, so it cannot be changed here.")
+		} else {
+			r.ParseForm()
+			lastScan := content.Station.LastScan
+			content.Station = parseStationForm(r.PostForm)
+			content.Station.LastScan = lastScan
+
+			err := h.saveStation(r, content.Name, &content.Station)
+			if err != nil {
+				for _, msg := range errorMessages(err) {
+					page.AddMessage("danger", msg)
+				}
+			} else {
+				page.AddMessage("success", "Station saved.")
+				content.Name = content.Station.Name
+			}
+		}
+	}
+
+	page.Content = content
+	h.Render(w, r, "station", page)
+}
+
+// StationDelete handles post requests to delete a station. Devices that selected the station must
+// select another one
+func (h *HTTPHandler) StationDelete(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Stations",
+	}
+
+	name := chi.URLParam(r, "name")
+	station, err := h.stations.LoadByName(name)
+
+	switch {
+	case err == repository.ErrNotFound:
+		page.AddMessage("success", "Station deleted.")
+	case err != nil:
+		requestLog(r).Error().Err(err).Msg("Unable to load station from the database.")
+		page.AddMessage("danger", "Unable to communicate with the database.")
+	case station.Configured:
+		page.AddMessage("danger", "This station is provided by the configuration, so it cannot be deleted here.")
+	default:
+		err = h.stations.Delete(name)
+		if err != nil && err != repository.ErrNotFound {
+			requestLog(r).Error().Err(err).Msg("Unable to delete station.")
+			page.AddMessage("danger", "Unable to delete station.")
+		} else {
+			requestLog(r).Info().Str("name", name).Msg("Deleted station.")
+			page.AddMessage("success", "Station deleted.")
+		}
+	}
+
+	h.Render(w, r, "text", page)
+}
+
+// StationSelect handles both get and post requests on the station selection form, which is used to
+// choose the station of the device making the request. The station is remembered in a cookie, so it
+// only needs to be selected once per device
+func (h *HTTPHandler) StationSelect(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Select station",
+	}
+
+	if r.Method == http.MethodPost {
+		name := r.FormValue("station")
+		station, err := h.stations.LoadByName(name)
+		switch {
+		case err == repository.ErrNotFound:
+			page.AddMessage("danger", "Please select a station.")
+		case err != nil:
+			requestLog(r).Error().Err(err).Msg("Unable to load station from the database.")
+			page.AddMessage("danger", "Unable to communicate with the database.")
+		default:
+			h.setStationCookie(w, r, station.Name)
+			requestLog(r).Info().Str("station", station.Name).Msg("Selected station.")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+	}
+
+	content := stationSelectPage{}
+
+	current, err := h.requestStation(r)
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to load station from the database.")
+	} else if current != nil {
+		content.Current = current.Name
+	}
+
+	content.Stations, err = h.stations.LoadAll()
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to load stations from the database.")
+		page.AddMessage("danger", "Unable to communicate with the database.")
+	}
+
+	page.Content = content
+	h.Render(w, r, "station_select", page)
+}
+
+// requestStation loads the station selected by the device making a given request, which is nil if no
+// station has been selected or the selected station no longer exists
+func (h *HTTPHandler) requestStation(r *http.Request) (*models.Station, error) {
+	cookie, err := r.Cookie(cookieNameStation)
+	if err != nil {
+		return nil, nil
+	}
+
+	encoded, signature, _ := strings.Cut(cookie.Value, ".")
+	if !auth.Verify(h.secret, cookieNameStation+":"+encoded, signature) {
+		requestLog(r).Warn().Msg("Ignoring station cookie with an invalid signature.")
+		return nil, nil
+	}
+
+	name, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil
+	}
+
+	station, err := h.stations.LoadByName(string(name))
+	if err == repository.ErrNotFound {
+		return nil, nil
+	}
+
+	return station, err
+}
+
+// setStationCookie sets a cookie which selects a given station for the device making a request. The
+// cookie is signed so it cannot be tampered with
+func (h *HTTPHandler) setStationCookie(w http.ResponseWriter, r *http.Request, name string) {
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(name))
+	c := http.Cookie{
+		Name:   cookieNameStation,
+		Value:  encoded + "." + auth.Sign(h.secret, cookieNameStation+":"+encoded),
+		MaxAge: int(stationCookieMaxAge.Seconds()),
+	}
+	h.setCookie(w, r, &c)
+}
+
+// saveStation validates and saves a station. If the station was renamed, the station stored under its
+// previous name is removed, so devices that selected it must select it again
+func (h *HTTPHandler) saveStation(r *http.Request, previousName string, station *models.Station) error {
+	err := h.validator.Struct(station)
+	if err != nil {
+		return err
+	}
+
+	// Prevent renaming a station over another one
+	if station.Name != previousName {
+		_, err = h.stations.LoadByName(station.Name)
+		if err == nil {
+			return inputError{errors.New("A station with this name already exists")}
+		} else if err != repository.ErrNotFound {
+			requestLog(r).Error().Err(err).Msg("Unable to load station from the database.")
+			return errDatabase
+		}
+	}
+
+	err = h.stations.Save(station)
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to save station.")
+		return errors.New("Unable to save station")
+	}
+
+	if previousName != "" && previousName != station.Name {
+		err = h.stations.Delete(previousName)
+		if err != nil && err != repository.ErrNotFound {
+			requestLog(r).Error().Err(err).Msg("Unable to delete renamed station.")
+		}
+	}
+
+	requestLog(r).Info().Str("name", station.Name).Msg("Saved station.")
+
+	return nil
+}
+
+// parseStationForm builds a station from the form, without its last scan
+func parseStationForm(v url.Values) models.Station {
+	return models.Station{
+		Name:       strings.TrimSpace(v.Get("name")),
+		Service:    v.Get("service"),
+		Account:    v.Get("account"),
+		UnitSystem: v.Get("unit_system"),
+		Scale:      strings.TrimSpace(v.Get("scale")),
+		Printer:    strings.TrimSpace(v.Get("printer")),
+	}
+}
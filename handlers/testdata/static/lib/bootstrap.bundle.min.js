@@ -0,0 +1 @@
+/* Stands in for the Bootstrap bundle in tests */
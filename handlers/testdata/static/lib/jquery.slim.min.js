@@ -0,0 +1 @@
+/* Stands in for jQuery in tests */
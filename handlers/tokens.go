@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/mikestefanello/otcscanner/auth"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+)
+
+type apiTokensPage struct {
+	Tokens []models.APIToken
+	Scopes []string
+
+	// Created is the token that was just created, which is only shown once
+	Created string
+}
+
+// APITokensPage handles get requests to list the API tokens, and post requests to create a token
+func (h *HTTPHandler) APITokensPage(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "API tokens",
+	}
+
+	content := apiTokensPage{
+		Scopes: models.TokenScopes,
+	}
+
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		token, err := h.createAPIToken(r, r.PostForm.Get("name"), r.PostForm["scopes"])
+		if err != nil {
+			for _, msg := range errorMessages(err) {
+				page.AddMessage("danger", msg)
+			}
+		} else {
+			page.AddMessage("success", "API token created. Copy it now, as it will not be shown again.")
+			content.Created = token
+		}
+	}
+
+	var err error
+	content.Tokens, err = h.apiTokens.LoadAll()
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to load API tokens from the database.")
+		page.AddMessage("danger", "Unable to communicate with the database.")
+	}
+
+	page.Content = content
+	h.Render(w, r, "tokens", page)
+}
+
+// APITokenRevoke handles post requests to revoke an API token
+func (h *HTTPHandler) APITokenRevoke(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "API tokens",
+	}
+
+	id := chi.URLParam(r, "id")
+	err := h.apiTokens.Delete(id)
+
+	switch {
+	case err == repository.ErrNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		page.AddMessage("danger", "API token not found.")
+	case err != nil:
+		requestLog(r).Error().Err(err).Msg("Unable to revoke API token.")
+		page.AddMessage("danger", "Unable to revoke API token.")
+	default:
+		requestLog(r).Info().Str("token", id).Msg("Revoked API token.")
+		page.AddMessage("success", "API token revoked.")
+	}
+
+	h.Render(w, r, "text", page)
+}
+
+// createAPIToken validates and stores a new API token, and returns the token
+func (h *HTTPHandler) createAPIToken(r *http.Request, name string, scopes []string) (string, error) {
+	token, err := auth.NewAPIToken()
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to generate API token.")
+		return "", errors.New("Unable to create API token")
+	}
+
+	t := &models.APIToken{
+		Name:      strings.TrimSpace(name),
+		Hash:      auth.HashToken(token),
+		Prefix:    token[:len(auth.APITokenPrefix)+8],
+		Scopes:    scopes,
+		CreatedBy: requestActor(r),
+		Created:   time.Now(),
+	}
+
+	t.ID, err = auth.NewID()
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to generate API token ID.")
+		return "", errors.New("Unable to create API token")
+	}
+
+	err = h.validator.Struct(t)
+	if err != nil {
+		return "", err
+	}
+
+	err = h.apiTokens.InsertOne(t)
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to save API token.")
+		return "", errors.New("Unable to create API token")
+	}
+
+	requestLog(r).Info().Str("token", t.ID).Str("name", t.Name).Strs("scopes", t.Scopes).Msg("Created API token.")
+
+	return token, nil
+}
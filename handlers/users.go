@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/mikestefanello/otcscanner/auth"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+)
+
+// minPasswordLength is the minimum length of user passwords
+const minPasswordLength = 8
+
+type userPage struct {
+	// Username is the username of the user being edited, which is empty for new users
+	Username string
+	User     models.User
+	Roles    []string
+}
+
+// UsersPage handles get requests to list the users
+func (h *HTTPHandler) UsersPage(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Users",
+	}
+
+	users, err := h.users.LoadAll()
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to load users from the database.")
+		page.AddMessage("danger", "Unable to communicate with the database.")
+	}
+
+	page.Content = users
+	h.Render(w, r, "users", page)
+}
+
+// UserForm handles both get and post requests on the user form, which is used to create new users and
+// edit existing ones
+func (h *HTTPHandler) UserForm(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "User",
+	}
+
+	content := userPage{
+		Username: chi.URLParam(r, "username"),
+		User: models.User{
+			Role:   models.RoleScanner,
+			Active: true,
+		},
+		Roles: models.Roles,
+	}
+
+	// Load the existing user
+	if content.Username != "" {
+		user, err := h.users.LoadByUsername(content.Username)
+		if err != nil {
+			if err == repository.ErrNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				page.AddMessage("danger", "User not found.")
+			} else {
+				requestLog(r).Error().Err(err).Msg("Unable to load user from the database.")
+				page.AddMessage("danger", "Unable to communicate with the database.")
+			}
+			h.Render(w, r, "text", page)
+			return
+		}
+		content.User = *user
+	}
+
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		content.User.Role = r.PostForm.Get("role")
+		content.User.Active = r.PostForm.Get("active") == "on"
+		if content.Username == "" {
+			content.User.Username = strings.TrimSpace(r.PostForm.Get("username"))
+		}
+
+		err := h.saveUser(r, content.Username == "", &content.User, r.PostForm.Get("password"))
+		if err != nil {
+			for _, msg := range errorMessages(err) {
+				page.AddMessage("danger", msg)
+			}
+		} else {
+			page.AddMessage("success", "User saved.")
+			content.Username = content.User.Username
+		}
+	}
+
+	page.Content = content
+	h.Render(w, r, "user", page)
+}
+
+// UserDelete handles post requests to delete a user
+func (h *HTTPHandler) UserDelete(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Users",
+	}
+
+	username := chi.URLParam(r, "username")
+
+	if username == requestActor(r) {
+		page.AddMessage("danger", "You cannot delete your own account.")
+		h.Render(w, r, "text", page)
+		return
+	}
+
+	err := h.users.Delete(username)
+	if err != nil && err != repository.ErrNotFound {
+		requestLog(r).Error().Err(err).Msg("Unable to delete user.")
+		page.AddMessage("danger", "Unable to delete user.")
+		h.Render(w, r, "text", page)
+		return
+	}
+
+	h.endSessions(r, username)
+	requestLog(r).Info().Str("user", username).Msg("Deleted user.")
+	page.AddMessage("success", "User deleted.")
+	h.Render(w, r, "text", page)
+}
+
+// saveUser validates and saves a user, setting their password if one is provided. A password is
+// required for new users. The sessions of other users are ended so changes to their account take effect
+func (h *HTTPHandler) saveUser(r *http.Request, isNew bool, user *models.User, password string) error {
+	if isNew && password == "" {
+		return inputError{errors.New("A password is required")}
+	}
+
+	if password != "" && len(password) < minPasswordLength {
+		return inputError{fmt.Errorf("The password must be at least %d characters", minPasswordLength)}
+	}
+
+	// Prevent admins from locking themselves out
+	if user.Username == requestActor(r) {
+		if !user.HasRole(models.RoleAdmin) {
+			return inputError{errors.New("You cannot remove your own admin access")}
+		}
+		if !user.Active {
+			return inputError{errors.New("You cannot deactivate your own account")}
+		}
+	}
+
+	err := h.validator.Struct(user)
+	if err != nil {
+		return err
+	}
+
+	if isNew {
+		// Requests run as an anonymous admin until the first user is created, so that user must be
+		// an active admin or no one would be able to manage users afterwards
+		var count int64
+		count, err = h.users.Count()
+		if err != nil {
+			requestLog(r).Error().Err(err).Msg("Unable to count users.")
+			return errDatabase
+		}
+		if count == 0 && (!user.HasRole(models.RoleAdmin) || !user.Active) {
+			return inputError{errors.New("The first user must be an active admin")}
+		}
+
+		_, err = h.users.LoadByUsername(user.Username)
+		if err == nil {
+			return inputError{errors.New("A user with this username already exists")}
+		} else if err != repository.ErrNotFound {
+			requestLog(r).Error().Err(err).Msg("Unable to load user from the database.")
+			return errDatabase
+		}
+		user.Created = time.Now()
+	}
+
+	if password != "" {
+		user.PasswordHash, err = auth.HashPassword(password)
+		if err != nil {
+			requestLog(r).Error().Err(err).Msg("Unable to hash password.")
+			return errors.New("Unable to save user")
+		}
+	}
+
+	err = h.users.Save(user)
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to save user.")
+		return errors.New("Unable to save user")
+	}
+
+	// The user's own session is kept so they are not logged out by editing their own account
+	if !isNew && user.Username != requestActor(r) {
+		h.endSessions(r, user.Username)
+	}
+
+	requestLog(r).Info().Str("user", user.Username).Str("role", user.Role).Bool("active", user.Active).Msg("Saved user.")
+
+	return nil
+}
+
+// endSessions ends every session of a given user, so changes to their account take effect
+func (h *HTTPHandler) endSessions(r *http.Request, username string) {
+	err := h.sessions.DeleteByUsername(username)
+	if err != nil {
+		requestLog(r).Error().Err(err).Str("user", username).Msg("Unable to delete user sessions.")
+	}
+}
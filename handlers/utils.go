@@ -1,16 +1,30 @@
 package handlers
 
 import (
+	"bytes"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"net/http"
-	"path"
+	"os"
 	"path/filepath"
-	"runtime"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/mikestefanello/otcscanner/auth"
 	"github.com/mikestefanello/otcscanner/config"
+	"github.com/mikestefanello/otcscanner/importer"
+	"github.com/mikestefanello/otcscanner/logging"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/purge"
 	"github.com/mikestefanello/otcscanner/repository"
+	"github.com/mikestefanello/otcscanner/scheduler"
+	"github.com/mikestefanello/otcscanner/static"
+	"github.com/mikestefanello/otcscanner/templates"
+	"github.com/mikestefanello/otcscanner/watcher"
+	"github.com/mikestefanello/otcscanner/webhook"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 )
 
 // Page describes a page that is rendered in templates
@@ -19,6 +33,15 @@ type Page struct {
 	Title    string
 	Messages Messages
 	Content  interface{}
+
+	// User is the user making the request, if they have been authenticated
+	User *models.User
+
+	// CSRFToken must be included in forms that are posted
+	CSRFToken string
+
+	// LibIntegrity contains the subresource integrity hashes of the third party static files, keyed by name
+	LibIntegrity map[string]string
 }
 
 // AddMessage adds a status message to a given page
@@ -40,51 +63,127 @@ type Messages []Message
 
 // HTTPHandler handles HTTP routes
 type HTTPHandler struct {
-	baseTemplate  *template.Template
-	pageTemplates map[string]*template.Template
-	config        config.Config
-	repo          repository.OrderRepository
-	validator     *validator.Validate
+	pageTemplates  map[string]*template.Template
+	templates      fs.FS
+	static         fs.FS
+	staticETags    map[string]string
+	libIntegrity   map[string]string
+	devMode        bool
+	config         config.Config
+	secret         string
+	repo           repository.OrderRepository
+	audit          repository.AuditRepository
+	exportProfiles repository.ExportProfileRepository
+	importProfiles repository.ImportProfileRepository
+	webhooks       repository.WebhookRepository
+	deliveries     repository.WebhookDeliveryRepository
+	users          repository.UserRepository
+	sessions       repository.SessionRepository
+	apiTokens      repository.APITokenRepository
+	stations       repository.StationRepository
+	validator      *validator.Validate
+	importer       *importer.Importer
+	watcher        *watcher.Watcher
+	scheduler      *scheduler.Scheduler
+	hooks          *webhook.Dispatcher
+	purger         *purge.Purger
 }
 
 // NewHTTPHandler creates a new HTTP handler
-func NewHTTPHandler(cfg config.Config, repo repository.OrderRepository) *HTTPHandler {
-	// Get the base templates path
-	basePath := filepath.Join(getTemplatesDirPath(), "global", "*.html")
+// Every template is parsed up front, so an error is returned if any template is invalid rather than
+// when a page is first requested
+func NewHTTPHandler(cfg config.Config, repos repository.Repositories, importWatcher *watcher.Watcher, exportScheduler *scheduler.Scheduler, hooks *webhook.Dispatcher) (*HTTPHandler, error) {
+	// Use the templates and static files embedded in the binary, or read them from a source checkout
+	// in dev mode so changes show without rebuilding
+	devMode := cfg.App.DevDir != ""
+	templateFiles, staticFiles := fs.FS(templates.FS), fs.FS(static.FS)
+	if devMode {
+		templateFiles = os.DirFS(filepath.Join(cfg.App.DevDir, "templates"))
+		staticFiles = os.DirFS(filepath.Join(cfg.App.DevDir, "static"))
+		log.Warn().Str("dir", cfg.App.DevDir).Msg("Dev mode is enabled, so templates and static files are read from disk on every request.")
+	}
 
-	// Load and parse the base template
-	base, err := template.ParseGlob(basePath)
+	pages, err := parseTemplates(templateFiles)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	return &HTTPHandler{
-		baseTemplate:  base,
-		pageTemplates: make(map[string]*template.Template),
-		config:        cfg,
-		repo:          repo,
-		validator:     validator.New(),
+	// Static files only change when a new version is built, so their ETags are computed once
+	var etags map[string]string
+	if !devMode {
+		etags, err = staticETags(staticFiles)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read static files: %s", err.Error())
+		}
 	}
+
+	integrity, err := libIntegrity(staticFiles)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to use the third party static files: %s", err.Error())
+	}
+
+	// Use a random secret if none was provided, so cookies and forms still cannot be forged
+	secret := cfg.App.Secret
+	if secret == "" {
+		secret, err = auth.NewToken()
+		if err != nil {
+			return nil, err
+		}
+		log.Warn().Msg("No app secret was provided, so a random one is used. Previous scans and forms loaded before a restart will not be accepted.")
+	}
+
+	v := validator.New()
+
+	return &HTTPHandler{
+		pageTemplates:  pages,
+		templates:      templateFiles,
+		static:         staticFiles,
+		staticETags:    etags,
+		libIntegrity:   integrity,
+		devMode:        devMode,
+		config:         cfg,
+		secret:         secret,
+		repo:           repos.Orders,
+		audit:          repos.Audit,
+		exportProfiles: repos.ExportProfiles,
+		importProfiles: repos.ImportProfiles,
+		webhooks:       repos.Webhooks,
+		deliveries:     repos.Deliveries,
+		users:          repos.Users,
+		sessions:       repos.Sessions,
+		apiTokens:      repos.APITokens,
+		stations:       repos.Stations,
+		validator:      v,
+		importer:       importer.New(repos.Orders, v),
+		watcher:        importWatcher,
+		scheduler:      exportScheduler,
+		hooks:          hooks,
+		purger:         purge.New(cfg.Supervisor, repos.Orders, repos.Users, hooks),
+	}, nil
 }
 
 // Render renders a given page struct within a given template, specified without the .html extension.
-// Templates are parsed within all templates in the global template directory
-func (h *HTTPHandler) Render(w http.ResponseWriter, tmpl string, page Page) {
-	// Check if the template has been parsed
-	if _, ok := h.pageTemplates[tmpl]; !ok {
-		// Format the template path
-		path := filepath.Join(getTemplatesDirPath(), fmt.Sprintf("%s.html", tmpl))
-
-		// Parse the template
-		parsed, err := template.Must(h.baseTemplate.Clone()).ParseFiles(path)
+// The page is rendered in to a buffer first, so a template error results in an error response rather
+// than part of a page
+func (h *HTTPHandler) Render(w http.ResponseWriter, r *http.Request, tmpl string, page Page) {
+	pages := h.pageTemplates
 
+	// Parse the templates again in dev mode, so changes show without restarting
+	if h.devMode {
+		var err error
+		pages, err = parseTemplates(h.templates)
 		if err != nil {
+			requestLog(r).Error().Err(err).Msg("Unable to parse templates.")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+	}
 
-		// Store it in the handler so it only happens once
-		h.pageTemplates[tmpl] = parsed
+	parsed, ok := pages[tmpl]
+	if !ok {
+		requestLog(r).Error().Str("template", tmpl).Msg("Template not found.")
+		http.Error(w, "Unable to render the page", http.StatusInternalServerError)
+		return
 	}
 
 	// Set the page site name, if needed
@@ -92,19 +191,115 @@ func (h *HTTPHandler) Render(w http.ResponseWriter, tmpl string, page Page) {
 		page.SiteName = h.config.App.Name
 	}
 
-	// Execute the templates
-	err := h.pageTemplates[tmpl].Execute(w, page)
+	// Set the user, so the layout can show who is logged in
+	page.User = requestUser(r)
+	page.CSRFToken = requestCSRFToken(r)
+	page.LibIntegrity = h.libIntegrity
+
+	// Execute the layout, which includes the page template
+	var buf bytes.Buffer
+	err := parsed.ExecuteTemplate(&buf, "layout.html", page)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		requestLog(r).Error().Err(err).Str("template", tmpl).Msg("Unable to render template.")
+		http.Error(w, "Unable to render the page", http.StatusInternalServerError)
 		return
 	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
 }
 
-// getTemplatesDirPath gets the templates directory path
-// This is needed incase this is called from a package outside of main,
-// such as testing
-func getTemplatesDirPath() string {
-	_, b, _, _ := runtime.Caller(0)
-	d := path.Join(path.Dir(b))
-	return filepath.Join(filepath.Dir(d), "templates")
+// parseTemplates parses every page template within the global templates, keyed by name without the
+// .html extension. The parsed templates are only read once they are returned, so they are safe to use
+// from concurrent requests
+func parseTemplates(files fs.FS) (map[string]*template.Template, error) {
+	base, err := template.ParseFS(files, "global/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse global templates: %s", err.Error())
+	}
+
+	if base.Lookup("layout.html") == nil {
+		return nil, fmt.Errorf("The global templates do not include layout.html")
+	}
+
+	names, err := fs.Glob(files, "*.html")
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make(map[string]*template.Template, len(names))
+	for _, name := range names {
+		parsed, err := template.Must(base.Clone()).ParseFS(files, name)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse template %s: %s", name, err.Error())
+		}
+
+		if parsed.Lookup("content") == nil {
+			return nil, fmt.Errorf("Template %s does not define content", name)
+		}
+
+		pages[strings.TrimSuffix(name, ".html")] = parsed
+	}
+
+	return pages, nil
+}
+
+// maxRowErrorMessages is the maximum number of rows of an imported file to show errors for
+const maxRowErrorMessages = 50
+
+// errorMessages converts an error in to messages suitable to show to the user, with one message
+// per field for validation errors
+func errorMessages(err error) []string {
+	return importer.ErrorMessages(err, maxRowErrorMessages)
+}
+
+// requestActor returns the name of the user making a given request, for the audit log
+func requestActor(r *http.Request) string {
+	if user := requestUser(r); user != nil {
+		return user.Username
+	}
+	return ""
+}
+
+// requestLog returns the logger of a given request, which includes the request's ID and user
+func requestLog(r *http.Request) *zerolog.Logger {
+	return logging.FromContext(r.Context())
+}
+
+// flushWriter writes to an HTTP response and flushes after every write so the data is sent to the
+// client immediately rather than buffered
+type flushWriter struct {
+	w http.ResponseWriter
+	f http.Flusher
+
+	// written determines if anything has been written to the response
+	written bool
+}
+
+// newFlushWriter creates a new flush writer for a given response
+func newFlushWriter(w http.ResponseWriter) *flushWriter {
+	f, _ := w.(http.Flusher)
+	return &flushWriter{w: w, f: f}
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	fw.written = fw.written || len(p) > 0
+	n, err := fw.w.Write(p)
+	if fw.f != nil {
+		fw.f.Flush()
+	}
+	return n, err
+}
+
+// abort ends a response that failed while being written. If nothing has been written, the file headers
+// are removed and the given error is returned so it can be shown instead. Otherwise the response is
+// aborted so the client does not mistake a truncated file for a complete one
+func (fw *flushWriter) abort(err error) error {
+	if fw.written {
+		panic(http.ErrAbortHandler)
+	}
+
+	fw.w.Header().Del("Content-Disposition")
+	fw.w.Header().Del("Content-Type")
+	return err
 }
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+	"github.com/mikestefanello/otcscanner/webhook"
+)
+
+// maxWebhookDeliveries is the number of recent deliveries listed on the webhooks page
+const maxWebhookDeliveries = 100
+
+type webhooksPage struct {
+	Subscriptions []models.WebhookSubscription
+	Deliveries    []models.WebhookDelivery
+	Status        string
+	Statuses      []string
+}
+
+type webhookPage struct {
+	// Name is the name of the subscription being edited, which is empty for new subscriptions
+	Name         string
+	Subscription models.WebhookSubscription
+	Events       []webhookEvent
+	Headers      []string
+}
+
+type webhookEvent struct {
+	Name     string
+	Selected bool
+}
+
+// WebhooksPage handles get requests to list the webhook subscriptions and recent deliveries
+func (h *HTTPHandler) WebhooksPage(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Webhooks",
+	}
+
+	content := webhooksPage{
+		Status: r.URL.Query().Get("status"),
+		Statuses: []string{
+			models.WebhookDeliveryPending,
+			models.WebhookDeliveryDelivered,
+			models.WebhookDeliveryFailed,
+		},
+	}
+
+	var err error
+	content.Subscriptions, err = h.webhooks.LoadAll()
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to load webhook subscriptions from the database.")
+		page.AddMessage("danger", "Unable to communicate with the database.")
+	}
+
+	content.Deliveries, err = h.deliveries.LoadRecent(content.Status, maxWebhookDeliveries)
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to load webhook deliveries from the database.")
+		page.AddMessage("danger", "Unable to load webhook deliveries.")
+	}
+
+	page.Content = content
+	h.Render(w, r, "webhooks", page)
+}
+
+// WebhookForm handles both get and post requests on the webhook subscription form, which is used to
+// create new subscriptions and edit existing ones
+func (h *HTTPHandler) WebhookForm(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Webhook",
+	}
+
+	content := webhookPage{
+		Name: chi.URLParam(r, "name"),
+		Subscription: models.WebhookSubscription{
+			Active: true,
+		},
+		Headers: []string{
+			webhook.HeaderEvent,
+			webhook.HeaderDelivery,
+			webhook.HeaderTimestamp,
+			webhook.HeaderSignature,
+		},
+	}
+
+	// Load the existing subscription
+	if content.Name != "" {
+		subscription, err := h.webhooks.LoadByName(content.Name)
+		if err != nil {
+			if err == repository.ErrNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				page.AddMessage("danger", "Webhook not found.")
+			} else {
+				requestLog(r).Error().Err(err).Msg("Unable to load webhook subscription from the database.")
+				page.AddMessage("danger", "Unable to communicate with the database.")
+			}
+			h.Render(w, r, "text", page)
+			return
+		}
+		content.Subscription = *subscription
+	}
+
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		secret := content.Subscription.Secret
+		content.Subscription = parseWebhookForm(r.PostForm)
+
+		// Keep the existing secret unless a new one was requested
+		if r.PostForm.Get("regenerate_secret") != "on" {
+			content.Subscription.Secret = secret
+		}
+
+		err := h.saveWebhook(r, content.Name, &content.Subscription)
+		if err != nil {
+			for _, msg := range errorMessages(err) {
+				page.AddMessage("danger", msg)
+			}
+		} else {
+			page.AddMessage("success", "Webhook saved.")
+			content.Name = content.Subscription.Name
+		}
+	}
+
+	for _, event := range models.WebhookEvents {
+		content.Events = append(content.Events, webhookEvent{
+			Name:     event,
+			Selected: containsString(content.Subscription.Events, event),
+		})
+	}
+
+	page.Content = content
+	h.Render(w, r, "webhook", page)
+}
+
+// WebhookDelete handles post requests to delete a webhook subscription
+func (h *HTTPHandler) WebhookDelete(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Webhooks",
+	}
+
+	name := chi.URLParam(r, "name")
+	err := h.webhooks.Delete(name)
+
+	if err != nil && err != repository.ErrNotFound {
+		requestLog(r).Error().Err(err).Msg("Unable to delete webhook subscription.")
+		page.AddMessage("danger", "Unable to delete webhook.")
+	} else {
+		requestLog(r).Info().Str("name", name).Msg("Deleted webhook subscription.")
+		page.AddMessage("success", "Webhook deleted.")
+	}
+
+	h.Render(w, r, "text", page)
+}
+
+// WebhookDeliveryPage handles get requests to inspect a webhook delivery
+func (h *HTTPHandler) WebhookDeliveryPage(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Webhook delivery",
+	}
+
+	delivery, err := h.deliveries.LoadByID(chi.URLParam(r, "id"))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			page.AddMessage("danger", "Webhook delivery not found.")
+		} else {
+			requestLog(r).Error().Err(err).Msg("Unable to load webhook delivery from the database.")
+			page.AddMessage("danger", "Unable to communicate with the database.")
+		}
+		h.Render(w, r, "text", page)
+		return
+	}
+
+	page.Content = delivery
+	h.Render(w, r, "webhook_delivery", page)
+}
+
+// WebhookRedeliver handles post requests to deliver a webhook delivery again
+func (h *HTTPHandler) WebhookRedeliver(w http.ResponseWriter, r *http.Request) {
+	page := Page{
+		Title: "Webhook delivery",
+	}
+
+	id := chi.URLParam(r, "id")
+	err := h.hooks.Redeliver(id)
+
+	switch {
+	case err == repository.ErrNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		page.AddMessage("danger", "Webhook delivery not found.")
+	case err != nil:
+		requestLog(r).Error().Err(err).Str("delivery", id).Msg("Unable to redeliver webhook.")
+		page.AddMessage("danger", "Unable to redeliver webhook.")
+	default:
+		requestLog(r).Info().Str("delivery", id).Msg("Queued webhook for redelivery.")
+		page.AddMessage("success", fmt.Sprintf("Webhook delivery %s has been queued for redelivery.", id))
+	}
+
+	h.Render(w, r, "text", page)
+}
+
+// saveWebhook validates and saves a webhook subscription, generating a secret if it does not have one.
+// If the subscription was renamed, the subscription stored under its previous name is removed
+func (h *HTTPHandler) saveWebhook(r *http.Request, previousName string, subscription *models.WebhookSubscription) error {
+	subscription.Name = strings.TrimSpace(subscription.Name)
+
+	if subscription.Secret == "" {
+		secret, err := webhook.NewSecret()
+		if err != nil {
+			requestLog(r).Error().Err(err).Msg("Unable to generate webhook secret.")
+			return errors.New("Unable to generate a secret")
+		}
+		subscription.Secret = secret
+	}
+
+	err := h.validator.Struct(subscription)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range subscription.Events {
+		if !containsString(models.WebhookEvents, event) {
+			return inputError{fmt.Errorf("Unknown event: %s", event)}
+		}
+	}
+
+	// Prevent renaming a subscription over another one
+	if subscription.Name != previousName {
+		_, err = h.webhooks.LoadByName(subscription.Name)
+		if err == nil {
+			return inputError{errors.New("A webhook with this name already exists")}
+		} else if err != repository.ErrNotFound {
+			requestLog(r).Error().Err(err).Msg("Unable to load webhook subscription from the database.")
+			return errDatabase
+		}
+	}
+
+	err = h.webhooks.Save(subscription)
+	if err != nil {
+		requestLog(r).Error().Err(err).Msg("Unable to save webhook subscription.")
+		return errors.New("Unable to save webhook")
+	}
+
+	if previousName != "" && previousName != subscription.Name {
+		err = h.webhooks.Delete(previousName)
+		if err != nil && err != repository.ErrNotFound {
+			requestLog(r).Error().Err(err).Msg("Unable to delete renamed webhook subscription.")
+		}
+	}
+
+	requestLog(r).Info().Str("name", subscription.Name).Strs("events", subscription.Events).Msg("Saved webhook subscription.")
+
+	return nil
+}
+
+// parseWebhookForm builds a webhook subscription from the form, without its secret
+func parseWebhookForm(v url.Values) models.WebhookSubscription {
+	return models.WebhookSubscription{
+		Name:   v.Get("name"),
+		URL:    strings.TrimSpace(v.Get("url")),
+		Events: v["events"],
+		Active: v.Get("active") == "on",
+	}
+}
+
+// containsString determines if a slice contains a given string
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
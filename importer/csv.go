@@ -0,0 +1,27 @@
+package importer
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// csvRowReader reads the rows of a CSV file
+type csvRowReader struct {
+	r *csv.Reader
+}
+
+// newCSVRowReader creates a new CSV row reader
+func newCSVRowReader(r io.Reader) rowReader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	return &csvRowReader{r: cr}
+}
+
+func (r *csvRowReader) Next() ([]string, error) {
+	return r.r.Read()
+}
+
+func (r *csvRowReader) Close() error {
+	return nil
+}
@@ -0,0 +1,334 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/mikestefanello/otcscanner/metrics"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+)
+
+// insertBatchSize is the number of orders inserted in to the repository at a time, so large files do
+// not exceed the database's limits
+const insertBatchSize = 1000
+
+// headerSearchRows is the number of rows at the start of a file that are searched for the header row
+const headerSearchRows = 20
+
+// ErrNoOrders indicates that an imported file did not contain any orders
+var ErrNoOrders = errors.New("The file does not contain any orders")
+
+// Options controls how a file is imported
+type Options struct {
+	// Format is the format of the file, such as csv, xlsx or jsonl
+	Format string
+
+	// Sheet is the name of the worksheet to import from workbooks. The first sheet is used if empty
+	Sheet string
+
+	// Profile maps the file's columns to order fields. If nil, the best matching profile in Profiles is
+	// detected from the header row, falling back to the standard column headers
+	Profile *models.ImportProfile
+
+	// Profiles are the candidates for profile detection
+	Profiles []models.ImportProfile
+}
+
+// Result describes the outcome of an import
+type Result struct {
+	// Added is the number of orders added
+	Added int
+
+	// Skipped is the number of orders that were not added because an order with the same package ID
+	// already exists
+	Skipped int
+
+	// Profile is the name of the import profile used, if any
+	Profile string
+
+	// Unmatched contains the headers of columns that were not mapped to any order field
+	Unmatched []string
+}
+
+// RowError describes a problem with a single row of an imported file
+type RowError struct {
+	Row int
+	Err error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("Row %d: %s", e.Row, e.Err.Error())
+}
+
+// Errors contains the problems found with the rows of an imported file
+type Errors []RowError
+
+func (e Errors) Error() string {
+	return fmt.Sprintf("%d rows contain errors", len(e))
+}
+
+// SaveError indicates that valid orders could not be saved to the repository. Some orders may have
+// been added before the failure, but orders that already exist are skipped, so importing the same file
+// again adds the remaining orders
+type SaveError struct {
+	Err error
+}
+
+func (e SaveError) Error() string {
+	return fmt.Sprintf("Unable to save orders: %s", e.Err.Error())
+}
+
+// ErrorMessages converts an error returned when importing a file in to readable messages, with one message
+// per field for validation errors. Messages are included for at most maxRows invalid rows, or every
+// invalid row if maxRows is zero
+func ErrorMessages(err error, maxRows int) []string {
+	if rowErrs, ok := err.(Errors); ok {
+		msgs := make([]string, 0, len(rowErrs))
+		for i, rowErr := range rowErrs {
+			if i == maxRows && maxRows > 0 {
+				msgs = append(msgs, fmt.Sprintf("%d more rows contain errors.", len(rowErrs)-i))
+				break
+			}
+			for _, msg := range ErrorMessages(rowErr.Err, maxRows) {
+				msgs = append(msgs, fmt.Sprintf("Row %d: %s", rowErr.Row, msg))
+			}
+		}
+		return msgs
+	}
+
+	if valErrs, ok := err.(validator.ValidationErrors); ok {
+		msgs := make([]string, 0, len(valErrs))
+		for _, valErr := range valErrs {
+			msgs = append(msgs, fmt.Sprintf("%s failed validation: %s", valErr.Field(), valErr.Tag()))
+		}
+		return msgs
+	}
+
+	return []string{err.Error()}
+}
+
+// Importer reads orders from files, validates them and inserts them in to a repository
+type Importer struct {
+	repo      repository.OrderRepository
+	validator *validator.Validate
+}
+
+// New creates a new importer
+func New(repo repository.OrderRepository, v *validator.Validate) *Importer {
+	return &Importer{
+		repo:      repo,
+		validator: v,
+	}
+}
+
+// FormatFromFilename determines the format of a file from its extension
+func FormatFromFilename(filename string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+}
+
+// Import reads and validates all orders in a file and, if every order is valid, inserts them in to
+// the repository. Orders whose package ID already exists are skipped rather than replaced
+func (i *Importer) Import(ctx context.Context, r io.Reader, opts Options) (Result, error) {
+	orders, result, err := i.Read(r, opts)
+	if err != nil {
+		if rowErrs, ok := err.(Errors); ok {
+			metrics.ObserveImport(0, len(rowErrs))
+		}
+		return result, err
+	}
+
+	for start := 0; start < len(orders); start += insertBatchSize {
+		end := start + insertBatchSize
+		if end > len(orders) {
+			end = len(orders)
+		}
+
+		batch := orders[start:end]
+		added, err := i.repo.InsertMany(ctx, &batch)
+		result.Added += int(added)
+		if err != nil {
+			return result, SaveError{Err: err}
+		}
+		result.Skipped += len(batch) - int(added)
+	}
+
+	metrics.ObserveImport(result.Added, 0)
+
+	return result, nil
+}
+
+// Read reads and validates all orders in a file. If any row is invalid or repeats a package ID, an
+// Errors value describing every invalid row is returned
+func (i *Importer) Read(r io.Reader, opts Options) (models.Orders, Result, error) {
+	orders := models.Orders{}
+	rowErrs := Errors{}
+
+	// Rows are keyed by package ID, since only the first order with a given package ID would be added
+	packageRows := make(map[string]int)
+
+	validate := func(rowNum int, order models.Order) {
+		err := i.validator.Struct(order)
+		if err != nil {
+			rowErrs = append(rowErrs, RowError{Row: rowNum, Err: err})
+			return
+		}
+		if prev, ok := packageRows[order.PackageID]; ok {
+			rowErrs = append(rowErrs, RowError{Row: rowNum, Err: fmt.Errorf("Package ID %s is also used by row %d", order.PackageID, prev)})
+			return
+		}
+		packageRows[order.PackageID] = rowNum
+		orders = append(orders, order)
+	}
+
+	var result Result
+	var err error
+
+	switch opts.Format {
+	case "jsonl", "ndjson":
+		result, err = readJSONLines(r, validate)
+	default:
+		var rows rowReader
+		rows, err = newRowReader(r, opts)
+		if err != nil {
+			return nil, result, err
+		}
+		defer rows.Close()
+
+		result, err = readRows(rows, opts, validate)
+	}
+
+	if err != nil {
+		return nil, result, err
+	}
+
+	if len(rowErrs) > 0 {
+		return nil, result, rowErrs
+	}
+
+	if len(orders) == 0 {
+		return nil, result, ErrNoOrders
+	}
+
+	return orders, result, nil
+}
+
+// rowReader reads the rows of a tabular file
+type rowReader interface {
+	// Next returns the next row, and io.EOF when there are no more rows
+	Next() ([]string, error)
+
+	// Close releases the resources held by the reader
+	Close() error
+}
+
+// newRowReader creates a row reader for a file in a given format
+func newRowReader(r io.Reader, opts Options) (rowReader, error) {
+	switch opts.Format {
+	case "csv":
+		return newCSVRowReader(r), nil
+	case "xlsx":
+		return newXLSXRowReader(r, opts.Sheet)
+	}
+
+	return nil, fmt.Errorf("Unsupported file format: %s", opts.Format)
+}
+
+// readRows locates the header row, then maps each following row to an order and passes it to a given
+// function along with its row number
+func readRows(rows rowReader, opts Options, fn func(rowNum int, order models.Order)) (Result, error) {
+	result := Result{}
+
+	// Buffer the first rows to find the header
+	buffered := make([][]string, 0, headerSearchRows)
+	for len(buffered) < headerSearchRows {
+		row, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+		buffered = append(buffered, row)
+	}
+
+	headerIndex, mapping, profile := detectHeader(buffered, opts)
+	if headerIndex < 0 {
+		return result, errors.New("Unable to find a header row with recognized column names")
+	}
+
+	if profile != nil {
+		result.Profile = profile.Name
+	}
+	result.Unmatched = mapping.unmatched
+
+	rowNum := headerIndex + 1
+	process := func(row []string) {
+		rowNum++
+		if !isBlank(row) {
+			fn(rowNum, mapping.order(row))
+		}
+	}
+
+	for _, row := range buffered[headerIndex+1:] {
+		process(row)
+	}
+
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return result, fmt.Errorf("Row %d: %s", rowNum+1, err.Error())
+		}
+		process(row)
+	}
+}
+
+// detectHeader finds the header row and the profile which together map the most columns, and returns
+// the row's index, the mapping and the profile. If a profile is specified in the options, only that
+// profile is considered. A nil profile indicates the standard column headers are used
+func detectHeader(rows [][]string, opts Options) (int, rowMapping, *models.ImportProfile) {
+	candidates := []*models.ImportProfile{opts.Profile}
+	if opts.Profile == nil {
+		for i := range opts.Profiles {
+			candidates = append(candidates, &opts.Profiles[i])
+		}
+	}
+
+	bestIndex := -1
+	var bestMapping rowMapping
+	var bestProfile *models.ImportProfile
+
+	for i, row := range rows {
+		for _, profile := range candidates {
+			m := newRowMapping(row, profile)
+			if m.matched > bestMapping.matched {
+				bestIndex, bestMapping, bestProfile = i, m, profile
+			}
+		}
+	}
+
+	return bestIndex, bestMapping, bestProfile
+}
+
+// normalizeHeader normalizes a header so that matching ignores case and surrounding whitespace
+func normalizeHeader(header string) string {
+	return strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header, "\ufeff")))
+}
+
+// isBlank determines if every cell in a row is empty
+func isBlank(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+)
+
+// fakeOrders is an order repository which stores inserted orders in memory, skipping those whose package
+// ID already exists. Methods the importer does not use are left to the embedded interface
+type fakeOrders struct {
+	repository.OrderRepository
+	orders map[string]models.Order
+
+	// failBatch is the number of the InsertMany call which fails, counting from one, or zero if none do
+	failBatch int
+	batches   int
+}
+
+func (f *fakeOrders) InsertMany(ctx context.Context, orders *models.Orders) (int64, error) {
+	f.batches++
+	if f.batches == f.failBatch {
+		return 0, errors.New("connection reset")
+	}
+
+	added := int64(0)
+	for _, order := range *orders {
+		if _, ok := f.orders[order.PackageID]; ok {
+			continue
+		}
+		f.orders[order.PackageID] = order
+		added++
+	}
+	return added, nil
+}
+
+func TestImportSkipsExisting(t *testing.T) {
+	// A file with more orders than fit in two batches, and the package IDs of its first batch
+	var large strings.Builder
+	large.WriteString("Package ID\n")
+	firstBatch := []string{}
+	for n := 1; n <= 2*insertBatchSize+500; n++ {
+		fmt.Fprintf(&large, "PKG%d\n", n)
+		if n <= insertBatchSize {
+			firstBatch = append(firstBatch, fmt.Sprintf("PKG%d", n))
+		}
+	}
+
+	tests := []struct {
+		name        string
+		file        string
+		existing    []string
+		failBatch   int
+		wantAdded   int
+		wantSkipped int
+		wantOrders  int
+		wantErr     bool
+	}{
+		{
+			name:       "new orders are added",
+			file:       "Package ID,Recipient City\nPKG1,Springfield\nPKG2,Shelbyville\n",
+			wantAdded:  2,
+			wantOrders: 2,
+		},
+		{
+			name:        "existing orders are skipped",
+			file:        "Package ID,Recipient City\nPKG1,Springfield\nPKG2,Shelbyville\n",
+			existing:    []string{"PKG2"},
+			wantAdded:   1,
+			wantSkipped: 1,
+			wantOrders:  2,
+		},
+		{
+			name:    "package IDs repeated within a file are rejected",
+			file:    "Package ID,Recipient City\nPKG1,Springfield\nPKG1,Shelbyville\n",
+			wantErr: true,
+		},
+		{
+			name:       "a failed batch keeps the earlier batches",
+			file:       large.String(),
+			failBatch:  2,
+			wantAdded:  insertBatchSize,
+			wantOrders: insertBatchSize,
+			wantErr:    true,
+		},
+		{
+			name:        "importing again after a failure adds the rest",
+			file:        large.String(),
+			existing:    firstBatch,
+			wantAdded:   insertBatchSize + 500,
+			wantSkipped: insertBatchSize,
+			wantOrders:  2*insertBatchSize + 500,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &fakeOrders{orders: map[string]models.Order{}, failBatch: tc.failBatch}
+			for _, id := range tc.existing {
+				repo.orders[id] = models.Order{PackageID: id, RecipientCity: "Existing"}
+			}
+
+			result, err := New(repo, validator.New()).Import(context.Background(), strings.NewReader(tc.file), Options{Format: "csv"})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected an error to be %t, got %v", tc.wantErr, err)
+			}
+
+			if result.Added != tc.wantAdded || result.Skipped != tc.wantSkipped {
+				t.Errorf("expected %d added and %d skipped, got %d and %d", tc.wantAdded, tc.wantSkipped, result.Added, result.Skipped)
+			}
+			if len(repo.orders) != tc.wantOrders {
+				t.Errorf("expected %d orders, got %d", tc.wantOrders, len(repo.orders))
+			}
+			for _, id := range tc.existing {
+				if repo.orders[id].RecipientCity != "Existing" {
+					t.Errorf("expected existing order %s to be unchanged, got %+v", id, repo.orders[id])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mikestefanello/otcscanner/models"
+)
+
+// maxJSONLineSize is the maximum size of a single line in a JSON Lines file
+const maxJSONLineSize = 1 << 20
+
+// readJSONLines reads a JSON Lines file, one line at a time, mapping each object to an order using
+// the order's JSON field names and passing it to a given function along with its line number.
+// Keys that do not match an order field are reported as unmatched
+func readJSONLines(r io.Reader, fn func(rowNum int, order models.Order)) (Result, error) {
+	result := Result{}
+	unmatched := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxJSONLineSize)
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		// Numbers are decoded as written so large package IDs and weights keep their exact digits
+		values := make(map[string]interface{})
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		err := dec.Decode(&values)
+		if err == nil && dec.InputOffset() != int64(len(line)) {
+			err = errors.New("unexpected data after the object")
+		}
+		if err != nil {
+			return result, fmt.Errorf("Row %d: Invalid JSON: %s", lineNum, err.Error())
+		}
+
+		order := models.Order{}
+		for key, value := range values {
+			if !order.Set(key, jsonValueString(value)) {
+				unmatched[key] = true
+			}
+		}
+
+		fn(lineNum, order)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return result, fmt.Errorf("Row %d: %s", lineNum+1, err.Error())
+	}
+
+	for key := range unmatched {
+		result.Unmatched = append(result.Unmatched, key)
+	}
+	sort.Strings(result.Unmatched)
+
+	return result, nil
+}
+
+// jsonValueString converts a decoded JSON value to the string stored on an order, trimming strings
+// like the cells of other formats
+func jsonValueString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
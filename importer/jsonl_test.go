@@ -0,0 +1,96 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/mikestefanello/otcscanner/models"
+)
+
+func TestReadJSONLines(t *testing.T) {
+	tests := []struct {
+		name          string
+		format        string
+		file          string
+		wantOrders    models.Orders
+		wantUnmatched []string
+		wantRowErrors []int
+		wantErr       string
+	}{
+		{
+			name:   "numbers are exact and strings are trimmed",
+			format: "jsonl",
+			file: `{"packageId": 12345678901234567890, "recipientCity": " Springfield ", "weight": 2.50, "gift": true}` + "\n\n" +
+				`{"packageId": "PKG2", "weight": null, "quantity": 3}` + "\n",
+			wantOrders: models.Orders{
+				{PackageID: "12345678901234567890", RecipientCity: "Springfield", Weight: "2.50"},
+				{PackageID: "PKG2", Quantity: "3"},
+			},
+			wantUnmatched: []string{"gift"},
+		},
+		{
+			name:          "invalid rows",
+			format:        "ndjson",
+			file:          `{"packageId": "PKG1"}` + "\n" + `{"recipientCity": "Springfield"}` + "\n" + `{"packageId": ""}` + "\n",
+			wantRowErrors: []int{2, 3},
+		},
+		{
+			name:    "trailing data",
+			format:  "jsonl",
+			file:    `{"packageId": "PKG1"} {"packageId": "PKG2"}` + "\n",
+			wantErr: "Row 1: Invalid JSON: unexpected data after the object",
+		},
+		{
+			name:    "invalid JSON",
+			format:  "jsonl",
+			file:    `{"packageId": "PKG1"}` + "\n" + `{"packageId": }` + "\n",
+			wantErr: "Row 2: Invalid JSON",
+		},
+		{
+			name:    "no orders",
+			format:  "jsonl",
+			file:    "\n\n",
+			wantErr: ErrNoOrders.Error(),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			orders, result, err := New(nil, validator.New()).Read(strings.NewReader(tc.file), Options{Format: tc.format})
+
+			if tc.wantRowErrors != nil {
+				rowErrs, ok := err.(Errors)
+				if !ok {
+					t.Fatalf("expected row errors, got %v", err)
+				}
+				rows := []int{}
+				for _, rowErr := range rowErrs {
+					rows = append(rows, rowErr.Row)
+				}
+				if !reflect.DeepEqual(rows, tc.wantRowErrors) {
+					t.Errorf("expected errors in rows %v, got %v", tc.wantRowErrors, rows)
+				}
+				return
+			}
+
+			if tc.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tc.wantErr) {
+					t.Fatalf("expected an error starting with %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(orders, tc.wantOrders) {
+				t.Errorf("expected orders %+v, got %+v", tc.wantOrders, orders)
+			}
+			if !reflect.DeepEqual(result.Unmatched, tc.wantUnmatched) {
+				t.Errorf("expected unmatched keys %v, got %v", tc.wantUnmatched, result.Unmatched)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/mikestefanello/otcscanner/models"
+)
+
+// fieldMapping builds the value of an order field from the cells of a row
+type fieldMapping struct {
+	key       string
+	cells     []int
+	separator string
+	value     string
+	transform string
+}
+
+// build builds the field value from a given row
+func (m fieldMapping) build(row []string) string {
+	values := make([]string, 0, len(m.cells))
+	for _, i := range m.cells {
+		if i < len(row) {
+			if v := strings.TrimSpace(row[i]); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+
+	value := strings.Join(values, m.separator)
+	if value == "" {
+		value = m.value
+	}
+
+	return strings.TrimSpace(applyTransform(m.transform, value))
+}
+
+// rowMapping maps the rows following a header row to orders
+type rowMapping struct {
+	fields    []fieldMapping
+	matched   int
+	unmatched []string
+}
+
+// order builds an order from a given row
+func (m rowMapping) order(row []string) models.Order {
+	order := models.Order{}
+	for _, f := range m.fields {
+		order.Set(f.key, f.build(row))
+	}
+	return order
+}
+
+// newRowMapping builds the mapping for a given header row using an optional profile. Order fields
+// without a mapping in the profile are matched to cells using their standard CSV headers
+func newRowMapping(header []string, profile *models.ImportProfile) rowMapping {
+	m := rowMapping{}
+
+	// Index the header cells
+	index := make(map[string]int)
+	for i, cell := range header {
+		name := normalizeHeader(cell)
+		if _, ok := index[name]; !ok && name != "" {
+			index[name] = i
+		}
+	}
+
+	used := make(map[int]bool)
+	mapped := make(map[string]bool)
+
+	// Add the profile mappings
+	if profile != nil {
+		for _, pm := range profile.Mappings {
+			f := fieldMapping{
+				key:       pm.Key,
+				separator: pm.Separator,
+				value:     pm.Value,
+				transform: pm.Transform,
+			}
+
+			for _, h := range pm.Headers {
+				if i, ok := index[normalizeHeader(h)]; ok {
+					f.cells = append(f.cells, i)
+					used[i] = true
+				}
+			}
+
+			if len(f.cells) > 0 || f.value != "" {
+				m.fields = append(m.fields, f)
+				mapped[pm.Key] = true
+			}
+		}
+	}
+
+	// Match the remaining fields by their standard headers
+	for _, col := range models.OrderColumns() {
+		if mapped[col.Key] {
+			continue
+		}
+
+		if i, ok := index[normalizeHeader(col.Header)]; ok && !used[i] {
+			m.fields = append(m.fields, fieldMapping{key: col.Key, cells: []int{i}})
+			used[i] = true
+		}
+	}
+
+	// Record which cells were used
+	m.matched = len(used)
+	for i, cell := range header {
+		if !used[i] && strings.TrimSpace(cell) != "" {
+			m.unmatched = append(m.unmatched, strings.TrimSpace(cell))
+		}
+	}
+
+	return m
+}
+
+// ValidateProfile checks that an import profile's mappings refer to order columns and can produce values
+func ValidateProfile(profile *models.ImportProfile) error {
+	order := models.Order{}
+	seen := make(map[string]bool)
+
+	for _, m := range profile.Mappings {
+		if _, ok := order.Get(m.Key); !ok {
+			return fmt.Errorf("Unknown column: %s", m.Key)
+		}
+
+		if seen[m.Key] {
+			return fmt.Errorf("Column %s is mapped more than once", m.Key)
+		}
+		seen[m.Key] = true
+
+		if len(m.Headers) == 0 && m.Value == "" {
+			return fmt.Errorf("Column %s requires a source column or a fixed value", m.Key)
+		}
+
+		if !isTransform(m.Transform) {
+			return fmt.Errorf("Unknown transform for column %s: %s", m.Key, m.Transform)
+		}
+	}
+
+	if len(seen) == 0 {
+		return errors.New("At least one column must be mapped")
+	}
+
+	return nil
+}
+
+// applyTransform applies a named transform to a value
+func applyTransform(transform, value string) string {
+	switch transform {
+	case models.ImportTransformUpper:
+		return strings.ToUpper(value)
+	case models.ImportTransformLower:
+		return strings.ToLower(value)
+	case models.ImportTransformTitle:
+		prev := ' '
+		return strings.Map(func(r rune) rune {
+			defer func() { prev = r }()
+			if unicode.IsSpace(prev) || prev == '-' {
+				return unicode.ToUpper(r)
+			}
+			return unicode.ToLower(r)
+		}, value)
+	case models.ImportTransformDigits:
+		return strings.Map(func(r rune) rune {
+			if unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, value)
+	}
+
+	return value
+}
+
+// isTransform determines if a given transform is supported
+func isTransform(transform string) bool {
+	for _, t := range models.ImportTransforms {
+		if t == transform {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/mikestefanello/otcscanner/models"
+)
+
+var testProfile = models.ImportProfile{
+	Name: "marketplace",
+	Mappings: []models.ImportMapping{
+		{Key: "packageId", Headers: []string{"Tracking"}, Transform: models.ImportTransformUpper},
+		{Key: "recipientAddressLine1", Headers: []string{"Street", "Unit"}, Separator: ", "},
+		{Key: "recipientCity", Headers: []string{"Town"}, Transform: models.ImportTransformTitle},
+		{Key: "recipientPhoneNumber", Headers: []string{"Phone"}, Transform: models.ImportTransformDigits},
+		{Key: "service", Value: "EXPRESS"},
+	},
+}
+
+func TestReadProfile(t *testing.T) {
+	tests := []struct {
+		name          string
+		file          string
+		opts          Options
+		wantOrders    models.Orders
+		wantProfile   string
+		wantUnmatched []string
+	}{
+		{
+			name: "detected profile",
+			file: "Tracking,Street,Unit,Town,Phone,Weight,Gift message\npkg1,1 Main St,Apt 2,NEW YORK,(555) 123-4567,2,Happy birthday\npkg2,2 Elm St,,springfield,,1,\n",
+			opts: Options{Profiles: []models.ImportProfile{testProfile}},
+			wantOrders: models.Orders{
+				{PackageID: "PKG1", RecipientAddressLine1: "1 Main St, Apt 2", RecipientCity: "New York", RecipientPhoneNumber: "5551234567", Weight: "2", Service: "EXPRESS"},
+				{PackageID: "PKG2", RecipientAddressLine1: "2 Elm St", RecipientCity: "Springfield", Weight: "1", Service: "EXPRESS"},
+			},
+			wantProfile:   "marketplace",
+			wantUnmatched: []string{"Gift message"},
+		},
+		{
+			name: "standard headers match more columns than the profile",
+			file: "Package ID,Recipient City,Tracking\nPKG1,Springfield,T1\n",
+			opts: Options{Profiles: []models.ImportProfile{testProfile}},
+			wantOrders: models.Orders{
+				{PackageID: "PKG1", RecipientCity: "Springfield"},
+			},
+			wantUnmatched: []string{"Tracking"},
+		},
+		{
+			name: "selected profile",
+			file: "Tracking,Town\npkg1,springfield\n",
+			opts: Options{Profile: &testProfile},
+			wantOrders: models.Orders{
+				{PackageID: "PKG1", RecipientCity: "Springfield", Service: "EXPRESS"},
+			},
+			wantProfile: "marketplace",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.Format = "csv"
+			orders, result, err := New(nil, validator.New()).Read(strings.NewReader(tc.file), tc.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(orders, tc.wantOrders) {
+				t.Errorf("expected orders %+v, got %+v", tc.wantOrders, orders)
+			}
+			if result.Profile != tc.wantProfile {
+				t.Errorf("expected profile %q, got %q", tc.wantProfile, result.Profile)
+			}
+			if !reflect.DeepEqual(result.Unmatched, tc.wantUnmatched) {
+				t.Errorf("expected unmatched columns %v, got %v", tc.wantUnmatched, result.Unmatched)
+			}
+		})
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		mappings []models.ImportMapping
+		wantErr  string
+	}{
+		{
+			name:     "valid",
+			mappings: testProfile.Mappings,
+		},
+		{
+			name:     "unknown column",
+			mappings: []models.ImportMapping{{Key: "trackingNumber", Headers: []string{"Tracking"}}},
+			wantErr:  "Unknown column: trackingNumber",
+		},
+		{
+			name: "column mapped twice",
+			mappings: []models.ImportMapping{
+				{Key: "packageId", Headers: []string{"Tracking"}},
+				{Key: "packageId", Headers: []string{"Reference"}},
+			},
+			wantErr: "Column packageId is mapped more than once",
+		},
+		{
+			name:     "no source column or value",
+			mappings: []models.ImportMapping{{Key: "packageId"}},
+			wantErr:  "Column packageId requires a source column or a fixed value",
+		},
+		{
+			name:     "unknown transform",
+			mappings: []models.ImportMapping{{Key: "packageId", Headers: []string{"Tracking"}, Transform: "reverse"}},
+			wantErr:  "Unknown transform for column packageId: reverse",
+		},
+		{
+			name:    "no mappings",
+			wantErr: "At least one column must be mapped",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateProfile(&models.ImportProfile{Name: "test", Mappings: tc.mappings})
+
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("expected error %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// xlsxRowReader reads the rows of a worksheet in an Excel workbook
+type xlsxRowReader struct {
+	file *excelize.File
+	rows *excelize.Rows
+}
+
+// newXLSXRowReader creates a new row reader for a given sheet of a workbook, or the first sheet if
+// no sheet is specified
+func newXLSXRowReader(r io.Reader, sheet string) (rowReader, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open the workbook: %s", err.Error())
+	}
+
+	sheets := f.GetSheetList()
+	if sheet == "" && len(sheets) > 0 {
+		sheet = sheets[0]
+	}
+
+	found := false
+	for _, s := range sheets {
+		if s == sheet {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		f.Close()
+		return nil, fmt.Errorf("Sheet %q not found. Available sheets: %s", sheet, strings.Join(sheets, ", "))
+	}
+
+	rows, err := f.Rows(sheet)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &xlsxRowReader{file: f, rows: rows}, nil
+}
+
+func (r *xlsxRowReader) Next() ([]string, error) {
+	if !r.rows.Next() {
+		err := r.rows.Error()
+		if err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	return r.rows.Columns()
+}
+
+func (r *xlsxRowReader) Close() error {
+	r.rows.Close()
+	return r.file.Close()
+}
@@ -0,0 +1,122 @@
+package importer
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestReadXLSX(t *testing.T) {
+	tests := []struct {
+		name       string
+		sheet      string
+		rows       [][]string
+		opts       Options
+		wantOrders models.Orders
+		wantErr    string
+	}{
+		{
+			name: "standard headers",
+			rows: [][]string{
+				{"Package ID", "Recipient City", "Weight"},
+				{"PKG1", "Springfield", "2.5"},
+				{"PKG2", "Shelbyville", "1"},
+			},
+			wantOrders: models.Orders{
+				{PackageID: "PKG1", RecipientCity: "Springfield", Weight: "2.5"},
+				{PackageID: "PKG2", RecipientCity: "Shelbyville", Weight: "1"},
+			},
+		},
+		{
+			name: "title rows before the header",
+			rows: [][]string{
+				{"Daily orders"},
+				{"Exported 2021-03-04"},
+				{},
+				{"package id ", " RECIPIENT CITY"},
+				{"PKG1", " Springfield "},
+				{},
+				{"PKG2", "Shelbyville"},
+			},
+			wantOrders: models.Orders{
+				{PackageID: "PKG1", RecipientCity: "Springfield"},
+				{PackageID: "PKG2", RecipientCity: "Shelbyville"},
+			},
+		},
+		{
+			name:  "selected sheet",
+			sheet: "Orders",
+			rows: [][]string{
+				{"Package ID"},
+				{"PKG1"},
+			},
+			opts:       Options{Sheet: "Orders"},
+			wantOrders: models.Orders{{PackageID: "PKG1"}},
+		},
+		{
+			name:    "missing sheet",
+			sheet:   "Orders",
+			rows:    [][]string{{"Package ID"}, {"PKG1"}},
+			opts:    Options{Sheet: "Returns"},
+			wantErr: `Sheet "Returns" not found. Available sheets: Summary, Orders`,
+		},
+		{
+			name:    "no header row",
+			rows:    [][]string{{"a", "b"}, {"c", "d"}},
+			wantErr: "Unable to find a header row with recognized column names",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Write the rows to the first sheet, or to a named sheet after a summary sheet
+			f := excelize.NewFile()
+			sheet := f.GetSheetName(0)
+			if tc.sheet != "" {
+				if err := f.SetSheetName(sheet, "Summary"); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := f.NewSheet(tc.sheet); err != nil {
+					t.Fatal(err)
+				}
+				sheet = tc.sheet
+			}
+			for i, row := range tc.rows {
+				values := make([]interface{}, len(row))
+				for j, v := range row {
+					values[j] = v
+				}
+				cell, _ := excelize.CoordinatesToCellName(1, i+1)
+				if err := f.SetSheetRow(sheet, cell, &values); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var buf bytes.Buffer
+			if err := f.Write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			tc.opts.Format = "xlsx"
+			orders, _, err := New(nil, validator.New()).Read(&buf, tc.opts)
+
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(orders, tc.wantOrders) {
+				t.Errorf("expected orders %+v, got %+v", tc.wantOrders, orders)
+			}
+		})
+	}
+}
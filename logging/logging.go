@@ -0,0 +1,116 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/mikestefanello/otcscanner/config"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Log formats
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+// HeaderRequestID is the header that carries the ID of a request, which is returned in every response
+// so a user reporting a problem can be matched to the log
+const HeaderRequestID = "X-Request-ID"
+
+// quietRoutes are the routes whose requests are only logged at debug level, because they are made
+// frequently by orchestrators and monitoring, or by browsers for every page, rather than by users
+var quietRoutes = map[string]bool{
+	"/healthz":  true,
+	"/readyz":   true,
+	"/metrics":  true,
+	"/static/*": true,
+}
+
+// Configure sets the level and output format of the global logger
+func Configure(cfg config.LogConfig) error {
+	level, err := zerolog.ParseLevel(cfg.Level)
+	if err != nil {
+		return fmt.Errorf("Invalid log level: %s", cfg.Level)
+	}
+	zerolog.SetGlobalLevel(level)
+
+	switch cfg.Format {
+	case FormatJSON:
+	case FormatConsole:
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
+	default:
+		return fmt.Errorf("Invalid log format: %s", cfg.Format)
+	}
+
+	return nil
+}
+
+// Middleware logs every request with a logger that includes the request's ID, and stores that logger
+// in the request context so every line logged while handling the request can be correlated. The
+// request ID is taken from the chi RequestID middleware, which must be used first
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := middleware.GetReqID(r.Context())
+		w.Header().Set(HeaderRequestID, id)
+
+		logger := log.With().Str("requestId", id).Logger()
+		ctx := logger.WithContext(r.Context())
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		defer func() {
+			route := "unmatched"
+			if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			event := FromContext(ctx).Info()
+			if quietRoutes[route] {
+				event = FromContext(ctx).Debug()
+			}
+
+			event.
+				Str("method", r.Method).
+				Str("route", route).
+				Str("path", r.URL.Path).
+				Int("status", status).
+				Int("bytes", ww.BytesWritten()).
+				Dur("duration", time.Since(start)).
+				Msg("Handled request.")
+		}()
+
+		next.ServeHTTP(ww, r.WithContext(ctx))
+	})
+}
+
+// FromContext returns the logger of the request a given context belongs to, or the global logger if
+// the context does not belong to a request
+func FromContext(ctx context.Context) *zerolog.Logger {
+	// Ctx returns a shared disabled logger when the context has none
+	if logger := zerolog.Ctx(ctx); logger != zerolog.Ctx(context.Background()) {
+		return logger
+	}
+	return &log.Logger
+}
+
+// SetActor adds the user or API token making a request to the request's logger, so it is included in
+// every line logged afterwards, including the line logged when the request is complete
+func SetActor(ctx context.Context, actor string) {
+	if logger := zerolog.Ctx(ctx); logger != zerolog.Ctx(context.Background()) {
+		logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+			return c.Str("actor", actor)
+		})
+	}
+}
@@ -1,43 +1,134 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"net/http"
-
-	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/mikestefanello/otcscanner/config"
-	"github.com/mikestefanello/otcscanner/handlers"
-	"github.com/mikestefanello/otcscanner/repository"
-	"github.com/mikestefanello/otcscanner/router"
+	"github.com/mikestefanello/otcscanner/logging"
 )
 
 // TODO: Testing
 
+// command is a subcommand of the application
+type command struct {
+	Name    string
+	Usage   string
+	Summary string
+	Run     func(cfg config.Config, fs *flag.FlagSet, args []string) error
+}
+
+// commands contains the subcommands of the application. The first is run when none is given
+var commands = []command{
+	{"serve", "serve", "Run the web application", serve},
+	{"import", "import [flags] <file>", "Import orders from a CSV, XLSX or JSON Lines file, skipping those which already exist", importOrders},
+	{"export", "export [flags]", "Export orders to a file or standard output", exportOrders},
+	{"purge", "purge (--completed | --all) --reason <reason> [--approver <user>] [flags]", "Delete orders from the database", purgeOrders},
+	{"stats", "stats", "Show order counts", showStats},
+	{"migrate", "migrate", "Create the database indexes", migrate},
+	{"config", "config print", "Show the effective configuration with secrets redacted", configCommand},
+}
+
+// errUsage indicates that a command was given invalid arguments, after its usage has been shown
+var errUsage = errors.New("Invalid arguments")
+
 func main() {
+	name, args := commands[0].Name, os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		printUsage(os.Stdout)
+		return
+	}
+
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", name)
+		printUsage(os.Stderr)
+		os.Exit(2)
+	}
+
 	// Load application configuration
 	cfg, err := config.GetConfig()
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	// Create an order repository
-	repo, err := repository.NewMongoOrderRepository(cfg.Mongo)
+	// Set the log level and format
+	err = logging.Configure(cfg.Log)
 	if err != nil {
-		panic(fmt.Sprintf("Unable to connect to repository: %s", err.Error()))
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	// Create an HTTP handler
-	handler := handlers.NewHTTPHandler(cfg, repo)
+	err = cmd.Run(cfg, newFlagSet(cmd), args)
+	switch {
+	case err == flag.ErrHelp:
+	case err == errUsage:
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
 
-	// Load the router
-	r := router.NewRouter(cfg, handler)
+// findCommand returns the command with a given name
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
 
-	// Start the server
-	addr := fmt.Sprintf("%s:%d", cfg.HTTP.Hostname, cfg.HTTP.Port)
-	log.Info().Str("on", addr).Msg("Server started")
-	err = http.ListenAndServe(addr, r)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Server terminated")
+// printUsage writes the list of commands to a given writer
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", cmd.Name, cmd.Summary)
 	}
+	fmt.Fprintf(w, "\nThe %s command is run if none is given. Run \"%s <command> -h\" for a command's flags.\n", commands[0].Name, os.Args[0])
+}
+
+// newFlagSet creates the flag set of a given command, which shows the command's usage on errors
+func newFlagSet(cmd command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s\n\n%s.\n", os.Args[0], cmd.Usage, cmd.Summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses the arguments of a command, returning errUsage if they are invalid
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err != nil && err != flag.ErrHelp {
+		return errUsage
+	}
+	return err
+}
+
+// usageError shows a problem with the arguments of a command and its usage, and returns errUsage
+func usageError(fs *flag.FlagSet, format string, args ...interface{}) error {
+	fmt.Fprintf(fs.Output(), format+"\n\n", args...)
+	fs.Usage()
+	return errUsage
+}
+
+// commandContext returns a context which is cancelled when the command receives a signal to stop, so
+// long running database operations are interrupted
+func commandContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 }
@@ -0,0 +1,186 @@
+package manifest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mikestefanello/otcscanner/models"
+)
+
+// EDI delimiters
+const (
+	ediElementSeparator    = "*"
+	ediSubElementSeparator = ">"
+	ediSegmentTerminator   = "~\n"
+)
+
+// ediWriter writes orders as an X12 856 ship notice/manifest. The interchange contains a single
+// transaction set with one shipment level loop followed by a package level loop for each order:
+//
+//	ISA, GS, ST, BSN, DTM, HL (shipment), TD5, REF (manifest)
+//	HL (package), REF (package ID), N1, N3, N4 (recipient), MEA (weight and dimensions), PID (item)
+//	CTT, SE, GE, IEA
+//
+// The control numbers are derived from the time the manifest file was created, and are never zero
+type ediWriter struct {
+	w           *bufio.Writer
+	header      Header
+	control     int64
+	started     bool
+	segments    int
+	hl          int
+	totalWeight float64
+}
+
+// NewEDIWriter creates a writer which writes orders as an X12 856 ship notice/manifest
+func NewEDIWriter(w io.Writer, header Header) Writer {
+	return &ediWriter{
+		w:       bufio.NewWriter(w),
+		header:  header,
+		control: header.Created.Unix()%999999999 + 1,
+	}
+}
+
+func (w *ediWriter) Write(order *models.Order) error {
+	w.writeHeader()
+
+	weight, unit := orderWeight(order)
+	w.totalWeight += weight
+	w.hl++
+
+	w.segment("HL", strconv.Itoa(w.hl), "1", "P")
+	w.segment("REF", "2I", order.PackageID)
+	if name := recipientName(order); name != "" {
+		w.segment("N1", "ST", name)
+	}
+	w.segment("N3", order.RecipientAddressLine1, order.RecipientAddressLine2)
+	w.segment("N4", order.RecipientCity, order.RecipientProvince, order.RecipientPostalCode, order.RecipientCountryCode)
+	w.segment("MEA", "PD", "G", ediNumber(weight), unit)
+
+	if order.Length != "" && order.Width != "" && order.Height != "" {
+		length, width, height, unit := orderDimensions(order)
+		w.segment("MEA", "PD", "LN", ediNumber(length), unit)
+		w.segment("MEA", "PD", "WD", ediNumber(width), unit)
+		w.segment("MEA", "PD", "HT", ediNumber(height), unit)
+	}
+
+	if order.ItemDescription != "" {
+		w.segment("PID", "F", "", "", "", order.ItemDescription)
+	}
+
+	return w.err()
+}
+
+func (w *ediWriter) Close() error {
+	w.writeHeader()
+
+	w.segment("CTT", strconv.Itoa(w.hl), ediNumber(w.totalWeight))
+
+	// The segment count includes the ST and SE segments, but not the envelope
+	w.segment("SE", strconv.Itoa(w.segments+1), "0001")
+	w.envelope("GE", "1", strconv.FormatInt(w.control, 10))
+	w.envelope("IEA", "1", fmt.Sprintf("%09d", w.control))
+
+	return w.w.Flush()
+}
+
+// writeHeader writes the interchange, group and transaction set headers, along with the shipment
+// level loop, if they have not been written yet
+func (w *ediWriter) writeHeader() {
+	if w.started {
+		return
+	}
+	w.started = true
+
+	created := w.header.Created
+	w.envelope("ISA",
+		"00", fmt.Sprintf("%-10s", ""),
+		"00", fmt.Sprintf("%-10s", ""),
+		"ZZ", ediFixed(w.header.SenderID, 15),
+		"ZZ", ediFixed(w.header.ReceiverID, 15),
+		created.Format("060102"),
+		created.Format("1504"),
+		"U",
+		"00401",
+		fmt.Sprintf("%09d", w.control),
+		"0",
+		"P",
+		ediSubElementSeparator,
+	)
+	w.envelope("GS", "SH", ediValue(w.header.SenderID), ediValue(w.header.ReceiverID),
+		created.Format("20060102"), created.Format("1504"), strconv.FormatInt(w.control, 10), "X", "004010")
+
+	w.segment("ST", "856", "0001")
+	w.segment("BSN", "00", w.header.ID, created.Format("20060102"), created.Format("1504"))
+	w.segment("DTM", "011", created.Format("20060102"))
+
+	w.hl++
+	w.segment("HL", strconv.Itoa(w.hl), "", "S")
+	w.segment("TD5", "", "", "", "", w.header.Service)
+	w.segment("REF", "MB", w.header.ID)
+}
+
+// segment writes a segment within the transaction set, omitting trailing empty elements.
+// Segments without any elements are skipped
+func (w *ediWriter) segment(id string, elements ...string) {
+	for i := range elements {
+		elements[i] = ediValue(elements[i])
+	}
+
+	for len(elements) > 0 && elements[len(elements)-1] == "" {
+		elements = elements[:len(elements)-1]
+	}
+
+	if len(elements) == 0 {
+		return
+	}
+
+	w.envelope(id, elements...)
+	w.segments++
+}
+
+// envelope writes a segment as given, without counting it as part of the transaction set
+func (w *ediWriter) envelope(id string, elements ...string) {
+	w.w.WriteString(id)
+	for _, e := range elements {
+		w.w.WriteString(ediElementSeparator)
+		w.w.WriteString(e)
+	}
+	w.w.WriteString(ediSegmentTerminator)
+}
+
+// err returns an error from writing to the underlying writer, if any
+func (w *ediWriter) err() error {
+	_, err := w.w.Write(nil)
+	return err
+}
+
+// ediDelimiters replaces delimiters within element values
+var ediDelimiters = strings.NewReplacer(
+	ediElementSeparator, " ",
+	ediSubElementSeparator, " ",
+	"~", " ",
+)
+
+// ediValue converts a value to upper case ASCII and removes any delimiters
+func ediValue(value string) string {
+	return strings.TrimSpace(ediDelimiters.Replace(toASCII(value)))
+}
+
+// ediFixed formats a value as a fixed length element, as required by the ISA segment
+func ediFixed(value string, width int) string {
+	value = ediValue(value)
+	if len(value) > width {
+		value = value[:width]
+	}
+	return fmt.Sprintf("%-*s", width, value)
+}
+
+// ediNumber formats a decimal number with up to two decimal places and no trailing zeros
+func ediNumber(value float64) string {
+	return strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,130 @@
+package manifest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/mikestefanello/otcscanner/models"
+)
+
+// fixedWidthLineEnding terminates each record in a fixed-width manifest
+const fixedWidthLineEnding = "\r\n"
+
+// centimetresPerInch converts dimensions scanned in metric, as the fixed-width layout has no unit for them
+const centimetresPerInch = 2.54
+
+// fixedWidthWriter writes orders as a fixed-width manifest. Every record starts with its type:
+//
+//	H  header   manifest ID (20), service (10), date YYYYMMDD (8), time HHMMSS (6), sender ID (15)
+//	D  detail   package ID (30), recipient name (35), address line 1 (35), address line 2 (35), city (30),
+//	            province (10), postal code (10), country code (2), weight in hundredths (9), weight unit (2),
+//	            pieces (4), length, width and height in hundredths of an inch (7 each), value in cents (10),
+//	            item description (40), account (10)
+//	T  trailer  detail record count (9), total weight in hundredths (12)
+//
+// Text fields are upper case, left aligned and padded with spaces. Numeric fields are right aligned
+// and padded with zeros. Values that are too long are truncated
+type fixedWidthWriter struct {
+	w           *bufio.Writer
+	header      Header
+	started     bool
+	count       int
+	totalWeight float64
+}
+
+// NewFixedWidthWriter creates a writer which writes orders as a fixed-width manifest
+func NewFixedWidthWriter(w io.Writer, header Header) Writer {
+	return &fixedWidthWriter{
+		w:      bufio.NewWriter(w),
+		header: header,
+	}
+}
+
+func (w *fixedWidthWriter) Write(order *models.Order) error {
+	w.writeHeader()
+
+	weight, unit := orderWeight(order)
+	length, width, height, dimensionUnit := orderDimensions(order)
+	if dimensionUnit == "CM" {
+		length, width, height = length/centimetresPerInch, width/centimetresPerInch, height/centimetresPerInch
+	}
+	w.count++
+	w.totalWeight += weight
+
+	w.w.WriteString("D")
+	w.text(order.PackageID, 30)
+	w.text(recipientName(order), 35)
+	w.text(order.RecipientAddressLine1, 35)
+	w.text(order.RecipientAddressLine2, 35)
+	w.text(order.RecipientCity, 30)
+	w.text(order.RecipientProvince, 10)
+	w.text(order.RecipientPostalCode, 10)
+	w.text(order.RecipientCountryCode, 2)
+	w.hundredths(weight, 9)
+	w.text(unit, 2)
+	w.number(int64(parseCount(order.PackagePhysicalCount)), 4)
+	w.hundredths(length, 7)
+	w.hundredths(width, 7)
+	w.hundredths(height, 7)
+	w.hundredths(parseNumber(order.UnitValueUSD)*float64(parseCount(order.Quantity)), 10)
+	w.text(order.ItemDescription, 40)
+	w.text(order.Account, 10)
+	_, err := w.w.WriteString(fixedWidthLineEnding)
+
+	return err
+}
+
+func (w *fixedWidthWriter) Close() error {
+	w.writeHeader()
+
+	w.w.WriteString("T")
+	w.number(int64(w.count), 9)
+	w.hundredths(w.totalWeight, 12)
+	w.w.WriteString(fixedWidthLineEnding)
+
+	return w.w.Flush()
+}
+
+// writeHeader writes the header record, if it has not been written yet
+func (w *fixedWidthWriter) writeHeader() {
+	if w.started {
+		return
+	}
+	w.started = true
+
+	w.w.WriteString("H")
+	w.text(w.header.ID, 20)
+	w.text(w.header.Service, 10)
+	w.text(w.header.Created.Format("20060102"), 8)
+	w.text(w.header.Created.Format("150405"), 6)
+	w.text(w.header.SenderID, 15)
+	w.w.WriteString(fixedWidthLineEnding)
+}
+
+// text writes a left aligned text field of a given width
+func (w *fixedWidthWriter) text(value string, width int) {
+	value = toASCII(value)
+	if len(value) > width {
+		value = value[:width]
+	}
+	w.w.WriteString(value)
+	w.w.WriteString(strings.Repeat(" ", width-len(value)))
+}
+
+// number writes a zero padded numeric field of a given width, using the largest value that fits
+// if the number is too large
+func (w *fixedWidthWriter) number(value int64, width int) {
+	max := int64(math.Pow10(width)) - 1
+	if value > max {
+		value = max
+	}
+	fmt.Fprintf(w.w, "%0*d", width, value)
+}
+
+// hundredths writes a decimal number as a zero padded numeric field in hundredths, so 1.5 is written as 150
+func (w *fixedWidthWriter) hundredths(value float64, width int) {
+	w.number(int64(math.Round(value*100)), width)
+}
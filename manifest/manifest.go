@@ -0,0 +1,174 @@
+package manifest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikestefanello/otcscanner/models"
+)
+
+// Header describes the manifest that orders are being written to
+type Header struct {
+	// ID identifies the closed manifest
+	ID string
+
+	// Service is the service, and therefore carrier, that the manifest is for
+	Service string
+
+	// SenderID identifies us to the carrier
+	SenderID string
+
+	// ReceiverID identifies the carrier
+	ReceiverID string
+
+	// Created is the time the manifest file was created
+	Created time.Time
+}
+
+// Writer writes orders to a carrier manifest file
+type Writer interface {
+	// Write writes a single order
+	Write(order *models.Order) error
+
+	// Close writes any trailing records and completes the file. It does not close the underlying writer
+	Close() error
+}
+
+// Format describes a carrier manifest file format
+type Format struct {
+	// Name identifies the format
+	Name string
+
+	// Extension is the file extension of manifests in this format
+	Extension string
+
+	// ContentType is the MIME type of manifests in this format
+	ContentType string
+
+	// NewWriter creates a writer for this format
+	NewWriter func(w io.Writer, header Header) Writer
+}
+
+// formats contains the supported manifest formats, keyed by name
+var formats = map[string]Format{
+	"edi": {
+		Name:        "edi",
+		Extension:   "edi",
+		ContentType: "application/edi-x12",
+		NewWriter:   NewEDIWriter,
+	},
+	"fixed": {
+		Name:        "fixed",
+		Extension:   "txt",
+		ContentType: "text/plain",
+		NewWriter:   NewFixedWidthWriter,
+	},
+}
+
+// GetFormat returns the manifest format with a given name
+func GetFormat(name string) (Format, bool) {
+	f, ok := formats[name]
+	return f, ok
+}
+
+// FormatNames returns the names of all supported manifest formats, sorted
+func FormatNames() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateServiceFormats checks that every service is mapped to a supported manifest format
+func ValidateServiceFormats(formats map[string]string) error {
+	for service, name := range formats {
+		if _, ok := GetFormat(name); !ok {
+			return fmt.Errorf("Unsupported manifest format for service %s: %s", service, name)
+		}
+	}
+	return nil
+}
+
+// orderWeight returns the weight of an order and its unit. The scanned weight, in the unit system it
+// was scanned in, is preferred over the weight and unit provided when the order was imported
+func orderWeight(order *models.Order) (float64, string) {
+	if order.Weight != "" {
+		if order.IsMetric() {
+			return parseNumber(order.Weight), "KG"
+		}
+		return parseNumber(order.Weight), "LB"
+	}
+
+	return parseNumber(order.PackageWeight), weightUnit(order.WeightUnit)
+}
+
+// orderDimensions returns the scanned length, width and height of an order and their unit, which is
+// centimetres if the order was scanned in metric and otherwise inches
+func orderDimensions(order *models.Order) (length, width, height float64, unit string) {
+	unit = "IN"
+	if order.IsMetric() {
+		unit = "CM"
+	}
+	return parseNumber(order.Length), parseNumber(order.Width), parseNumber(order.Height), unit
+}
+
+// weightUnit normalizes a weight unit to the two letter code carriers expect, defaulting to pounds
+func weightUnit(unit string) string {
+	switch strings.ToUpper(strings.TrimSpace(unit)) {
+	case "KG", "KGS", "KILOGRAM", "KILOGRAMS":
+		return "KG"
+	case "OZ", "OUNCE", "OUNCES":
+		return "OZ"
+	default:
+		return "LB"
+	}
+}
+
+// parseNumber parses a decimal number, returning zero if it is missing or invalid
+func parseNumber(value string) float64 {
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// parseCount parses a count, returning one if it is missing or invalid
+func parseCount(value string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// recipientName returns the name of the recipient of an order, falling back to the business name
+func recipientName(order *models.Order) string {
+	name := strings.TrimSpace(order.RecipientFirstName + " " + order.RecipientLastName)
+	if name == "" {
+		return order.RecipientBusinessName
+	}
+	return name
+}
+
+// toASCII converts a value to upper case printable ASCII, replacing any other characters with spaces,
+// since carrier systems commonly reject anything else and multi-byte characters break fixed-width records
+func toASCII(value string) string {
+	var b strings.Builder
+	b.Grow(len(value))
+
+	for _, r := range strings.ToUpper(value) {
+		if r < ' ' || r > '~' {
+			r = ' '
+		}
+		b.WriteRune(r)
+	}
+
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,330 @@
+package manifest
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikestefanello/otcscanner/models"
+)
+
+var testHeader = Header{
+	ID:         "20210304-150607",
+	Service:    "EXPRESS",
+	SenderID:   "OTC",
+	ReceiverID: "CARRIER",
+	Created:    time.Date(2021, 3, 4, 15, 6, 7, 0, time.UTC),
+}
+
+var testOrders = []models.Order{
+	{
+		PackageID:             "PKG1",
+		RecipientFirstName:    "Jane",
+		RecipientLastName:     "Doe~Smith",
+		RecipientAddressLine1: "1 Main St*Apt 2",
+		RecipientCity:         "Springfield",
+		RecipientProvince:     "IL",
+		RecipientPostalCode:   "62701",
+		RecipientCountryCode:  "US",
+		PackageWeight:         "2.50",
+		WeightUnit:            "kg",
+		PackagePhysicalCount:  "2",
+		Length:                "10",
+		Width:                 "8.25",
+		Height:                "4",
+		UnitValueUSD:          "12.5",
+		Quantity:              "3",
+		ItemDescription:       "Books",
+		Account:               "ACME",
+	},
+	{
+		PackageID:             "PKG2",
+		RecipientBusinessName: "Zoë's Café",
+		PackageWeight:         "9",
+		Weight:                "1",
+	},
+}
+
+// testMetricOrder was scanned at a metric station, so its scanned weight and dimensions are in kilograms
+// and centimetres, whatever unit its imported weight is in
+var testMetricOrder = models.Order{
+	PackageID:     "PKG3",
+	PackageWeight: "5",
+	WeightUnit:    "LB",
+	Weight:        "1.2",
+	Length:        "30",
+	Width:         "20",
+	Height:        "10",
+	UnitSystem:    models.UnitSystemMetric,
+}
+
+func TestEDIWriter(t *testing.T) {
+	envelope := []string{
+		"ISA*00*          *00*          *ZZ*OTC            *ZZ*CARRIER        *210304*1506*U*00401*614870369*0*P*>",
+		"GS*SH*OTC*CARRIER*20210304*1506*614870369*X*004010",
+		"ST*856*0001",
+		"BSN*00*20210304-150607*20210304*1506",
+		"DTM*011*20210304",
+		"HL*1**S",
+		"TD5*****EXPRESS",
+		"REF*MB*20210304-150607",
+	}
+
+	tests := []struct {
+		name   string
+		orders []models.Order
+		want   []string
+	}{
+		{
+			name:   "empty manifest",
+			orders: nil,
+			want: append(append([]string{}, envelope...),
+				"CTT*1*0",
+				"SE*8*0001",
+				"GE*1*614870369",
+				"IEA*1*614870369",
+			),
+		},
+		{
+			name:   "orders",
+			orders: testOrders,
+			want: append(append([]string{}, envelope...),
+				"HL*2*1*P",
+				"REF*2I*PKG1",
+				"N1*ST*JANE DOE SMITH",
+				"N3*1 MAIN ST APT 2",
+				"N4*SPRINGFIELD*IL*62701*US",
+				"MEA*PD*G*2.5*KG",
+				"MEA*PD*LN*10*IN",
+				"MEA*PD*WD*8.25*IN",
+				"MEA*PD*HT*4*IN",
+				"PID*F****BOOKS",
+				"HL*3*1*P",
+				"REF*2I*PKG2",
+				"N1*ST*ZO 'S CAF",
+				"MEA*PD*G*1*LB",
+				"CTT*3*3.5",
+				"SE*22*0001",
+				"GE*1*614870369",
+				"IEA*1*614870369",
+			),
+		},
+		{
+			name:   "metric scan",
+			orders: []models.Order{testMetricOrder},
+			want: append(append([]string{}, envelope...),
+				"HL*2*1*P",
+				"REF*2I*PKG3",
+				"MEA*PD*G*1.2*KG",
+				"MEA*PD*LN*30*CM",
+				"MEA*PD*WD*20*CM",
+				"MEA*PD*HT*10*CM",
+				"CTT*2*1.2",
+				"SE*14*0001",
+				"GE*1*614870369",
+				"IEA*1*614870369",
+			),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewEDIWriter(&buf, testHeader)
+			for i := range tc.orders {
+				if err := w.Write(&tc.orders[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got := buf.String()
+			want := strings.Join(tc.want, ediSegmentTerminator) + ediSegmentTerminator
+			if got != want {
+				t.Errorf("unexpected manifest:\n%s\nexpected:\n%s", got, want)
+			}
+		})
+	}
+}
+
+// fixedWidthFields splits a fixed-width record in to fields of given widths, after the record type
+func fixedWidthFields(t *testing.T, record string, widths ...int) []string {
+	t.Helper()
+
+	total := 1
+	for _, w := range widths {
+		total += w
+	}
+	if len(record) != total {
+		t.Fatalf("expected a record of %d characters, got %d: %q", total, len(record), record)
+	}
+
+	fields := []string{record[:1]}
+	pos := 1
+	for _, w := range widths {
+		fields = append(fields, record[pos:pos+w])
+		pos += w
+	}
+	return fields
+}
+
+func TestFixedWidthWriter(t *testing.T) {
+	detailWidths := []int{30, 35, 35, 35, 30, 10, 10, 2, 9, 2, 4, 7, 7, 7, 10, 40, 10}
+
+	tests := []struct {
+		name    string
+		orders  []models.Order
+		details [][]string
+		trailer []string
+	}{
+		{
+			name:    "empty manifest",
+			trailer: []string{"T", "000000000", "000000000000"},
+		},
+		{
+			name:   "orders",
+			orders: testOrders,
+			details: [][]string{
+				{
+					"D",
+					"PKG1" + strings.Repeat(" ", 26),
+					"JANE DOE~SMITH" + strings.Repeat(" ", 21),
+					"1 MAIN ST*APT 2" + strings.Repeat(" ", 20),
+					strings.Repeat(" ", 35),
+					"SPRINGFIELD" + strings.Repeat(" ", 19),
+					"IL        ",
+					"62701     ",
+					"US",
+					"000000250",
+					"KG",
+					"0002",
+					"0001000",
+					"0000825",
+					"0000400",
+					"0000003750",
+					"BOOKS" + strings.Repeat(" ", 35),
+					"ACME      ",
+				},
+				{
+					"D",
+					"PKG2" + strings.Repeat(" ", 26),
+					"ZO 'S CAF" + strings.Repeat(" ", 26),
+					strings.Repeat(" ", 35),
+					strings.Repeat(" ", 35),
+					strings.Repeat(" ", 30),
+					strings.Repeat(" ", 10),
+					strings.Repeat(" ", 10),
+					"  ",
+					"000000100",
+					"LB",
+					"0001",
+					"0000000",
+					"0000000",
+					"0000000",
+					"0000000000",
+					strings.Repeat(" ", 40),
+					strings.Repeat(" ", 10),
+				},
+			},
+			trailer: []string{"T", "000000002", "000000000350"},
+		},
+		{
+			name:   "metric scan dimensions are converted to inches",
+			orders: []models.Order{testMetricOrder},
+			details: [][]string{
+				{
+					"D",
+					"PKG3" + strings.Repeat(" ", 26),
+					strings.Repeat(" ", 35),
+					strings.Repeat(" ", 35),
+					strings.Repeat(" ", 35),
+					strings.Repeat(" ", 30),
+					strings.Repeat(" ", 10),
+					strings.Repeat(" ", 10),
+					"  ",
+					"000000120",
+					"KG",
+					"0001",
+					"0001181",
+					"0000787",
+					"0000394",
+					"0000000000",
+					strings.Repeat(" ", 40),
+					strings.Repeat(" ", 10),
+				},
+			},
+			trailer: []string{"T", "000000001", "000000000120"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewFixedWidthWriter(&buf, testHeader)
+			for i := range tc.orders {
+				if err := w.Write(&tc.orders[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got := buf.String()
+			if !strings.HasSuffix(got, fixedWidthLineEnding) {
+				t.Fatalf("expected the manifest to end with a line ending: %q", got)
+			}
+			records := strings.Split(strings.TrimSuffix(got, fixedWidthLineEnding), fixedWidthLineEnding)
+			if len(records) != len(tc.details)+2 {
+				t.Fatalf("expected %d records, got %d", len(tc.details)+2, len(records))
+			}
+
+			header := fixedWidthFields(t, records[0], 20, 10, 8, 6, 15)
+			wantHeader := []string{"H", "20210304-150607     ", "EXPRESS   ", "20210304", "150607", "OTC            "}
+			if !reflect.DeepEqual(header, wantHeader) {
+				t.Errorf("expected header %q, got %q", wantHeader, header)
+			}
+
+			for i, want := range tc.details {
+				if got := fixedWidthFields(t, records[i+1], detailWidths...); !reflect.DeepEqual(got, want) {
+					t.Errorf("expected detail %d to be %q, got %q", i+1, want, got)
+				}
+			}
+
+			trailer := fixedWidthFields(t, records[len(records)-1], 9, 12)
+			if !reflect.DeepEqual(trailer, tc.trailer) {
+				t.Errorf("expected trailer %q, got %q", tc.trailer, trailer)
+			}
+		})
+	}
+}
+
+func TestFixedWidthNumbers(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(w *fixedWidthWriter)
+		want  string
+	}{
+		{"text is truncated", func(w *fixedWidthWriter) { w.text("abcdef", 4) }, "ABCD"},
+		{"text is padded", func(w *fixedWidthWriter) { w.text(" ab ", 4) }, "AB  "},
+		{"numbers are padded", func(w *fixedWidthWriter) { w.number(42, 5) }, "00042"},
+		{"numbers which are too large are capped", func(w *fixedWidthWriter) { w.number(123456, 4) }, "9999"},
+		{"hundredths are rounded", func(w *fixedWidthWriter) { w.hundredths(1.239, 6) }, "000124"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewFixedWidthWriter(&buf, testHeader).(*fixedWidthWriter)
+			tc.write(w)
+			w.w.Flush()
+			if buf.String() != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/mikestefanello/otcscanner/models"
+)
+
+// namespace prefixes the names of all metrics
+const namespace = "otcscanner"
+
+// Scan outcomes
+const (
+	ScanSuccess  = "success"
+	ScanInvalid  = "invalid"
+	ScanNotFound = "not_found"
+	ScanError    = "error"
+)
+
+// unknownLabel replaces label values submitted by users which are not known, so they cannot create an
+// unbounded number of series
+const unknownLabel = "invalid"
+
+// Export triggers
+const (
+	ExportDownload  = "download"
+	ExportScheduled = "scheduled"
+)
+
+var (
+	scans = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scans_total",
+		Help:      "Scans processed, by service, account and outcome.",
+	}, []string{"service", "account", "outcome"})
+
+	scanDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "scan_duration_seconds",
+		Help:      "Time from receiving a scan to saving its order.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	importRows = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "import_rows_total",
+		Help:      "Rows of imported files, by whether they were accepted or rejected.",
+	}, []string{"result"})
+
+	exportDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "export_duration_seconds",
+		Help:      "Time taken to export orders, by trigger and format.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 600},
+	}, []string{"trigger", "format"})
+
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to serve HTTP requests, by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	repositoryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "repository_call_duration_seconds",
+		Help:      "Time taken by order repository calls, by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	repositoryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "repository_errors_total",
+		Help:      "Order repository calls that failed, by method.",
+	}, []string{"method"})
+)
+
+// Handler returns the handler which serves the metrics to Prometheus
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveScan records a processed scan and, if it was saved, how long that took. Services and accounts
+// which cannot be selected on the scan form are recorded as invalid
+func ObserveScan(service, account, outcome string, duration time.Duration) {
+	scans.WithLabelValues(knownLabel(service, models.ScanServices), knownLabel(account, models.ScanAccounts), outcome).Inc()
+	if outcome == ScanSuccess {
+		scanDuration.Observe(duration.Seconds())
+	}
+}
+
+// ObserveImport records the rows of an imported file that were accepted and rejected
+func ObserveImport(accepted, rejected int) {
+	importRows.WithLabelValues("accepted").Add(float64(accepted))
+	importRows.WithLabelValues("rejected").Add(float64(rejected))
+}
+
+// ObserveExport records how long an export took
+func ObserveExport(trigger, format string, duration time.Duration) {
+	exportDuration.WithLabelValues(trigger, format).Observe(duration.Seconds())
+}
+
+// Middleware records the number and duration of HTTP requests. Requests are labelled by their chi
+// route pattern rather than their path, so IDs in paths do not create a metric per order
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		defer func() {
+			route := "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+
+			httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(sw.status)).Inc()
+			httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+		}()
+
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// statusWriter records the status code written to a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Flush flushes the response, so streamed exports are still sent as they are written
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// knownLabel returns a label value if it is one of the known values, or unknownLabel otherwise
+func knownLabel(value string, known []string) string {
+	for _, k := range known {
+		if value == k {
+			return value
+		}
+	}
+	return unknownLabel
+}
@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+)
+
+// orderRepository records the latency and errors of the calls made to an order repository
+type orderRepository struct {
+	repo repository.OrderRepository
+}
+
+// InstrumentOrderRepository wraps an order repository so the latency and errors of every call are
+// recorded. Orders that are not found are not counted as errors
+func InstrumentOrderRepository(repo repository.OrderRepository) repository.OrderRepository {
+	return &orderRepository{
+		repo: repo,
+	}
+}
+
+// observe records a call to a given method which started at a given time and returned a given error
+func (r *orderRepository) observe(method string, start time.Time, err error) {
+	repositoryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil && err != repository.ErrNotFound {
+		repositoryErrors.WithLabelValues(method).Inc()
+	}
+}
+
+func (r *orderRepository) LoadByID(ctx context.Context, id string) (*models.Order, error) {
+	start := time.Now()
+	order, err := r.repo.LoadByID(ctx, id)
+	r.observe("LoadByID", start, err)
+	return order, err
+}
+
+func (r *orderRepository) LoadAll(ctx context.Context) (*models.Orders, error) {
+	start := time.Now()
+	orders, err := r.repo.LoadAll(ctx)
+	r.observe("LoadAll", start, err)
+	return orders, err
+}
+
+func (r *orderRepository) LoadCompleted(ctx context.Context) (*models.Orders, error) {
+	start := time.Now()
+	orders, err := r.repo.LoadCompleted(ctx)
+	r.observe("LoadCompleted", start, err)
+	return orders, err
+}
+
+func (r *orderRepository) LoadIncomplete(ctx context.Context) (*models.Orders, error) {
+	start := time.Now()
+	orders, err := r.repo.LoadIncomplete(ctx)
+	r.observe("LoadIncomplete", start, err)
+	return orders, err
+}
+
+func (r *orderRepository) LoadByQuery(ctx context.Context, query models.OrderQuery) (*models.Orders, error) {
+	start := time.Now()
+	orders, err := r.repo.LoadByQuery(ctx, query)
+	r.observe("LoadByQuery", start, err)
+	return orders, err
+}
+
+// IterateByQuery only records the time taken to start iterating, since the iterator is used for as
+// long as the caller needs
+func (r *orderRepository) IterateByQuery(ctx context.Context, query models.OrderQuery) (repository.OrderIterator, error) {
+	start := time.Now()
+	it, err := r.repo.IterateByQuery(ctx, query)
+	r.observe("IterateByQuery", start, err)
+	return it, err
+}
+
+func (r *orderRepository) DeleteAll(ctx context.Context, before time.Time) (int64, error) {
+	start := time.Now()
+	count, err := r.repo.DeleteAll(ctx, before)
+	r.observe("DeleteAll", start, err)
+	return count, err
+}
+
+func (r *orderRepository) DeleteCompleted(ctx context.Context, before time.Time) (int64, error) {
+	start := time.Now()
+	count, err := r.repo.DeleteCompleted(ctx, before)
+	r.observe("DeleteCompleted", start, err)
+	return count, err
+}
+
+func (r *orderRepository) UpdateOne(ctx context.Context, order *models.Order) error {
+	start := time.Now()
+	err := r.repo.UpdateOne(ctx, order)
+	r.observe("UpdateOne", start, err)
+	return err
+}
+
+func (r *orderRepository) UpdateByID(ctx context.Context, id string, order *models.Order) error {
+	start := time.Now()
+	err := r.repo.UpdateByID(ctx, id, order)
+	r.observe("UpdateByID", start, err)
+	return err
+}
+
+func (r *orderRepository) CloseManifest(ctx context.Context, manifest string) (int64, error) {
+	start := time.Now()
+	count, err := r.repo.CloseManifest(ctx, manifest)
+	r.observe("CloseManifest", start, err)
+	return count, err
+}
+
+func (r *orderRepository) MarkExported(ctx context.Context, ids []string, export string) (int64, error) {
+	start := time.Now()
+	count, err := r.repo.MarkExported(ctx, ids, export)
+	r.observe("MarkExported", start, err)
+	return count, err
+}
+
+func (r *orderRepository) LoadManifests(ctx context.Context) ([]string, error) {
+	start := time.Now()
+	manifests, err := r.repo.LoadManifests(ctx)
+	r.observe("LoadManifests", start, err)
+	return manifests, err
+}
+
+func (r *orderRepository) InsertOne(ctx context.Context, order *models.Order) error {
+	start := time.Now()
+	err := r.repo.InsertOne(ctx, order)
+	r.observe("InsertOne", start, err)
+	return err
+}
+
+func (r *orderRepository) InsertMany(ctx context.Context, orders *models.Orders) (int64, error) {
+	start := time.Now()
+	count, err := r.repo.InsertMany(ctx, orders)
+	r.observe("InsertMany", start, err)
+	return count, err
+}
+
+func (r *orderRepository) CountAll(ctx context.Context) (int64, error) {
+	start := time.Now()
+	count, err := r.repo.CountAll(ctx)
+	r.observe("CountAll", start, err)
+	return count, err
+}
+
+func (r *orderRepository) CountCompleted(ctx context.Context) (int64, error) {
+	start := time.Now()
+	count, err := r.repo.CountCompleted(ctx)
+	r.observe("CountCompleted", start, err)
+	return count, err
+}
+
+func (r *orderRepository) CountIncomplete(ctx context.Context) (int64, error) {
+	start := time.Now()
+	count, err := r.repo.CountIncomplete(ctx)
+	r.observe("CountIncomplete", start, err)
+	return count, err
+}
+
+func (r *orderRepository) CountByQuery(ctx context.Context, query models.OrderQuery) (int64, error) {
+	start := time.Now()
+	count, err := r.repo.CountByQuery(ctx, query)
+	r.observe("CountByQuery", start, err)
+	return count, err
+}
+
+func (r *orderRepository) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := r.repo.Ping(ctx)
+	r.observe("Ping", start, err)
+	return err
+}
+
+func (r *orderRepository) Close() error {
+	return r.repo.Close()
+}
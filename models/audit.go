@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// AuditEntry describes a change made to an order
+type AuditEntry struct {
+	PackageID string        `bson:"packageId" json:"packageId"`
+	Action    string        `bson:"action" json:"action"`
+	Actor     string        `bson:"actor" json:"actor"`
+	Approver  string        `bson:"approver,omitempty" json:"approver,omitempty"`
+	Reason    string        `bson:"reason" json:"reason"`
+	Changes   []FieldChange `bson:"changes" json:"changes"`
+	Time      time.Time     `bson:"time" json:"time"`
+
+	// PreviousPackageID is the order's package ID before the change, if the change renamed it, so the
+	// entries recorded under the previous ID remain part of the order's history
+	PreviousPackageID string `bson:"previousPackageId,omitempty" json:"previousPackageId,omitempty"`
+}
+
+// FieldChange describes a change to a single field of an order
+type FieldChange struct {
+	Field string `bson:"field" json:"field"`
+	From  string `bson:"from" json:"from"`
+	To    string `bson:"to" json:"to"`
+}
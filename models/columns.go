@@ -0,0 +1,79 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+)
+
+// OrderColumn describes a field on an order
+type OrderColumn struct {
+	// Key is the field's identifier, matching its database field name
+	Key string
+
+	// Header is the name of the field's column in CSV files
+	Header string
+
+	index int
+}
+
+// orderColumns stores the columns of an order, in the order they are declared
+var orderColumns = buildOrderColumns()
+
+// orderColumnsByKey indexes the order columns by key
+var orderColumnsByKey = indexOrderColumns(orderColumns)
+
+// OrderColumns returns all columns of an order, in the order they are declared
+func OrderColumns() []OrderColumn {
+	columns := make([]OrderColumn, len(orderColumns))
+	copy(columns, orderColumns)
+	return columns
+}
+
+// Get returns the value of the order field with a given column key
+func (o *Order) Get(key string) (string, bool) {
+	col, ok := orderColumnsByKey[key]
+	if !ok {
+		return "", false
+	}
+	return reflect.ValueOf(o).Elem().Field(col.index).String(), true
+}
+
+// Set sets the value of the order field with a given column key
+func (o *Order) Set(key, value string) bool {
+	col, ok := orderColumnsByKey[key]
+	if !ok {
+		return false
+	}
+	reflect.ValueOf(o).Elem().Field(col.index).SetString(value)
+	return true
+}
+
+// buildOrderColumns builds the order columns from the struct tags on the order model
+func buildOrderColumns() []OrderColumn {
+	t := reflect.TypeOf(Order{})
+	columns := make([]OrderColumn, 0, t.NumField())
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type.Kind() != reflect.String || f.Tag.Get("csv") == "" || f.Tag.Get("csv") == "-" {
+			continue
+		}
+
+		columns = append(columns, OrderColumn{
+			Key:    strings.Split(f.Tag.Get("bson"), ",")[0],
+			Header: f.Tag.Get("csv"),
+			index:  i,
+		})
+	}
+
+	return columns
+}
+
+// indexOrderColumns indexes a slice of columns by key
+func indexOrderColumns(columns []OrderColumn) map[string]OrderColumn {
+	index := make(map[string]OrderColumn, len(columns))
+	for _, col := range columns {
+		index[col.Key] = col
+	}
+	return index
+}
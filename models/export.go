@@ -0,0 +1,16 @@
+package models
+
+// ExportProfile describes a saved selection of columns to include in exported files
+type ExportProfile struct {
+	Name    string         `bson:"name" json:"name" validate:"required"`
+	Columns []ExportColumn `bson:"columns" json:"columns" validate:"required,min=1,dive"`
+}
+
+// ExportColumn describes a column in an exported file
+type ExportColumn struct {
+	// Key is the key of the order column to export
+	Key string `bson:"key" json:"key" validate:"required"`
+
+	// Header is the name of the column in the exported file
+	Header string `bson:"header" json:"header" validate:"required"`
+}
@@ -0,0 +1,44 @@
+package models
+
+// Import mapping transforms which can be applied to mapped values
+const (
+	ImportTransformNone   = ""
+	ImportTransformUpper  = "upper"
+	ImportTransformLower  = "lower"
+	ImportTransformTitle  = "title"
+	ImportTransformDigits = "digits"
+)
+
+// ImportTransforms contains all import mapping transforms
+var ImportTransforms = []string{
+	ImportTransformNone,
+	ImportTransformUpper,
+	ImportTransformLower,
+	ImportTransformTitle,
+	ImportTransformDigits,
+}
+
+// ImportProfile describes how the columns of an imported file map to order fields. Order fields
+// without a mapping are matched to columns using their standard CSV headers
+type ImportProfile struct {
+	Name     string          `bson:"name" json:"name" validate:"required"`
+	Mappings []ImportMapping `bson:"mappings" json:"mappings" validate:"required,min=1,dive"`
+}
+
+// ImportMapping describes how the value of a single order field is built from a row of an imported file
+type ImportMapping struct {
+	// Key is the column key of the order field
+	Key string `bson:"key" json:"key" validate:"required"`
+
+	// Headers are the source columns whose values are joined to build the field
+	Headers []string `bson:"headers" json:"headers"`
+
+	// Separator is placed between the values of multiple source columns
+	Separator string `bson:"separator" json:"separator"`
+
+	// Value is a fixed value which is used if there are no source columns or they are all empty
+	Value string `bson:"value" json:"value"`
+
+	// Transform is applied to the value after it is built
+	Transform string `bson:"transform" json:"transform"`
+}
@@ -8,58 +8,86 @@ import (
 
 // Order describes an order
 type Order struct {
-	PackageID                              string `bson:"packageId" csv:"Package ID" validate:"required"`
-	SenderFirstName                        string `bson:"senderFirstName" csv:"Sender First Name"`
-	SenderLastName                         string `bson:"senderLastName" csv:"Sender Last Name"`
-	SenderBusinessName                     string `bson:"senderBusinessName" csv:"Sender Business Name"`
-	SenderAddressLine1                     string `bson:"senderAddressLine1" csv:"Sender Address Line 1"`
-	SenderAddressLine2                     string `bson:"senderAddressLine2" csv:"Sender Address Line 2"`
-	SenderCity                             string `bson:"senderCity" csv:"Sender City"`
-	SenderProvince                         string `bson:"senderProvince" csv:"Sender Province"`
-	SenderPostalCode                       string `bson:"senderPostalCode" csv:"Sender Postal Code"`
-	SenderCountryCode                      string `bson:"senderCountryCode" csv:"Sender Country Code"`
-	SenderPhoneNumber                      string `bson:"senderPhoneNumber" csv:"Sender Phone Number"`
-	RecipientFirstName                     string `bson:"recipientFirstName" csv:"Recipient First Name"`
-	RecipientLastName                      string `bson:"recipientLastName" csv:"Recipient Last Name"`
-	RecipientBusinessName                  string `bson:"recipientBusinessName" csv:"Recipient Business Name"`
-	RecipientAddressLine1                  string `bson:"recipientAddressLine1" csv:"Recipient Address Line 1"`
-	RecipientAddressLine2                  string `bson:"recipientAddressLine2" csv:"Recipient Address Line 2"`
-	RecipientAddressLine3                  string `bson:"recipientAddressLine3" csv:"Recipient Address Line 3"`
-	RecipientInLineTranslationAddressLine1 string `bson:"recipientInLineTranslationAddressLine1" csv:"RecipientInLineTranslationAddressLine1"`
-	RecipientInLineTranslationAddressLine2 string `bson:"recipientInLineTranslationAddressLine2" csv:"RecipientInLineTranslationAddressLine2"`
-	RecipientCity                          string `bson:"recipientCity" csv:"Recipient City"`
-	RecipientProvince                      string `bson:"recipientProvince" csv:"Recipient Province"`
-	RecipientPostalCode                    string `bson:"recipientPostalCode" csv:"Recipient Postal Code"`
-	RecipientCountryCode                   string `bson:"recipientCountryCode" csv:"Recipient Country Code"`
-	RecipientPhoneNumber                   string `bson:"recipientPhoneNumber" csv:"Recipient Phone Number"`
-	RecipientEmailAddress                  string `bson:"recipientEmailAddress" csv:"Recipient E-mail Address"`
-	PackageWeight                          string `bson:"packageWeight" csv:"Package Weight"`
-	WeightUnit                             string `bson:"weightUnit" csv:"Weight Unit"`
-	ServiceType                            string `bson:"serviceType" csv:"Service Type"`
-	RateType                               string `bson:"rateType" csv:"Rate Type"`
-	PackageType                            string `bson:"packageType" csv:"Package Type"`
-	PackagePhysicalCount                   string `bson:"packagePhysicalCount" csv:"Package Physical Count"`
-	PFCEELCode                             string `bson:"pfcEelCode" csv:"PFC/EEL Code"`
-	ItemID                                 string `bson:"itemId" csv:"Item ID"`
-	ItemDescription                        string `bson:"itemDescription" csv:"Item Description"`
-	UnitValueUSD                           string `bson:"unitValueUsd" csv:"Unit Value (USD)"`
-	Quantity                               string `bson:"quantity" csv:"Quantity"`
-	CountryOfOrigin                        string `bson:"countryOfOrigin" csv:"Country Of Origin"`
-	Country                                string `bson:"country" csv:"Country"`
-	Weight                                 string `bson:"weight" csv:"Weight"`
-	Service                                string `bson:"service" csv:"Service"`
-	Length                                 string `bson:"length" csv:"Length"`
-	Width                                  string `bson:"width" csv:"Width"`
-	Height                                 string `bson:"height" csv:"Height"`
-	DIM                                    string `bson:"dim" csv:"DIM"`
-	Account                                string `bson:"account" csv:"Account"`
-	Date                                   string `bson:"date" csv:"Date"`
+	PackageID                              string `bson:"packageId" csv:"Package ID" json:"packageId" validate:"required"`
+	SenderFirstName                        string `bson:"senderFirstName" csv:"Sender First Name" json:"senderFirstName"`
+	SenderLastName                         string `bson:"senderLastName" csv:"Sender Last Name" json:"senderLastName"`
+	SenderBusinessName                     string `bson:"senderBusinessName" csv:"Sender Business Name" json:"senderBusinessName"`
+	SenderAddressLine1                     string `bson:"senderAddressLine1" csv:"Sender Address Line 1" json:"senderAddressLine1"`
+	SenderAddressLine2                     string `bson:"senderAddressLine2" csv:"Sender Address Line 2" json:"senderAddressLine2"`
+	SenderCity                             string `bson:"senderCity" csv:"Sender City" json:"senderCity"`
+	SenderProvince                         string `bson:"senderProvince" csv:"Sender Province" json:"senderProvince"`
+	SenderPostalCode                       string `bson:"senderPostalCode" csv:"Sender Postal Code" json:"senderPostalCode"`
+	SenderCountryCode                      string `bson:"senderCountryCode" csv:"Sender Country Code" json:"senderCountryCode"`
+	SenderPhoneNumber                      string `bson:"senderPhoneNumber" csv:"Sender Phone Number" json:"senderPhoneNumber"`
+	RecipientFirstName                     string `bson:"recipientFirstName" csv:"Recipient First Name" json:"recipientFirstName"`
+	RecipientLastName                      string `bson:"recipientLastName" csv:"Recipient Last Name" json:"recipientLastName"`
+	RecipientBusinessName                  string `bson:"recipientBusinessName" csv:"Recipient Business Name" json:"recipientBusinessName"`
+	RecipientAddressLine1                  string `bson:"recipientAddressLine1" csv:"Recipient Address Line 1" json:"recipientAddressLine1"`
+	RecipientAddressLine2                  string `bson:"recipientAddressLine2" csv:"Recipient Address Line 2" json:"recipientAddressLine2"`
+	RecipientAddressLine3                  string `bson:"recipientAddressLine3" csv:"Recipient Address Line 3" json:"recipientAddressLine3"`
+	RecipientInLineTranslationAddressLine1 string `bson:"recipientInLineTranslationAddressLine1" csv:"RecipientInLineTranslationAddressLine1" json:"recipientInLineTranslationAddressLine1"`
+	RecipientInLineTranslationAddressLine2 string `bson:"recipientInLineTranslationAddressLine2" csv:"RecipientInLineTranslationAddressLine2" json:"recipientInLineTranslationAddressLine2"`
+	RecipientCity                          string `bson:"recipientCity" csv:"Recipient City" json:"recipientCity"`
+	RecipientProvince                      string `bson:"recipientProvince" csv:"Recipient Province" json:"recipientProvince"`
+	RecipientPostalCode                    string `bson:"recipientPostalCode" csv:"Recipient Postal Code" json:"recipientPostalCode"`
+	RecipientCountryCode                   string `bson:"recipientCountryCode" csv:"Recipient Country Code" json:"recipientCountryCode"`
+	RecipientPhoneNumber                   string `bson:"recipientPhoneNumber" csv:"Recipient Phone Number" json:"recipientPhoneNumber"`
+	RecipientEmailAddress                  string `bson:"recipientEmailAddress" csv:"Recipient E-mail Address" json:"recipientEmailAddress"`
+	PackageWeight                          string `bson:"packageWeight" csv:"Package Weight" json:"packageWeight"`
+	WeightUnit                             string `bson:"weightUnit" csv:"Weight Unit" json:"weightUnit"`
+	ServiceType                            string `bson:"serviceType" csv:"Service Type" json:"serviceType"`
+	RateType                               string `bson:"rateType" csv:"Rate Type" json:"rateType"`
+	PackageType                            string `bson:"packageType" csv:"Package Type" json:"packageType"`
+	PackagePhysicalCount                   string `bson:"packagePhysicalCount" csv:"Package Physical Count" json:"packagePhysicalCount"`
+	PFCEELCode                             string `bson:"pfcEelCode" csv:"PFC/EEL Code" json:"pfcEelCode"`
+	ItemID                                 string `bson:"itemId" csv:"Item ID" json:"itemId"`
+	ItemDescription                        string `bson:"itemDescription" csv:"Item Description" json:"itemDescription"`
+	UnitValueUSD                           string `bson:"unitValueUsd" csv:"Unit Value (USD)" json:"unitValueUsd"`
+	Quantity                               string `bson:"quantity" csv:"Quantity" json:"quantity"`
+	CountryOfOrigin                        string `bson:"countryOfOrigin" csv:"Country Of Origin" json:"countryOfOrigin"`
+	Country                                string `bson:"country" csv:"Country" json:"country"`
+	Weight                                 string `bson:"weight" csv:"Weight" json:"weight"`
+	Service                                string `bson:"service" csv:"Service" json:"service"`
+	Length                                 string `bson:"length" csv:"Length" json:"length"`
+	Width                                  string `bson:"width" csv:"Width" json:"width"`
+	Height                                 string `bson:"height" csv:"Height" json:"height"`
+	DIM                                    string `bson:"dim" csv:"DIM" json:"dim"`
+	Account                                string `bson:"account" csv:"Account" json:"account"`
+	Date                                   string `bson:"date" csv:"Date" json:"date"`
+	Manifest                               string `bson:"manifest,omitempty" csv:"-" json:"manifest,omitempty"`
+	Exported                               string `bson:"exported,omitempty" csv:"-" json:"exported,omitempty"`
+	ScannedBy                              string `bson:"scannedBy,omitempty" csv:"-" json:"scannedBy,omitempty"`
+	Station                                string `bson:"station,omitempty" csv:"-" json:"station,omitempty"`
+	UnitSystem                             string `bson:"unitSystem,omitempty" csv:"-" json:"unitSystem,omitempty"`
+}
+
+// IsClosed determines if the order belongs to a closed manifest
+func (o *Order) IsClosed() bool {
+	return o.Manifest != ""
+}
+
+// IsMetric determines if the order was scanned in kilograms and centimetres, rather than pounds and inches.
+// This only applies to the scanned weight and dimensions, as WeightUnit is the unit of PackageWeight
+func (o *Order) IsMetric() bool {
+	return o.UnitSystem == UnitSystemMetric
+}
+
+// IsExported determines if the order has been sent by a scheduled export
+func (o *Order) IsExported() bool {
+	return o.Exported != ""
 }
 
 // Orders is a slice of order structs
 type Orders []Order
 
+// DIM divisors, which convert a volume to a dimensional weight in the unit of the order's weight
+const (
+	dimDivisorImperial = 139  // cubic inches per pound
+	dimDivisorMetric   = 5000 // cubic centimetres per kilogram
+)
+
 // CalculateDim calculates and sets the DIM field on a given order
+// Dimensions are in centimetres if the order was scanned in metric, and otherwise in inches
 func (o *Order) CalculateDim() error {
 	// Check if all dimensions are populated
 	if o.Length != "" && o.Width != "" && o.Height != "" {
@@ -78,7 +106,12 @@ func (o *Order) CalculateDim() error {
 			return errors.New("Unable to parse height")
 		}
 
-		dim := fmt.Sprintf("%.2f", (length*width*height)/139)
+		divisor := float64(dimDivisorImperial)
+		if o.IsMetric() {
+			divisor = dimDivisorMetric
+		}
+
+		dim := fmt.Sprintf("%.2f", (length*width*height)/divisor)
 		o.DIM = dim
 	}
 
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// Order statuses which can be used to filter orders
+const (
+	OrderStatusAll        = ""
+	OrderStatusCompleted  = "completed"
+	OrderStatusIncomplete = "incomplete"
+)
+
+// OrderSortKeys contains the column keys that orders can be sorted by
+var OrderSortKeys = []string{
+	"packageId",
+	"recipientLastName",
+	"recipientCity",
+	"country",
+	"service",
+	"account",
+	"date",
+	"weight",
+}
+
+// OrderQuery describes criteria used to search, filter, sort and paginate orders
+type OrderQuery struct {
+	// Search contains terms which must all match the package ID, recipient name, city or item description
+	Search string
+
+	// Status filters orders by completion status
+	Status string
+
+	Service string
+	Account string
+	Country string
+
+	// Manifest filters orders by the closed manifest they belong to
+	Manifest string
+
+	// Unexported excludes orders which have already been sent by a scheduled export
+	Unexported bool
+
+	// DateFrom and DateTo filter orders by date, inclusively. Dates are compared as strings
+	// so they should be provided in the same format as those stored on the orders, such as YYYY-MM-DD
+	DateFrom string
+	DateTo   string
+
+	// AddedBefore excludes orders added to the database at or after a given time, unless it is zero
+	AddedBefore time.Time
+
+	// Sort is the column key to sort by
+	Sort string
+	Desc bool
+
+	// Page is the page number, starting at 1. Pagination is disabled if PerPage is zero
+	Page    int
+	PerPage int
+}
+
+// IsSortable determines if orders can be sorted by a given column key
+func IsSortable(key string) bool {
+	for _, k := range OrderSortKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
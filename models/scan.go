@@ -1,15 +1,24 @@
 package models
 
+// ScanServices contains the services that can be selected on the scan form
+var ScanServices = []string{"IPA", "Orange", "RRD"}
+
+// ScanAccounts contains the accounts that can be selected on the scan form
+var ScanAccounts = []string{"OTC", "WAB"}
+
 // Scan describes input provided on the scan form which is used to update orders
 type Scan struct {
-	Barcode   string `json:"barcode" validate:"required"`
-	Country   string `json:"country" validate:"required"`
-	Weight    string `json:"weight" validate:"required,numeric,gt=0"`
-	Length    string `json:"length" validate:"required,numeric,gt=0"`
-	Width     string `json:"width" validate:"required,numeric,gt=0"`
-	Height    string `json:"height" validate:"required,numeric,gt=0"`
-	Date      string `json:"date" validate:"required"`
-	Service   string `json:"service" validate:"required"`
-	Account   string `json:"account" validate:"required"`
-	CreateNew bool   `json:"createNew"`
+	Barcode   string `bson:"barcode" json:"barcode" validate:"required"`
+	Country   string `bson:"country" json:"country" validate:"required"`
+	Weight    string `bson:"weight" json:"weight" validate:"required,numeric,gt=0"`
+	Length    string `bson:"length" json:"length" validate:"required,numeric,gt=0"`
+	Width     string `bson:"width" json:"width" validate:"required,numeric,gt=0"`
+	Height    string `bson:"height" json:"height" validate:"required,numeric,gt=0"`
+	Date      string `bson:"date" json:"date" validate:"required"`
+	Service   string `bson:"service" json:"service" validate:"required"`
+	Account   string `bson:"account" json:"account" validate:"required"`
+	CreateNew bool   `bson:"createNew" json:"createNew"`
+
+	// Station is the name of the station the scan was made at, if any
+	Station string `bson:"station,omitempty" json:"station,omitempty"`
 }
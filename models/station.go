@@ -0,0 +1,52 @@
+package models
+
+// Unit systems, which determine the units that weights and dimensions are scanned in
+const (
+	UnitSystemImperial = "imperial"
+	UnitSystemMetric   = "metric"
+)
+
+// UnitSystems contains the unit systems stations can use
+var UnitSystems = []string{
+	UnitSystemImperial,
+	UnitSystemMetric,
+}
+
+// Station describes a packing bench where orders are scanned. Each device that scans orders selects a
+// station, which provides the defaults of its scan form
+type Station struct {
+	Name       string `bson:"name" json:"name" validate:"required"`
+	Service    string `bson:"service" json:"service" validate:"omitempty,oneof=IPA Orange RRD"`
+	Account    string `bson:"account" json:"account" validate:"omitempty,oneof=OTC WAB"`
+	UnitSystem string `bson:"unitSystem" json:"unitSystem" validate:"required,oneof=imperial metric"`
+
+	// Scale and Printer identify the scale and label printer bound to the station
+	Scale   string `bson:"scale" json:"scale"`
+	Printer string `bson:"printer" json:"printer"`
+
+	// Configured determines if the station is provided by the configuration, which replaces it every
+	// time the application starts, so it cannot be changed from the stations page
+	Configured bool `bson:"configured" json:"configured"`
+
+	// LastScan is the most recent scan made at the station, which defaults the next scan
+	LastScan *Scan `bson:"lastScan,omitempty" json:"lastScan,omitempty"`
+}
+
+// IsMetric determines if the station scans weights in kilograms and dimensions in centimetres,
+// rather than pounds and inches
+func (s *Station) IsMetric() bool {
+	return s.UnitSystem == UnitSystemMetric
+}
+
+// DefaultScan returns the scan that defaults the station's scan form, which is its last scan or,
+// if nothing has been scanned at it, its default service and account
+func (s *Station) DefaultScan() Scan {
+	if s.LastScan != nil {
+		return *s.LastScan
+	}
+
+	return Scan{
+		Service: s.Service,
+		Account: s.Account,
+	}
+}
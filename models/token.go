@@ -0,0 +1,57 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// API token scopes. The admin scope grants every other scope
+const (
+	TokenScopeRead   = "read"
+	TokenScopeScan   = "scan"
+	TokenScopeImport = "import"
+	TokenScopeAdmin  = "admin"
+)
+
+// TokenScopes contains the API token scopes
+var TokenScopes = []string{
+	TokenScopeRead,
+	TokenScopeScan,
+	TokenScopeImport,
+	TokenScopeAdmin,
+}
+
+// APIToken describes a token that a machine client, such as a script or handheld device, uses to
+// call the application without a user's password
+type APIToken struct {
+	// ID identifies the token in the application, and is not secret
+	ID   string `bson:"id" json:"id"`
+	Name string `bson:"name" json:"name" validate:"required"`
+
+	// Hash is a hash of the token, so the token itself is not stored
+	Hash string `bson:"hash" json:"-"`
+
+	// Prefix is the start of the token, so users can tell their tokens apart
+	Prefix string `bson:"prefix" json:"prefix"`
+
+	Scopes    []string  `bson:"scopes" json:"scopes" validate:"required,min=1,dive,oneof=read scan import admin"`
+	CreatedBy string    `bson:"createdBy" json:"createdBy"`
+	Created   time.Time `bson:"created" json:"created"`
+	LastUsed  time.Time `bson:"lastUsed,omitempty" json:"lastUsed,omitempty"`
+}
+
+// HasScope determines if the token has a given scope
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope || s == TokenScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Actor returns the name recorded in audit logs for requests made with the token. The ID is used
+// because token names are not unique
+func (t *APIToken) Actor() string {
+	return fmt.Sprintf("token:%s", t.ID)
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// User roles, from least to most privileged. Each role can do everything the roles before it can
+const (
+	RoleScanner    = "scanner"
+	RoleSupervisor = "supervisor"
+	RoleAdmin      = "admin"
+)
+
+// Roles contains the user roles, from least to most privileged
+var Roles = []string{
+	RoleScanner,
+	RoleSupervisor,
+	RoleAdmin,
+}
+
+// User describes a user account
+type User struct {
+	Username     string    `bson:"username" json:"username" validate:"required"`
+	PasswordHash string    `bson:"passwordHash" json:"-"`
+	Role         string    `bson:"role" json:"role" validate:"required,oneof=scanner supervisor admin"`
+	Active       bool      `bson:"active" json:"active"`
+	Created      time.Time `bson:"created" json:"created"`
+}
+
+// HasRole determines if the user is active and has a given role or a more privileged one
+func (u *User) HasRole(role string) bool {
+	return u.Active && roleLevel(u.Role) >= roleLevel(role)
+}
+
+// roleLevel returns the privilege level of a role, which is -1 for unknown roles
+func roleLevel(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// Session describes a logged in user's session
+type Session struct {
+	// ID is a hash of the session token stored in the user's cookie, so the tokens themselves are not stored
+	ID       string    `bson:"id"`
+	Username string    `bson:"username"`
+	Created  time.Time `bson:"created"`
+	Expires  time.Time `bson:"expires"`
+}
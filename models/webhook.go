@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// Webhook event types
+const (
+	WebhookEventScanCompleted  = "scan.completed"
+	WebhookEventOrderCreated   = "order.created"
+	WebhookEventOrdersImported = "orders.imported"
+	WebhookEventOrdersDeleted  = "orders.deleted"
+)
+
+// WebhookEvents contains the event types that webhook subscriptions can receive
+var WebhookEvents = []string{
+	WebhookEventScanCompleted,
+	WebhookEventOrderCreated,
+	WebhookEventOrdersImported,
+	WebhookEventOrdersDeleted,
+}
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookSubscription describes a URL that is sent events of given types
+type WebhookSubscription struct {
+	Name   string   `bson:"name" json:"name" validate:"required"`
+	URL    string   `bson:"url" json:"url" validate:"required,url"`
+	Events []string `bson:"events" json:"events" validate:"required,min=1"`
+
+	// Secret is used to sign the payloads sent to the URL
+	Secret string `bson:"secret" json:"-" validate:"required"`
+
+	// Active determines if events are sent
+	Active bool `bson:"active" json:"active"`
+}
+
+// Subscribes determines if the subscription is active and receives events of a given type
+func (s *WebhookSubscription) Subscribes(event string) bool {
+	if !s.Active {
+		return false
+	}
+
+	for _, e := range s.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookPayload is the JSON body sent for a webhook event
+type WebhookPayload struct {
+	ID    string      `json:"id"`
+	Event string      `json:"event"`
+	Time  time.Time   `json:"time"`
+	Data  interface{} `json:"data"`
+}
+
+// WebhookDelivery describes the delivery of an event to a webhook subscription
+type WebhookDelivery struct {
+	ID           string `bson:"id" json:"id"`
+	Subscription string `bson:"subscription" json:"subscription"`
+	Event        string `bson:"event" json:"event"`
+	URL          string `bson:"url" json:"url"`
+
+	// Payload is the JSON body that is sent
+	Payload string `bson:"payload" json:"payload"`
+
+	Status   string `bson:"status" json:"status"`
+	Attempts int    `bson:"attempts" json:"attempts"`
+
+	// ResponseCode and Response describe the response to the last attempt, and Error describes why it
+	// failed, if it did
+	ResponseCode int    `bson:"responseCode,omitempty" json:"responseCode,omitempty"`
+	Response     string `bson:"response,omitempty" json:"response,omitempty"`
+	Error        string `bson:"error,omitempty" json:"error,omitempty"`
+
+	Created     time.Time `bson:"created" json:"created"`
+	LastAttempt time.Time `bson:"lastAttempt,omitempty" json:"lastAttempt,omitempty"`
+
+	// NextAttempt is when a failed delivery is retried
+	NextAttempt time.Time `bson:"nextAttempt,omitempty" json:"nextAttempt,omitempty"`
+}
@@ -0,0 +1,159 @@
+package purge
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mikestefanello/otcscanner/auth"
+	"github.com/mikestefanello/otcscanner/config"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+	"github.com/mikestefanello/otcscanner/webhook"
+	"github.com/rs/zerolog"
+)
+
+// Operations which delete orders
+const (
+	OperationAll       = "all"
+	OperationCompleted = "completed"
+)
+
+// ErrReasonRequired indicates that orders cannot be deleted without a reason
+var ErrReasonRequired = errors.New("A reason is required to delete orders")
+
+// ErrApprovalFailed indicates that the supervisor approval of a purge was missing or invalid
+var ErrApprovalFailed = errors.New("Supervisor approval failed")
+
+// DatabaseError indicates that the repository could not count or delete the orders. No orders are
+// deleted if counting them failed
+type DatabaseError struct {
+	Op  string
+	Err error
+}
+
+func (e DatabaseError) Error() string {
+	return e.Op + ": " + e.Err.Error()
+}
+
+// Request describes a request to delete orders
+type Request struct {
+	// Operation is the operation to perform, either OperationAll or OperationCompleted
+	Operation string
+
+	// Reason explains why the orders are being deleted, which is sent to webhook subscribers
+	Reason string
+
+	// Actor is who requested the purge, and Approver the supervisor approving it, if required
+	Actor            string
+	Approver         string
+	ApproverPassword string
+
+	// Confirm is called with the number of orders that will be deleted, and the purge is cancelled if it
+	// returns an error. It may be nil
+	Confirm func(count int64) error
+
+	// Log is the logger the purge is logged to
+	Log *zerolog.Logger
+}
+
+// Purger deletes orders, ensuring the delete forms on the database page and the purge command check
+// the same things before deleting and notify webhook subscribers in the same way
+type Purger struct {
+	supervisor config.SupervisorConfig
+	orders     repository.OrderRepository
+	users      repository.UserRepository
+	hooks      *webhook.Dispatcher
+}
+
+// New creates a new purger
+func New(supervisor config.SupervisorConfig, orders repository.OrderRepository, users repository.UserRepository, hooks *webhook.Dispatcher) *Purger {
+	return &Purger{
+		supervisor: supervisor,
+		orders:     orders,
+		users:      users,
+		hooks:      hooks,
+	}
+}
+
+// ApprovalRequired determines if purges must be approved by a supervisor
+func (p *Purger) ApprovalRequired() bool {
+	return auth.ApprovalRequired(p.supervisor)
+}
+
+// Count returns the number of orders an operation would delete if it were performed now
+func (p *Purger) Count(ctx context.Context, operation string) (int64, error) {
+	return p.orders.CountByQuery(ctx, models.OrderQuery{Status: status(operation)})
+}
+
+// Purge counts the orders affected by a request, confirms and checks the approval of the request,
+// then deletes them. Only orders added before they were counted are deleted, and the number of orders
+// actually deleted is returned and sent to webhook subscribers
+func (p *Purger) Purge(ctx context.Context, req Request) (int64, error) {
+	before := time.Now()
+	count, err := p.orders.CountByQuery(ctx, models.OrderQuery{Status: status(req.Operation), AddedBefore: before})
+	if err != nil {
+		return 0, DatabaseError{Op: "Unable to count orders to delete", Err: err}
+	}
+
+	if req.Confirm != nil {
+		if err = req.Confirm(count); err != nil {
+			return 0, err
+		}
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return 0, ErrReasonRequired
+	}
+
+	approver := ""
+	if p.ApprovalRequired() {
+		approver = req.Approver
+		ok, err := auth.VerifySupervisor(p.supervisor, p.users, req.Actor, req.Approver, req.ApproverPassword)
+		if err != nil {
+			return 0, DatabaseError{Op: "Unable to load supervisor", Err: err}
+		}
+		if !ok {
+			req.Log.Warn().Str("operation", req.Operation).Str("approver", approver).Msg("Supervisor approval failed for delete operation.")
+			return 0, ErrApprovalFailed
+		}
+	}
+
+	deleter := p.orders.DeleteCompleted
+	if req.Operation == OperationAll {
+		deleter = p.orders.DeleteAll
+	}
+
+	deleted, err := deleter(ctx, before)
+	if err != nil {
+		return 0, DatabaseError{Op: "Unable to delete orders", Err: err}
+	}
+
+	req.Log.Info().
+		Str("operation", req.Operation).
+		Int64("count", deleted).
+		Str("reason", reason).
+		Str("actor", req.Actor).
+		Str("approver", approver).
+		Msg("Deleted orders from the database.")
+
+	p.hooks.Trigger(models.WebhookEventOrdersDeleted, webhook.DeleteEvent{
+		Operation: req.Operation,
+		Count:     deleted,
+		Reason:    reason,
+		Actor:     req.Actor,
+		Approver:  approver,
+	})
+
+	return deleted, nil
+}
+
+// status returns the status of the orders an operation deletes
+func status(operation string) string {
+	if operation == OperationAll {
+		return models.OrderStatusAll
+	}
+	return models.OrderStatusCompleted
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"github.com/mikestefanello/otcscanner/models"
+)
+
+// AuditRepository provides an interface for audit log repositories
+type AuditRepository interface {
+	// InsertOne inserts a new audit entry
+	InsertOne(entry *models.AuditEntry) error
+
+	// LoadByPackageID loads the audit entries of an order with a given ID, newest first
+	LoadByPackageID(id string) ([]models.AuditEntry, error)
+}
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"github.com/mikestefanello/otcscanner/models"
+)
+
+// ExportProfileRepository provides an interface for export profile repositories
+type ExportProfileRepository interface {
+	// LoadAll loads all export profiles, sorted by name
+	LoadAll() ([]models.ExportProfile, error)
+
+	// LoadByName loads an export profile with a given name
+	LoadByName(name string) (*models.ExportProfile, error)
+
+	// Save inserts or replaces an export profile, matched by name
+	Save(profile *models.ExportProfile) error
+
+	// Delete deletes the export profile with a given name
+	Delete(name string) error
+}
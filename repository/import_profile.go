@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"github.com/mikestefanello/otcscanner/models"
+)
+
+// ImportProfileRepository provides an interface for import profile repositories
+type ImportProfileRepository interface {
+	// LoadAll loads all import profiles, sorted by name
+	LoadAll() ([]models.ImportProfile, error)
+
+	// LoadByName loads an import profile with a given name
+	LoadByName(name string) (*models.ImportProfile, error)
+
+	// Save inserts or replaces an import profile, matched by name
+	Save(profile *models.ImportProfile) error
+
+	// Delete deletes the import profile with a given name
+	Delete(name string) error
+}
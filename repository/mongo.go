@@ -2,38 +2,74 @@ package repository
 
 import (
 	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/mikestefanello/otcscanner/config"
 	"github.com/mikestefanello/otcscanner/models"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
+// mongoIteratorBatchSize is the number of orders an iterator loads from the database at a time
+const mongoIteratorBatchSize = 500
+
+// mongoDB is a connection to a mongo DB database which is shared by the mongo repositories
+type mongoDB struct {
+	client *mongo.Client
+	config config.MongoConfig
+}
+
 type mongoOrderRepository struct {
-	client           *mongo.Client
-	config           config.MongoConfig
+	db               *mongoDB
 	filterCompleted  bson.M
 	filterIncomplete bson.M
 }
 
-// NewMongoOrderRepository creates a new mongo DB repository for orders
-func NewMongoOrderRepository(cfg config.MongoConfig) (OrderRepository, error) {
-	repo := &mongoOrderRepository{
-		config:           cfg,
+// NewMongoRepositories connects to mongo DB and creates all repositories using the connection
+func NewMongoRepositories(cfg config.MongoConfig) (Repositories, error) {
+	db := &mongoDB{
+		config: cfg,
+	}
+
+	err := db.connect()
+	if err != nil {
+		return Repositories{}, err
+	}
+
+	return Repositories{
+		Orders:         newMongoOrderRepository(db),
+		Audit:          newMongoAuditRepository(db),
+		ExportProfiles: newMongoExportProfileRepository(db),
+		ImportProfiles: newMongoImportProfileRepository(db),
+		Webhooks:       newMongoWebhookRepository(db),
+		Deliveries:     newMongoWebhookDeliveryRepository(db),
+		Users:          newMongoUserRepository(db),
+		Sessions:       newMongoSessionRepository(db),
+		APITokens:      newMongoAPITokenRepository(db),
+		Stations:       newMongoStationRepository(db),
+	}, nil
+}
+
+// newMongoOrderRepository creates a new mongo DB repository for orders
+func newMongoOrderRepository(db *mongoDB) OrderRepository {
+	return &mongoOrderRepository{
+		db:               db,
 		filterCompleted:  bson.M{"service": bson.M{"$ne": ""}},
 		filterIncomplete: bson.M{"service": ""},
 	}
-	err := repo.connect()
-	return repo, err
 }
 
-func (r *mongoOrderRepository) connect() error {
-	ctx, cancel := r.contextWithTimeout()
+func (db *mongoDB) connect() error {
+	ctx, cancel := db.contextWithTimeout()
 	defer cancel()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(r.config.URL))
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(db.config.URL))
 	if err != nil {
 		return err
 	}
@@ -43,21 +79,32 @@ func (r *mongoOrderRepository) connect() error {
 		return err
 	}
 
-	r.client = client
+	db.client = client
 
 	return nil
 }
 
-func (r *mongoOrderRepository) contextWithTimeout() (context.Context, context.CancelFunc) {
-	return context.WithTimeout(context.Background(), r.config.Timeout)
+func (db *mongoDB) disconnect() error {
+	ctx, cancel := db.contextWithTimeout()
+	defer cancel()
+
+	return db.client.Disconnect(ctx)
+}
+
+func (db *mongoDB) contextWithTimeout() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), db.config.Timeout)
+}
+
+func (db *mongoDB) collection(name string) *mongo.Collection {
+	return db.client.Database(db.config.DB).Collection(name)
 }
 
 func (r *mongoOrderRepository) getCollection() *mongo.Collection {
-	return r.client.Database(r.config.DB).Collection("orders")
+	return r.db.collection("orders")
 }
 
-func (r *mongoOrderRepository) LoadByID(id string) (*models.Order, error) {
-	ctx, cancel := r.contextWithTimeout()
+func (r *mongoOrderRepository) LoadByID(ctx context.Context, id string) (*models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.db.config.LookupTimeout)
 	defer cancel()
 
 	o := &models.Order{}
@@ -73,28 +120,64 @@ func (r *mongoOrderRepository) LoadByID(id string) (*models.Order, error) {
 	return o, nil
 }
 
-func (r *mongoOrderRepository) LoadAll() (*models.Orders, error) {
-	return r.loadWithFilter(bson.M{})
+func (r *mongoOrderRepository) LoadAll(ctx context.Context) (*models.Orders, error) {
+	return r.loadWithFilter(ctx, bson.M{})
 }
 
-func (r *mongoOrderRepository) LoadCompleted() (*models.Orders, error) {
-	return r.loadWithFilter(r.filterCompleted)
+func (r *mongoOrderRepository) LoadCompleted(ctx context.Context) (*models.Orders, error) {
+	return r.loadWithFilter(ctx, r.filterCompleted)
 }
 
-func (r *mongoOrderRepository) LoadIncomplete() (*models.Orders, error) {
-	return r.loadWithFilter(r.filterIncomplete)
+func (r *mongoOrderRepository) LoadIncomplete(ctx context.Context) (*models.Orders, error) {
+	return r.loadWithFilter(ctx, r.filterIncomplete)
 }
 
-func (r *mongoOrderRepository) DeleteAll() error {
-	return r.deleteWithFilter(bson.M{})
+func (r *mongoOrderRepository) LoadByQuery(ctx context.Context, query models.OrderQuery) (*models.Orders, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.db.config.LookupTimeout)
+	defer cancel()
+
+	o := &models.Orders{}
+	cursor, err := r.getCollection().Find(ctx, r.queryFilter(query), r.queryOptions(query))
+
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, o)
+
+	return o, err
 }
 
-func (r *mongoOrderRepository) DeleteCompleted() error {
-	return r.deleteWithFilter(r.filterCompleted)
+func (r *mongoOrderRepository) IterateByQuery(ctx context.Context, query models.OrderQuery) (OrderIterator, error) {
+	// Iteration can take much longer than a point query so it has its own timeout
+	ctx, cancel := context.WithTimeout(ctx, r.db.config.ExportTimeout)
+
+	opts := r.queryOptions(query).SetBatchSize(mongoIteratorBatchSize)
+	cursor, err := r.getCollection().Find(ctx, r.queryFilter(query), opts)
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &mongoOrderIterator{
+		ctx:    ctx,
+		cancel: cancel,
+		cursor: cursor,
+	}, nil
 }
 
-func (r *mongoOrderRepository) UpdateOne(order *models.Order) error {
-	ctx, cancel := r.contextWithTimeout()
+func (r *mongoOrderRepository) DeleteAll(ctx context.Context, before time.Time) (int64, error) {
+	return r.deleteWithFilter(ctx, r.queryFilter(models.OrderQuery{Status: models.OrderStatusAll, AddedBefore: before}))
+}
+
+func (r *mongoOrderRepository) DeleteCompleted(ctx context.Context, before time.Time) (int64, error) {
+	return r.deleteWithFilter(ctx, r.queryFilter(models.OrderQuery{Status: models.OrderStatusCompleted, AddedBefore: before}))
+}
+
+func (r *mongoOrderRepository) UpdateOne(ctx context.Context, order *models.Order) error {
+	ctx, cancel := context.WithTimeout(ctx, r.db.config.LookupTimeout)
 	defer cancel()
 
 	filter := bson.M{"packageId": order.PackageID}
@@ -104,8 +187,92 @@ func (r *mongoOrderRepository) UpdateOne(order *models.Order) error {
 	return err
 }
 
-func (r *mongoOrderRepository) InsertOne(order *models.Order) error {
-	ctx, cancel := r.contextWithTimeout()
+func (r *mongoOrderRepository) UpdateByID(ctx context.Context, id string, order *models.Order) error {
+	ctx, cancel := context.WithTimeout(ctx, r.db.config.LookupTimeout)
+	defer cancel()
+
+	filter := bson.M{"packageId": id}
+	result, err := r.getCollection().ReplaceOne(ctx, filter, order)
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			return ErrDuplicate
+		}
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// isDuplicateKeyError determines if an error was caused by a write that violates a unique index
+func isDuplicateKeyError(err error) bool {
+	if we, ok := err.(mongo.WriteException); ok {
+		for _, e := range we.WriteErrors {
+			if e.Code == 11000 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *mongoOrderRepository) CloseManifest(ctx context.Context, manifest string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.db.config.BulkWriteTimeout)
+	defer cancel()
+
+	filter := bson.M{"$and": bson.A{
+		r.filterCompleted,
+		bson.M{"manifest": bson.M{"$in": bson.A{nil, ""}}},
+	}}
+	update := bson.M{"$set": bson.M{"manifest": manifest}}
+	result, err := r.getCollection().UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+func (r *mongoOrderRepository) MarkExported(ctx context.Context, ids []string, export string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.db.config.BulkWriteTimeout)
+	defer cancel()
+
+	filter := bson.M{"packageId": bson.M{"$in": ids}}
+	update := bson.M{"$set": bson.M{"exported": export}}
+	result, err := r.getCollection().UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+func (r *mongoOrderRepository) LoadManifests(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.db.config.LookupTimeout)
+	defer cancel()
+
+	values, err := r.getCollection().Distinct(ctx, "manifest", bson.M{"manifest": bson.M{"$nin": bson.A{nil, ""}}})
+	if err != nil {
+		return nil, err
+	}
+
+	// Manifest IDs are timestamps, so sorting them in reverse puts the most recent first
+	manifests := make([]string, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(string); ok {
+			manifests = append(manifests, id)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(manifests)))
+
+	return manifests, nil
+}
+
+func (r *mongoOrderRepository) InsertOne(ctx context.Context, order *models.Order) error {
+	ctx, cancel := context.WithTimeout(ctx, r.db.config.LookupTimeout)
 	defer cancel()
 
 	_, err := r.getCollection().InsertOne(ctx, order)
@@ -113,35 +280,137 @@ func (r *mongoOrderRepository) InsertOne(order *models.Order) error {
 	return err
 }
 
-func (r *mongoOrderRepository) InsertMany(orders *models.Orders) error {
-	ctx, cancel := r.contextWithTimeout()
+func (r *mongoOrderRepository) InsertMany(ctx context.Context, orders *models.Orders) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.db.config.BulkWriteTimeout)
 	defer cancel()
 
-	// TODO: Odd that this is needed?
-	data := make([]interface{}, 0, len(*orders))
-	for _, o := range *orders {
-		data = append(data, o)
+	// Each order is upserted by package ID and only written if it was inserted
+	writes := make([]mongo.WriteModel, 0, len(*orders))
+	for i := range *orders {
+		o := &(*orders)[i]
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"packageId": o.PackageID}).
+			SetUpdate(bson.M{"$setOnInsert": o}).
+			SetUpsert(true))
 	}
 
-	_, err := r.getCollection().InsertMany(ctx, data)
+	result, err := r.getCollection().BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	if result == nil {
+		return 0, err
+	}
 
-	return err
+	return result.UpsertedCount, err
+}
+
+func (r *mongoOrderRepository) CountAll(ctx context.Context) (int64, error) {
+	return r.countWithFilter(ctx, bson.M{})
 }
 
-func (r *mongoOrderRepository) CountAll() (int64, error) {
-	return r.countWithFilter(bson.M{})
+func (r *mongoOrderRepository) CountCompleted(ctx context.Context) (int64, error) {
+	return r.countWithFilter(ctx, r.filterCompleted)
 }
 
-func (r *mongoOrderRepository) CountCompleted() (int64, error) {
-	return r.countWithFilter(r.filterCompleted)
+func (r *mongoOrderRepository) CountIncomplete(ctx context.Context) (int64, error) {
+	return r.countWithFilter(ctx, r.filterIncomplete)
 }
 
-func (r *mongoOrderRepository) CountIncomplete() (int64, error) {
-	return r.countWithFilter(r.filterIncomplete)
+func (r *mongoOrderRepository) CountByQuery(ctx context.Context, query models.OrderQuery) (int64, error) {
+	return r.countWithFilter(ctx, r.queryFilter(query))
 }
 
-func (r *mongoOrderRepository) loadWithFilter(filter bson.M) (*models.Orders, error) {
-	ctx, cancel := r.contextWithTimeout()
+// queryOptions builds the find options, which sort and paginate the results, from a given order query
+func (r *mongoOrderRepository) queryOptions(query models.OrderQuery) *options.FindOptions {
+	// Sort by package ID unless otherwise specified, and always use it as a tie-breaker
+	// so pagination is stable
+	sortDir := 1
+	if query.Desc {
+		sortDir = -1
+	}
+	sort := bson.D{}
+	if query.Sort != "" && query.Sort != "packageId" && models.IsSortable(query.Sort) {
+		sort = append(sort, bson.E{Key: query.Sort, Value: sortDir})
+	}
+	sort = append(sort, bson.E{Key: "packageId", Value: sortDir})
+
+	opts := options.Find().SetSort(sort)
+	if query.PerPage > 0 {
+		page := query.Page
+		if page < 1 {
+			page = 1
+		}
+		opts.SetSkip(int64((page - 1) * query.PerPage))
+		opts.SetLimit(int64(query.PerPage))
+	}
+
+	return opts
+}
+
+// queryFilter builds a filter from a given order query
+func (r *mongoOrderRepository) queryFilter(query models.OrderQuery) bson.M {
+	conditions := bson.A{}
+
+	// Every search term must match at least one of the searchable fields
+	for _, term := range strings.Fields(query.Search) {
+		regex := primitive.Regex{Pattern: regexp.QuoteMeta(term), Options: "i"}
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{"packageId": regex},
+			bson.M{"recipientFirstName": regex},
+			bson.M{"recipientLastName": regex},
+			bson.M{"recipientBusinessName": regex},
+			bson.M{"recipientCity": regex},
+			bson.M{"itemDescription": regex},
+		}})
+	}
+
+	switch query.Status {
+	case models.OrderStatusCompleted:
+		conditions = append(conditions, r.filterCompleted)
+	case models.OrderStatusIncomplete:
+		conditions = append(conditions, r.filterIncomplete)
+	}
+
+	if query.Service != "" {
+		conditions = append(conditions, bson.M{"service": query.Service})
+	}
+
+	if query.Manifest != "" {
+		conditions = append(conditions, bson.M{"manifest": query.Manifest})
+	}
+
+	if query.Unexported {
+		conditions = append(conditions, bson.M{"exported": bson.M{"$in": bson.A{nil, ""}}})
+	}
+
+	if query.Account != "" {
+		conditions = append(conditions, bson.M{"account": query.Account})
+	}
+
+	if query.Country != "" {
+		conditions = append(conditions, bson.M{"country": query.Country})
+	}
+
+	if query.DateFrom != "" {
+		conditions = append(conditions, bson.M{"date": bson.M{"$gte": query.DateFrom}})
+	}
+
+	if query.DateTo != "" {
+		conditions = append(conditions, bson.M{"date": bson.M{"$lte": query.DateTo}})
+	}
+
+	// Order IDs are generated when orders are inserted and begin with the time in seconds
+	if !query.AddedBefore.IsZero() {
+		conditions = append(conditions, bson.M{"_id": bson.M{"$lt": primitive.NewObjectIDFromTimestamp(query.AddedBefore)}})
+	}
+
+	if len(conditions) == 0 {
+		return bson.M{}
+	}
+
+	return bson.M{"$and": conditions}
+}
+
+func (r *mongoOrderRepository) loadWithFilter(ctx context.Context, filter bson.M) (*models.Orders, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.db.config.ExportTimeout)
 	defer cancel()
 
 	o := &models.Orders{}
@@ -157,18 +426,68 @@ func (r *mongoOrderRepository) loadWithFilter(filter bson.M) (*models.Orders, er
 	return o, err
 }
 
-func (r *mongoOrderRepository) deleteWithFilter(filter bson.M) error {
-	ctx, cancel := r.contextWithTimeout()
+func (r *mongoOrderRepository) deleteWithFilter(ctx context.Context, filter bson.M) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.db.config.BulkWriteTimeout)
 	defer cancel()
 
-	_, err := r.getCollection().DeleteMany(ctx, filter)
+	result, err := r.getCollection().DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
 
-	return err
+	return result.DeletedCount, nil
 }
 
-func (r *mongoOrderRepository) countWithFilter(filter bson.M) (int64, error) {
-	ctx, cancel := r.contextWithTimeout()
+func (r *mongoOrderRepository) countWithFilter(ctx context.Context, filter bson.M) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.db.config.LookupTimeout)
 	defer cancel()
 
 	return r.getCollection().CountDocuments(ctx, filter)
 }
+
+// mongoOrderIterator iterates over orders using a mongo DB cursor
+type mongoOrderIterator struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	cursor *mongo.Cursor
+	order  *models.Order
+	err    error
+}
+
+func (i *mongoOrderIterator) Next() bool {
+	if !i.cursor.Next(i.ctx) {
+		return false
+	}
+
+	i.order = &models.Order{}
+	i.err = i.cursor.Decode(i.order)
+
+	return i.err == nil
+}
+
+func (i *mongoOrderIterator) Order() *models.Order {
+	return i.order
+}
+
+func (i *mongoOrderIterator) Err() error {
+	if i.err != nil {
+		return i.err
+	}
+	return i.cursor.Err()
+}
+
+func (i *mongoOrderIterator) Close() error {
+	defer i.cancel()
+	return i.cursor.Close(i.ctx)
+}
+
+func (r *mongoOrderRepository) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.db.config.LookupTimeout)
+	defer cancel()
+
+	return r.db.client.Ping(ctx, readpref.Primary())
+}
+
+func (r *mongoOrderRepository) Close() error {
+	return r.db.disconnect()
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"github.com/mikestefanello/otcscanner/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoAuditRepository struct {
+	db *mongoDB
+}
+
+// newMongoAuditRepository creates a new mongo DB repository for audit entries
+func newMongoAuditRepository(db *mongoDB) AuditRepository {
+	return &mongoAuditRepository{
+		db: db,
+	}
+}
+
+func (r *mongoAuditRepository) getCollection() *mongo.Collection {
+	return r.db.collection("audit")
+}
+
+func (r *mongoAuditRepository) InsertOne(entry *models.AuditEntry) error {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	_, err := r.getCollection().InsertOne(ctx, entry)
+
+	return err
+}
+
+func (r *mongoAuditRepository) LoadByPackageID(id string) ([]models.AuditEntry, error) {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"time": -1})
+	cursor, err := r.getCollection().Find(ctx, bson.M{"packageId": id}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.AuditEntry{}
+	err = cursor.All(ctx, &entries)
+
+	return entries, err
+}
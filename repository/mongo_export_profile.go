@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"github.com/mikestefanello/otcscanner/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoExportProfileRepository struct {
+	db *mongoDB
+}
+
+// newMongoExportProfileRepository creates a new mongo DB repository for export profiles
+func newMongoExportProfileRepository(db *mongoDB) ExportProfileRepository {
+	return &mongoExportProfileRepository{
+		db: db,
+	}
+}
+
+func (r *mongoExportProfileRepository) getCollection() *mongo.Collection {
+	return r.db.collection("exportProfiles")
+}
+
+func (r *mongoExportProfileRepository) LoadAll() ([]models.ExportProfile, error) {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"name": 1})
+	cursor, err := r.getCollection().Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	profiles := []models.ExportProfile{}
+	err = cursor.All(ctx, &profiles)
+
+	return profiles, err
+}
+
+func (r *mongoExportProfileRepository) LoadByName(name string) (*models.ExportProfile, error) {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	p := &models.ExportProfile{}
+	err := r.getCollection().FindOne(ctx, bson.M{"name": name}).Decode(p)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (r *mongoExportProfileRepository) Save(profile *models.ExportProfile) error {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	opts := options.Replace().SetUpsert(true)
+	_, err := r.getCollection().ReplaceOne(ctx, bson.M{"name": profile.Name}, profile, opts)
+
+	return err
+}
+
+func (r *mongoExportProfileRepository) Delete(name string) error {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	result, err := r.getCollection().DeleteOne(ctx, bson.M{"name": name})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"sort"
+
+	"github.com/mikestefanello/otcscanner/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoIndexes contains the indexes of each collection, keyed by collection name. Creating an index
+// that already exists has no effect, so migrating can be repeated and run while the application is
+// serving requests
+var mongoIndexes = map[string][]mongo.IndexModel{
+	"orders": {
+		{Keys: bson.D{{Key: "packageId", Value: 1}}, Options: options.Index().SetName("packageId_unique").SetUnique(true)},
+		{Keys: bson.D{{Key: "service", Value: 1}}},
+		{Keys: bson.D{{Key: "manifest", Value: 1}}},
+		{Keys: bson.D{{Key: "exported", Value: 1}}},
+	},
+	"audit": {
+		{Keys: bson.D{{Key: "packageId", Value: 1}, {Key: "time", Value: -1}}},
+	},
+	"exportProfiles": {
+		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"importProfiles": {
+		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"webhooks": {
+		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"webhookDeliveries": {
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created", Value: 1}}},
+		{Keys: bson.D{{Key: "created", Value: -1}}},
+	},
+	"users": {
+		{Keys: bson.D{{Key: "username", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"sessions": {
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		// Expired sessions are removed by the database as well as when users log in
+		{Keys: bson.D{{Key: "expires", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	"apiTokens": {
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"stations": {
+		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+}
+
+// mongoObsoleteIndexes contains the names of indexes that have been replaced, keyed by collection name.
+// They are dropped before the indexes are created, since an index cannot be created with the same keys
+// as an existing one
+var mongoObsoleteIndexes = map[string][]string{
+	// Order package IDs were not unique before imports skipped existing orders
+	"orders": {"packageId_1"},
+}
+
+// mongoNotFoundCodes contains the error codes returned when dropping an index or collection that does not exist
+var mongoNotFoundCodes = map[int32]bool{
+	26: true, // NamespaceNotFound
+	27: true, // IndexNotFound
+}
+
+// MigrateMongo connects to mongo DB and creates the indexes used by the repositories, returning the
+// names of the indexes of each collection, keyed by collection name
+func MigrateMongo(ctx context.Context, cfg config.MongoConfig) (map[string][]string, error) {
+	db := &mongoDB{
+		config: cfg,
+	}
+
+	err := db.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer db.disconnect()
+
+	names := make([]string, 0, len(mongoIndexes))
+	for name := range mongoIndexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Building indexes on large collections can take a while, like other bulk writes
+	ctx, cancel := context.WithTimeout(ctx, cfg.BulkWriteTimeout)
+	defer cancel()
+
+	for name, indexes := range mongoObsoleteIndexes {
+		for _, index := range indexes {
+			_, err = db.collection(name).Indexes().DropOne(ctx, index)
+			if cmdErr, ok := err.(mongo.CommandError); ok && mongoNotFoundCodes[cmdErr.Code] {
+				err = nil
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Creating the unique package ID index fails if the collection already contains duplicates,
+	// which must be removed first
+	created := make(map[string][]string, len(names))
+	for _, name := range names {
+		created[name], err = db.collection(name).Indexes().CreateMany(ctx, mongoIndexes[name])
+		if err != nil {
+			return created, err
+		}
+	}
+
+	return created, nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/mikestefanello/otcscanner/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoSessionRepository struct {
+	db *mongoDB
+}
+
+// newMongoSessionRepository creates a new mongo DB repository for sessions
+func newMongoSessionRepository(db *mongoDB) SessionRepository {
+	return &mongoSessionRepository{
+		db: db,
+	}
+}
+
+func (r *mongoSessionRepository) getCollection() *mongo.Collection {
+	return r.db.collection("sessions")
+}
+
+func (r *mongoSessionRepository) InsertOne(session *models.Session) error {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	_, err := r.getCollection().InsertOne(ctx, session)
+
+	return err
+}
+
+func (r *mongoSessionRepository) LoadByID(id string) (*models.Session, error) {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	s := &models.Session{}
+	err := r.getCollection().FindOne(ctx, bson.M{"id": id}).Decode(s)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (r *mongoSessionRepository) Delete(id string) error {
+	return r.deleteWithFilter(bson.M{"id": id})
+}
+
+func (r *mongoSessionRepository) DeleteByUsername(username string) error {
+	return r.deleteWithFilter(bson.M{"username": username})
+}
+
+func (r *mongoSessionRepository) DeleteExpired() error {
+	return r.deleteWithFilter(bson.M{"expires": bson.M{"$lt": time.Now()}})
+}
+
+func (r *mongoSessionRepository) deleteWithFilter(filter bson.M) error {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	_, err := r.getCollection().DeleteMany(ctx, filter)
+
+	return err
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"github.com/mikestefanello/otcscanner/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoStationRepository struct {
+	db *mongoDB
+}
+
+// newMongoStationRepository creates a new mongo DB repository for stations
+func newMongoStationRepository(db *mongoDB) StationRepository {
+	return &mongoStationRepository{
+		db: db,
+	}
+}
+
+func (r *mongoStationRepository) getCollection() *mongo.Collection {
+	return r.db.collection("stations")
+}
+
+func (r *mongoStationRepository) LoadAll() ([]models.Station, error) {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"name": 1})
+	cursor, err := r.getCollection().Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	stations := []models.Station{}
+	err = cursor.All(ctx, &stations)
+
+	return stations, err
+}
+
+func (r *mongoStationRepository) LoadByName(name string) (*models.Station, error) {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	s := &models.Station{}
+	err := r.getCollection().FindOne(ctx, bson.M{"name": name}).Decode(s)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (r *mongoStationRepository) Save(station *models.Station) error {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	opts := options.Replace().SetUpsert(true)
+	_, err := r.getCollection().ReplaceOne(ctx, bson.M{"name": station.Name}, station, opts)
+
+	return err
+}
+
+func (r *mongoStationRepository) SaveLastScan(name string, scan models.Scan) error {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	result, err := r.getCollection().UpdateOne(ctx, bson.M{"name": name}, bson.M{"$set": bson.M{"lastScan": scan}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *mongoStationRepository) Delete(name string) error {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	result, err := r.getCollection().DeleteOne(ctx, bson.M{"name": name})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/mikestefanello/otcscanner/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoAPITokenRepository struct {
+	db *mongoDB
+}
+
+// newMongoAPITokenRepository creates a new mongo DB repository for API tokens
+func newMongoAPITokenRepository(db *mongoDB) APITokenRepository {
+	return &mongoAPITokenRepository{
+		db: db,
+	}
+}
+
+func (r *mongoAPITokenRepository) getCollection() *mongo.Collection {
+	return r.db.collection("apiTokens")
+}
+
+func (r *mongoAPITokenRepository) LoadAll() ([]models.APIToken, error) {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"created": -1})
+	cursor, err := r.getCollection().Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tokens := []models.APIToken{}
+	err = cursor.All(ctx, &tokens)
+
+	return tokens, err
+}
+
+func (r *mongoAPITokenRepository) LoadByHash(hash string) (*models.APIToken, error) {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	t := &models.APIToken{}
+	err := r.getCollection().FindOne(ctx, bson.M{"hash": hash}).Decode(t)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (r *mongoAPITokenRepository) InsertOne(token *models.APIToken) error {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	_, err := r.getCollection().InsertOne(ctx, token)
+
+	return err
+}
+
+func (r *mongoAPITokenRepository) UpdateLastUsed(id string, t time.Time) error {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	_, err := r.getCollection().UpdateOne(ctx, bson.M{"id": id}, bson.M{"$set": bson.M{"lastUsed": t}})
+
+	return err
+}
+
+func (r *mongoAPITokenRepository) Delete(id string) error {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	result, err := r.getCollection().DeleteOne(ctx, bson.M{"id": id})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"github.com/mikestefanello/otcscanner/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoUserRepository struct {
+	db *mongoDB
+}
+
+// newMongoUserRepository creates a new mongo DB repository for users
+func newMongoUserRepository(db *mongoDB) UserRepository {
+	return &mongoUserRepository{
+		db: db,
+	}
+}
+
+func (r *mongoUserRepository) getCollection() *mongo.Collection {
+	return r.db.collection("users")
+}
+
+func (r *mongoUserRepository) LoadAll() ([]models.User, error) {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"username": 1})
+	cursor, err := r.getCollection().Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []models.User{}
+	err = cursor.All(ctx, &users)
+
+	return users, err
+}
+
+func (r *mongoUserRepository) LoadByUsername(username string) (*models.User, error) {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	u := &models.User{}
+	err := r.getCollection().FindOne(ctx, bson.M{"username": username}).Decode(u)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func (r *mongoUserRepository) Save(user *models.User) error {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	opts := options.Replace().SetUpsert(true)
+	_, err := r.getCollection().ReplaceOne(ctx, bson.M{"username": user.Username}, user, opts)
+
+	return err
+}
+
+func (r *mongoUserRepository) Delete(username string) error {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	result, err := r.getCollection().DeleteOne(ctx, bson.M{"username": username})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *mongoUserRepository) Count() (int64, error) {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	return r.getCollection().CountDocuments(ctx, bson.M{})
+}
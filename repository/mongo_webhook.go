@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"github.com/mikestefanello/otcscanner/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoWebhookRepository struct {
+	db *mongoDB
+}
+
+// newMongoWebhookRepository creates a new mongo DB repository for webhook subscriptions
+func newMongoWebhookRepository(db *mongoDB) WebhookRepository {
+	return &mongoWebhookRepository{
+		db: db,
+	}
+}
+
+func (r *mongoWebhookRepository) getCollection() *mongo.Collection {
+	return r.db.collection("webhooks")
+}
+
+func (r *mongoWebhookRepository) LoadAll() ([]models.WebhookSubscription, error) {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"name": 1})
+	cursor, err := r.getCollection().Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	subscriptions := []models.WebhookSubscription{}
+	err = cursor.All(ctx, &subscriptions)
+
+	return subscriptions, err
+}
+
+func (r *mongoWebhookRepository) LoadByName(name string) (*models.WebhookSubscription, error) {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	s := &models.WebhookSubscription{}
+	err := r.getCollection().FindOne(ctx, bson.M{"name": name}).Decode(s)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (r *mongoWebhookRepository) Save(subscription *models.WebhookSubscription) error {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	opts := options.Replace().SetUpsert(true)
+	_, err := r.getCollection().ReplaceOne(ctx, bson.M{"name": subscription.Name}, subscription, opts)
+
+	return err
+}
+
+func (r *mongoWebhookRepository) Delete(name string) error {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	result, err := r.getCollection().DeleteOne(ctx, bson.M{"name": name})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"github.com/mikestefanello/otcscanner/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoWebhookDeliveryRepository struct {
+	db *mongoDB
+}
+
+// newMongoWebhookDeliveryRepository creates a new mongo DB repository for webhook deliveries
+func newMongoWebhookDeliveryRepository(db *mongoDB) WebhookDeliveryRepository {
+	return &mongoWebhookDeliveryRepository{
+		db: db,
+	}
+}
+
+func (r *mongoWebhookDeliveryRepository) getCollection() *mongo.Collection {
+	return r.db.collection("webhookDeliveries")
+}
+
+func (r *mongoWebhookDeliveryRepository) InsertOne(delivery *models.WebhookDelivery) error {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	_, err := r.getCollection().InsertOne(ctx, delivery)
+
+	return err
+}
+
+func (r *mongoWebhookDeliveryRepository) UpdateOne(delivery *models.WebhookDelivery) error {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	result, err := r.getCollection().ReplaceOne(ctx, bson.M{"id": delivery.ID}, delivery)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *mongoWebhookDeliveryRepository) LoadByID(id string) (*models.WebhookDelivery, error) {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	d := &models.WebhookDelivery{}
+	err := r.getCollection().FindOne(ctx, bson.M{"id": id}).Decode(d)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (r *mongoWebhookDeliveryRepository) LoadRecent(status string, limit int) ([]models.WebhookDelivery, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	opts := options.Find().SetSort(bson.M{"created": -1}).SetLimit(int64(limit))
+	return r.loadWithFilter(filter, opts)
+}
+
+func (r *mongoWebhookDeliveryRepository) LoadPending() ([]models.WebhookDelivery, error) {
+	opts := options.Find().SetSort(bson.M{"created": 1})
+	return r.loadWithFilter(bson.M{"status": models.WebhookDeliveryPending}, opts)
+}
+
+func (r *mongoWebhookDeliveryRepository) loadWithFilter(filter bson.M, opts *options.FindOptions) ([]models.WebhookDelivery, error) {
+	ctx, cancel := r.db.contextWithTimeout()
+	defer cancel()
+
+	cursor, err := r.getCollection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	deliveries := []models.WebhookDelivery{}
+	err = cursor.All(ctx, &deliveries)
+
+	return deliveries, err
+}
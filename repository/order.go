@@ -1,49 +1,99 @@
 package repository
 
 import (
-	"errors"
+	"context"
+	"time"
 
 	"github.com/mikestefanello/otcscanner/models"
 )
 
-// ErrNotFound is an error that indicates an order could not be found
-var ErrNotFound = errors.New("Order not found")
-
-// OrderRepository provides an interface for order repositories
+// OrderRepository provides an interface for order repositories. Every method except Close takes the
+// context of the operation, such as that of the HTTP request it is made for, so an operation stops
+// when it is no longer needed. Implementations apply their own timeouts on top of the context
 type OrderRepository interface {
 	// LoadByID loads an order with a given ID
-	LoadByID(id string) (*models.Order, error)
+	LoadByID(ctx context.Context, id string) (*models.Order, error)
 
 	// LoadAll loads all orders
-	LoadAll() (*models.Orders, error)
+	LoadAll(ctx context.Context) (*models.Orders, error)
 
 	// LoadCompleted loads completed orders
-	LoadCompleted() (*models.Orders, error)
+	LoadCompleted(ctx context.Context) (*models.Orders, error)
 
 	// LoadIncomplete loads incomplete orders
-	LoadIncomplete() (*models.Orders, error)
+	LoadIncomplete(ctx context.Context) (*models.Orders, error)
+
+	// LoadByQuery loads orders matching a given query, sorted and paginated as the query specifies
+	LoadByQuery(ctx context.Context, query models.OrderQuery) (*models.Orders, error)
 
-	// DeleteAll deletes all orders
-	DeleteAll() error
+	// IterateByQuery returns an iterator over the orders matching a given query, which loads orders
+	// in batches rather than all at once. The iterator must be closed when no longer needed
+	IterateByQuery(ctx context.Context, query models.OrderQuery) (OrderIterator, error)
 
-	// DeleteCompleted deletes completed orders
-	DeleteCompleted() error
+	// DeleteAll deletes all orders added before a given time and returns the number of orders deleted
+	DeleteAll(ctx context.Context, before time.Time) (int64, error)
+
+	// DeleteCompleted deletes completed orders added before a given time and returns the number of
+	// orders deleted
+	DeleteCompleted(ctx context.Context, before time.Time) (int64, error)
 
 	// UpdateOne updates a given order
-	UpdateOne(order *models.Order) error
+	UpdateOne(ctx context.Context, order *models.Order) error
+
+	// UpdateByID replaces the order with a given ID, which allows the order's ID to be changed. If
+	// another order already has the new ID, ErrDuplicate is returned
+	UpdateByID(ctx context.Context, id string, order *models.Order) error
+
+	// CloseManifest assigns a given manifest to all completed orders that are not yet in a manifest
+	// and returns the number of orders added to it
+	CloseManifest(ctx context.Context, manifest string) (int64, error)
+
+	// MarkExported records that the orders with the given IDs were sent by a given scheduled export
+	// and returns the number of orders marked
+	MarkExported(ctx context.Context, ids []string, export string) (int64, error)
+
+	// LoadManifests loads the IDs of all closed manifests, most recent first
+	LoadManifests(ctx context.Context) ([]string, error)
 
 	// InsertOne insert a new order
-	InsertOne(order *models.Order) error
+	InsertOne(ctx context.Context, order *models.Order) error
 
-	// InsertMany inserts multiple new orders
-	InsertMany(orders *models.Orders) error
+	// InsertMany inserts multiple new orders, skipping those whose package ID already exists, and
+	// returns the number of orders inserted. Existing orders are left unchanged, so inserting the same
+	// orders again has no effect
+	InsertMany(ctx context.Context, orders *models.Orders) (int64, error)
 
 	// CountAll counts all orders
-	CountAll() (int64, error)
+	CountAll(ctx context.Context) (int64, error)
 
 	// CountCompleted counts completed orders
-	CountCompleted() (int64, error)
+	CountCompleted(ctx context.Context) (int64, error)
 
 	// CountIncomplete counts incomplete orders
-	CountIncomplete() (int64, error)
+	CountIncomplete(ctx context.Context) (int64, error)
+
+	// CountByQuery counts orders matching a given query, ignoring pagination
+	CountByQuery(ctx context.Context, query models.OrderQuery) (int64, error)
+
+	// Ping checks that the database can be reached
+	Ping(ctx context.Context) error
+
+	// Close closes the connection to the database, which is shared by all repositories created with
+	// it, so it must only be called once the application has stopped using every repository
+	Close() error
+}
+
+// OrderIterator iterates over orders loaded from a repository
+type OrderIterator interface {
+	// Next advances to the next order, returning false when there are no more orders or an error occurred
+	Next() bool
+
+	// Order returns the current order
+	Order() *models.Order
+
+	// Err returns the error, if any, that stopped the iteration
+	Err() error
+
+	// Close releases the resources held by the iterator
+	Close() error
 }
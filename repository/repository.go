@@ -0,0 +1,24 @@
+package repository
+
+import "errors"
+
+// ErrNotFound is an error that indicates a record could not be found
+var ErrNotFound = errors.New("Order not found")
+
+// ErrDuplicate is an error that indicates a record could not be saved because another record has the
+// same unique key
+var ErrDuplicate = errors.New("Duplicate")
+
+// Repositories groups the repositories used by the application
+type Repositories struct {
+	Orders         OrderRepository
+	Audit          AuditRepository
+	ExportProfiles ExportProfileRepository
+	ImportProfiles ImportProfileRepository
+	Webhooks       WebhookRepository
+	Deliveries     WebhookDeliveryRepository
+	Users          UserRepository
+	Sessions       SessionRepository
+	APITokens      APITokenRepository
+	Stations       StationRepository
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"github.com/mikestefanello/otcscanner/models"
+)
+
+// StationRepository provides an interface for station repositories
+type StationRepository interface {
+	// LoadAll loads all stations, sorted by name
+	LoadAll() ([]models.Station, error)
+
+	// LoadByName loads a station with a given name
+	LoadByName(name string) (*models.Station, error)
+
+	// Save inserts or replaces a station, matched by name
+	Save(station *models.Station) error
+
+	// SaveLastScan sets the last scan of the station with a given name, without changing the rest of it
+	SaveLastScan(name string, scan models.Scan) error
+
+	// Delete deletes the station with a given name
+	Delete(name string) error
+}
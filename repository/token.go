@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/mikestefanello/otcscanner/models"
+)
+
+// APITokenRepository provides an interface for API token repositories
+type APITokenRepository interface {
+	// LoadAll loads all tokens, most recently created first
+	LoadAll() ([]models.APIToken, error)
+
+	// LoadByHash loads the token with a given hash
+	LoadByHash(hash string) (*models.APIToken, error)
+
+	// InsertOne inserts a new token
+	InsertOne(token *models.APIToken) error
+
+	// UpdateLastUsed sets the time the token with a given ID was last used
+	UpdateLastUsed(id string, t time.Time) error
+
+	// Delete deletes the token with a given ID
+	Delete(id string) error
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"github.com/mikestefanello/otcscanner/models"
+)
+
+// UserRepository provides an interface for user repositories
+type UserRepository interface {
+	// LoadAll loads all users, sorted by username
+	LoadAll() ([]models.User, error)
+
+	// LoadByUsername loads a user with a given username
+	LoadByUsername(username string) (*models.User, error)
+
+	// Save inserts or replaces a user, matched by username
+	Save(user *models.User) error
+
+	// Delete deletes the user with a given username
+	Delete(username string) error
+
+	// Count counts all users
+	Count() (int64, error)
+}
+
+// SessionRepository provides an interface for session repositories
+type SessionRepository interface {
+	// InsertOne inserts a new session
+	InsertOne(session *models.Session) error
+
+	// LoadByID loads a session with a given ID, including expired sessions
+	LoadByID(id string) (*models.Session, error)
+
+	// Delete deletes the session with a given ID
+	Delete(id string) error
+
+	// DeleteByUsername deletes every session of a given user
+	DeleteByUsername(username string) error
+
+	// DeleteExpired deletes every session that has expired
+	DeleteExpired() error
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"github.com/mikestefanello/otcscanner/models"
+)
+
+// WebhookRepository provides an interface for webhook subscription repositories
+type WebhookRepository interface {
+	// LoadAll loads all webhook subscriptions, sorted by name
+	LoadAll() ([]models.WebhookSubscription, error)
+
+	// LoadByName loads a webhook subscription with a given name
+	LoadByName(name string) (*models.WebhookSubscription, error)
+
+	// Save inserts or replaces a webhook subscription, matched by name
+	Save(subscription *models.WebhookSubscription) error
+
+	// Delete deletes the webhook subscription with a given name
+	Delete(name string) error
+}
+
+// WebhookDeliveryRepository provides an interface for webhook delivery log repositories
+type WebhookDeliveryRepository interface {
+	// InsertOne inserts a new delivery
+	InsertOne(delivery *models.WebhookDelivery) error
+
+	// UpdateOne replaces a given delivery, matched by ID
+	UpdateOne(delivery *models.WebhookDelivery) error
+
+	// LoadByID loads a delivery with a given ID
+	LoadByID(id string) (*models.WebhookDelivery, error)
+
+	// LoadRecent loads the most recent deliveries with a given status, or any status if empty,
+	// most recent first
+	LoadRecent(status string, limit int) ([]models.WebhookDelivery, error)
+
+	// LoadPending loads every delivery that has not yet been delivered or failed, oldest first
+	LoadPending() ([]models.WebhookDelivery, error)
+}
@@ -5,29 +5,138 @@ import (
 	"github.com/go-chi/chi/middleware"
 	"github.com/mikestefanello/otcscanner/config"
 	"github.com/mikestefanello/otcscanner/handlers"
+	"github.com/mikestefanello/otcscanner/logging"
+	"github.com/mikestefanello/otcscanner/metrics"
+	"github.com/mikestefanello/otcscanner/models"
 )
 
 // NewRouter returns a new router
 func NewRouter(cfg config.Config, h *handlers.HTTPHandler) *chi.Mux {
 	r := chi.NewRouter()
 
-	// Add basic auth
-	if cfg.HTTP.Auth.User != "" && cfg.HTTP.Auth.Password != "" {
-		auth := make(map[string]string)
-		auth[cfg.HTTP.Auth.User] = cfg.HTTP.Auth.Password
-		r.Use(middleware.BasicAuth("app", auth))
-	}
-
-	// Add routes
-	r.Get("/", h.ScanForm)
-	r.Post("/", h.ScanForm)
-	r.Get("/database", h.DatabasePage)
-	r.Post("/database/upload", h.DatabaseUpload)
-	r.Post("/database/delete/all", h.DatabaseDeleteAll)
-	r.Post("/database/delete/complete", h.DatabaseDeleteCompleted)
-	r.Post("/database/download/all", h.DatabaseDownloadAll)
-	r.Post("/database/download/completed", h.DatabaseDownloadCompleted)
-	r.Post("/database/download/incomplete", h.DatabaseDownloadIncomplete)
+	// Assign every request an ID and log it with the ID, so lines logged while handling a request
+	// can be correlated
+	r.Use(middleware.RequestID)
+	r.Use(logging.Middleware)
+
+	// Record metrics for every request
+	r.Use(metrics.Middleware)
+
+	// Add health checks, which do not require logging in so orchestrators can use them
+	r.Get("/healthz", h.Healthz)
+	r.Get("/readyz", h.Readyz)
+	r.Get("/version", h.Version)
+
+	// Add static files, which the login page needs before anyone has logged in
+	r.Get("/static/*", h.Static)
+
+	r.Group(func(r chi.Router) {
+		// Protect every form against cross-site request forgery
+		r.Use(h.CSRF)
+
+		// Add routes that do not require logging in
+		r.Get("/login", h.LoginForm)
+		r.Post("/login", h.LoginForm)
+
+		// Add routes that require logging in
+		r.Group(func(r chi.Router) {
+			r.Use(h.Authenticate)
+
+			r.Post("/logout", h.Logout)
+
+			// Add scanner routes
+			r.Group(func(r chi.Router) {
+				r.Use(h.Authorize(models.RoleScanner, models.TokenScopeScan))
+
+				r.Get("/", h.ScanForm)
+				r.Post("/", h.ScanForm)
+				r.Get("/station", h.StationSelect)
+				r.Post("/station", h.StationSelect)
+			})
+
+			// Add supervisor routes which only read orders
+			r.Group(func(r chi.Router) {
+				r.Use(h.Authorize(models.RoleSupervisor, models.TokenScopeRead))
+
+				r.Get("/orders", h.OrdersPage)
+				r.Get("/orders/{id}", h.OrderPage)
+				r.Get("/database", h.DatabasePage)
+				r.Post("/database/download/all", h.DatabaseDownloadAll)
+				r.Post("/database/download/completed", h.DatabaseDownloadCompleted)
+				r.Post("/database/download/incomplete", h.DatabaseDownloadIncomplete)
+				r.Post("/database/export", h.DatabaseExport)
+				r.Post("/database/manifest/download", h.DatabaseDownloadManifest)
+				r.Get("/database/export-profiles", h.ExportProfilesPage)
+				r.Get("/database/import-profiles", h.ImportProfilesPage)
+				r.Get("/api/orders/{id}", h.APIOrder)
+				r.Get("/api/export", h.APIExport)
+				r.Get("/api/export-profiles", h.APIExportProfiles)
+
+				// Metrics reveal order volumes, so Prometheus must scrape them with an API token
+				r.Method("GET", "/metrics", metrics.Handler())
+			})
+
+			// Add supervisor routes which change orders and profiles
+			r.Group(func(r chi.Router) {
+				r.Use(h.Authorize(models.RoleSupervisor, models.TokenScopeAdmin))
+
+				r.Get("/orders/{id}/edit", h.OrderEditForm)
+				r.Post("/orders/{id}/edit", h.OrderEditForm)
+				r.Get("/database/export-profiles/new", h.ExportProfileForm)
+				r.Post("/database/export-profiles/new", h.ExportProfileForm)
+				r.Get("/database/export-profiles/{name}", h.ExportProfileForm)
+				r.Post("/database/export-profiles/{name}", h.ExportProfileForm)
+				r.Post("/database/export-profiles/{name}/delete", h.ExportProfileDelete)
+				r.Get("/database/import-profiles/new", h.ImportProfileForm)
+				r.Post("/database/import-profiles/new", h.ImportProfileForm)
+				r.Get("/database/import-profiles/{name}", h.ImportProfileForm)
+				r.Post("/database/import-profiles/{name}", h.ImportProfileForm)
+				r.Post("/database/import-profiles/{name}/delete", h.ImportProfileDelete)
+				r.Post("/database/manifest/close", h.DatabaseCloseManifest)
+				r.Put("/api/orders/{id}", h.APIUpdateOrder)
+				r.Put("/api/export-profiles/{name}", h.APISaveExportProfile)
+				r.Delete("/api/export-profiles/{name}", h.APIDeleteExportProfile)
+			})
+
+			// Add admin routes which import orders
+			r.Group(func(r chi.Router) {
+				r.Use(h.Authorize(models.RoleAdmin, models.TokenScopeImport))
+
+				r.Post("/database/upload", h.DatabaseUpload)
+			})
+
+			// Add admin routes
+			r.Group(func(r chi.Router) {
+				r.Use(h.Authorize(models.RoleAdmin, models.TokenScopeAdmin))
+
+				r.Post("/database/delete/all", h.DatabaseDeleteAll)
+				r.Post("/database/delete/complete", h.DatabaseDeleteCompleted)
+				r.Get("/database/webhooks", h.WebhooksPage)
+				r.Get("/database/webhooks/new", h.WebhookForm)
+				r.Post("/database/webhooks/new", h.WebhookForm)
+				r.Get("/database/webhooks/deliveries/{id}", h.WebhookDeliveryPage)
+				r.Post("/database/webhooks/deliveries/{id}/redeliver", h.WebhookRedeliver)
+				r.Get("/database/webhooks/{name}", h.WebhookForm)
+				r.Post("/database/webhooks/{name}", h.WebhookForm)
+				r.Post("/database/webhooks/{name}/delete", h.WebhookDelete)
+				r.Get("/users", h.UsersPage)
+				r.Get("/users/new", h.UserForm)
+				r.Post("/users/new", h.UserForm)
+				r.Get("/users/{username}", h.UserForm)
+				r.Post("/users/{username}", h.UserForm)
+				r.Post("/users/{username}/delete", h.UserDelete)
+				r.Get("/stations", h.StationsPage)
+				r.Get("/stations/new", h.StationForm)
+				r.Post("/stations/new", h.StationForm)
+				r.Get("/stations/{name}", h.StationForm)
+				r.Post("/stations/{name}", h.StationForm)
+				r.Post("/stations/{name}/delete", h.StationDelete)
+				r.Get("/tokens", h.APITokensPage)
+				r.Post("/tokens", h.APITokensPage)
+				r.Post("/tokens/{id}/revoke", h.APITokenRevoke)
+			})
+		})
+	})
 
 	return r
 }
@@ -0,0 +1,73 @@
+package scheduler
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mikestefanello/otcscanner/config"
+)
+
+// partialSuffix is appended to the names of files while they are being stored, so whoever collects
+// them does not pick up incomplete files
+const partialSuffix = ".part"
+
+// Destination stores exported files
+type Destination interface {
+	// Store stores a file with a given name, reading its contents from r. A file is only given its
+	// name once it has been stored completely
+	Store(name string, r io.Reader) error
+
+	// String describes the destination without any credentials
+	String() string
+}
+
+// NewDestination creates a destination from the configured local directory or SFTP URL
+func NewDestination(cfg config.ScheduledExportConfig) (Destination, error) {
+	if !strings.HasPrefix(cfg.Destination, "sftp://") {
+		return localDestination{dir: cfg.Destination}, nil
+	}
+
+	u, err := url.Parse(cfg.Destination)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid export destination: %s", err.Error())
+	}
+
+	return newSFTPDestination(u, cfg.SFTP)
+}
+
+// localDestination stores exported files in a local directory
+type localDestination struct {
+	dir string
+}
+
+func (d localDestination) Store(name string, r io.Reader) error {
+	err := os.MkdirAll(d.dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(d.dir, name)
+	file, err := os.Create(path + partialSuffix)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + partialSuffix)
+		return err
+	}
+
+	return os.Rename(path+partialSuffix, path)
+}
+
+func (d localDestination) String() string {
+	return d.dir
+}
@@ -0,0 +1,268 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mikestefanello/otcscanner/config"
+	"github.com/mikestefanello/otcscanner/export"
+	"github.com/mikestefanello/otcscanner/metrics"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+)
+
+// markBatchSize is the number of orders marked as exported at a time
+const markBatchSize = 1000
+
+// Status describes the state of a scheduler
+type Status struct {
+	// Enabled determines if orders are exported on a schedule
+	Enabled      bool
+	Schedule     string
+	Destination  string
+	Format       string
+	Profile      string
+	MarkExported bool
+
+	// Next is the time of the next scheduled export
+	Next time.Time
+
+	// Last is the most recent export, if any
+	Last *Run
+}
+
+// Run describes the outcome of a scheduled export
+type Run struct {
+	Time time.Time
+
+	// Filename is the name of the stored file, which is empty if there were no orders to export
+	Filename string
+	Count    int
+
+	// Error describes why the export failed, if it did
+	Error string
+}
+
+// Scheduler exports completed orders on a schedule, using the existing export formats, to a local
+// directory or an SFTP server. Exported orders can be marked so they are not sent twice
+type Scheduler struct {
+	config   config.ScheduledExportConfig
+	repo     repository.OrderRepository
+	profiles repository.ExportProfileRepository
+	format   export.Format
+	dest     Destination
+	cron     *cron.Cron
+	mu       sync.Mutex
+	last     *Run
+}
+
+// New creates a new scheduler, checking that the schedule, format and destination are valid
+func New(cfg config.ScheduledExportConfig, repo repository.OrderRepository, profiles repository.ExportProfileRepository) (*Scheduler, error) {
+	s := &Scheduler{
+		config:   cfg,
+		repo:     repo,
+		profiles: profiles,
+		cron:     cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DiscardLogger))),
+	}
+
+	if cfg.Schedule == "" {
+		return s, nil
+	}
+
+	var ok bool
+	s.format, ok = export.GetFormat(cfg.Format)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported scheduled export format: %s", cfg.Format)
+	}
+
+	var err error
+	s.dest, err = NewDestination(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.cron.AddFunc(cfg.Schedule, func() {
+		s.Export(context.Background())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Invalid export schedule: %s", err.Error())
+	}
+
+	return s, nil
+}
+
+// Start starts running exports on the schedule in the background
+func (s *Scheduler) Start() {
+	if s.config.Schedule == "" {
+		return
+	}
+
+	log.Info().
+		Str("schedule", s.config.Schedule).
+		Str("destination", s.dest.String()).
+		Msg("Scheduled exports of completed orders.")
+
+	s.cron.Start()
+}
+
+// Stop stops running exports on the schedule and waits for a running export to finish
+func (s *Scheduler) Stop() {
+	<-s.cron.Stop().Done()
+}
+
+// Status returns the current status of the scheduler
+func (s *Scheduler) Status() Status {
+	status := Status{
+		Enabled:      s.config.Schedule != "",
+		Schedule:     s.config.Schedule,
+		Format:       s.config.Format,
+		Profile:      s.config.Profile,
+		MarkExported: s.config.MarkExported,
+	}
+
+	if !status.Enabled {
+		return status
+	}
+
+	status.Destination = s.dest.String()
+	if entries := s.cron.Entries(); len(entries) > 0 {
+		status.Next = entries[0].Next
+	}
+
+	s.mu.Lock()
+	status.Last = s.last
+	s.mu.Unlock()
+
+	return status
+}
+
+// Export exports completed orders to the destination and, if configured, marks them as exported
+func (s *Scheduler) Export(ctx context.Context) Run {
+	run := Run{
+		Time: time.Now(),
+	}
+	run.Filename = fmt.Sprintf("completed-%s.%s", run.Time.Format("20060102-150405"), s.format.Name)
+
+	var err error
+	run.Count, err = s.export(ctx, run.Filename)
+	metrics.ObserveExport(metrics.ExportScheduled, s.format.Name, time.Since(run.Time))
+
+	switch {
+	case err != nil:
+		run.Error = err.Error()
+		log.Error().Err(err).Str("filename", run.Filename).Msg("Unable to run scheduled export.")
+	case run.Count == 0:
+		run.Filename = ""
+		log.Info().Msg("No completed orders to export on schedule.")
+	default:
+		log.Info().
+			Str("filename", run.Filename).
+			Str("destination", s.dest.String()).
+			Int("count", run.Count).
+			Dur("duration", time.Since(run.Time)).
+			Msg("Ran scheduled export.")
+	}
+
+	s.mu.Lock()
+	s.last = &run
+	s.mu.Unlock()
+
+	return run
+}
+
+// export writes the orders to a temporary file, stores it at the destination and marks the orders
+func (s *Scheduler) export(ctx context.Context, filename string) (int, error) {
+	columns := export.DefaultColumns()
+	if s.config.Profile != "" {
+		profile, err := s.profiles.LoadByName(s.config.Profile)
+		if err != nil {
+			if err == repository.ErrNotFound {
+				return 0, fmt.Errorf("Export profile not found: %s", s.config.Profile)
+			}
+			return 0, fmt.Errorf("Unable to load export profile: %s", err.Error())
+		}
+		columns = profile.Columns
+	}
+
+	it, err := s.repo.IterateByQuery(ctx, models.OrderQuery{
+		Status:     models.OrderStatusCompleted,
+		Unexported: s.config.MarkExported,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("Unable to load orders: %s", err.Error())
+	}
+	defer it.Close()
+
+	// Write the file locally first, so the orders are not held in memory and a failure part way
+	// through does not leave an incomplete file at the destination
+	tmp, err := os.CreateTemp("", "export-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	ids := &idWriter{Writer: s.format.NewWriter(tmp, columns)}
+	count, err := export.WriteAll(ids, it)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to write orders: %s", err.Error())
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.dest.Store(filename, tmp)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to store export: %s", err.Error())
+	}
+
+	if s.config.MarkExported {
+		err = s.markExported(ctx, ids.ids, filename)
+		if err != nil {
+			return count, fmt.Errorf("The export was stored but the orders could not be marked as exported, so they will be exported again: %s", err.Error())
+		}
+	}
+
+	return count, nil
+}
+
+// markExported marks the orders with the given IDs as exported, in batches so large exports do not
+// exceed the database's limits
+func (s *Scheduler) markExported(ctx context.Context, ids []string, filename string) error {
+	for start := 0; start < len(ids); start += markBatchSize {
+		end := start + markBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		_, err := s.repo.MarkExported(ctx, ids[start:end], filename)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// idWriter records the IDs of the orders written by a writer
+type idWriter struct {
+	export.Writer
+	ids []string
+}
+
+func (w *idWriter) Write(order *models.Order) error {
+	w.ids = append(w.ids, order.PackageID)
+	return w.Writer.Write(order)
+}
@@ -0,0 +1,143 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+
+	"github.com/mikestefanello/otcscanner/config"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpDefaultPort is the port used if the SFTP URL does not contain one
+const sftpDefaultPort = "22"
+
+// sftpDestination stores exported files in a directory on an SFTP server. A new connection is made
+// for each file since exports are infrequent
+type sftpDestination struct {
+	addr      string
+	dir       string
+	sshConfig *ssh.ClientConfig
+	display   string
+}
+
+// newSFTPDestination creates an SFTP destination from a URL such as sftp://user@host:22/path
+func newSFTPDestination(u *url.URL, cfg config.SFTPConfig) (*sftpDestination, error) {
+	if u.Hostname() == "" || u.User.Username() == "" {
+		return nil, errors.New("The SFTP export destination must include a user and host")
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = sftpDefaultPort
+	}
+
+	// Authenticate with the password in the URL or config, and the private key if one is provided
+	auth := []ssh.AuthMethod{}
+
+	password, ok := u.User.Password()
+	if !ok {
+		password = cfg.Password
+	}
+	if password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+
+	if cfg.KeyFile != "" {
+		key, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read SFTP private key: %s", err.Error())
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse SFTP private key: %s", err.Error())
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+
+	if len(auth) == 0 {
+		return nil, errors.New("An SFTP password or private key is required")
+	}
+
+	// Verify the server's host key
+	var hostKeyCallback ssh.HostKeyCallback
+	switch {
+	case cfg.KnownHostsFile != "":
+		var err error
+		hostKeyCallback, err = knownhosts.New(cfg.KnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load SFTP known hosts: %s", err.Error())
+		}
+	case cfg.InsecureHostKey:
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, errors.New("An SFTP known hosts file is required unless host key checking is disabled")
+	}
+
+	display := *u
+	display.User = url.User(u.User.Username())
+
+	return &sftpDestination{
+		addr: net.JoinHostPort(u.Hostname(), port),
+		dir:  u.Path,
+		sshConfig: &ssh.ClientConfig{
+			User:            u.User.Username(),
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         cfg.Timeout,
+		},
+		display: display.String(),
+	}, nil
+}
+
+func (d *sftpDestination) Store(name string, r io.Reader) error {
+	conn, err := ssh.Dial("tcp", d.addr, d.sshConfig)
+	if err != nil {
+		return fmt.Errorf("Unable to connect to SFTP server: %s", err.Error())
+	}
+	defer conn.Close()
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return fmt.Errorf("Unable to start SFTP session: %s", err.Error())
+	}
+	defer client.Close()
+
+	dir := d.dir
+	if dir == "" {
+		dir = "."
+	}
+
+	err = client.MkdirAll(dir)
+	if err != nil {
+		return err
+	}
+
+	filePath := path.Join(dir, name)
+	file, err := client.Create(filePath + partialSuffix)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.ReadFrom(r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		client.Remove(filePath + partialSuffix)
+		return err
+	}
+
+	return client.Rename(filePath+partialSuffix, filePath)
+}
+
+func (d *sftpDestination) String() string {
+	return d.display
+}
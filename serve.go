@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+
+	"github.com/mikestefanello/otcscanner/auth"
+	"github.com/mikestefanello/otcscanner/config"
+	"github.com/mikestefanello/otcscanner/handlers"
+	"github.com/mikestefanello/otcscanner/importer"
+	"github.com/mikestefanello/otcscanner/manifest"
+	"github.com/mikestefanello/otcscanner/metrics"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+	"github.com/mikestefanello/otcscanner/router"
+	"github.com/mikestefanello/otcscanner/scheduler"
+	"github.com/mikestefanello/otcscanner/watcher"
+	"github.com/mikestefanello/otcscanner/webhook"
+)
+
+// serve runs the web application until it receives a signal to stop
+func serve(cfg config.Config, fs *flag.FlagSet, args []string) error {
+	err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	// Check that every service has a usable manifest format
+	err = manifest.ValidateServiceFormats(cfg.Manifest.Formats)
+	if err != nil {
+		return err
+	}
+
+	// Create the indexes before anything is imported, as imports skip orders that already exist
+	err = ensureIndexes(context.Background(), cfg)
+	if err != nil {
+		return err
+	}
+
+	// Create the repositories
+	repos, err := repository.NewMongoRepositories(cfg.Mongo)
+	if err != nil {
+		return fmt.Errorf("Unable to connect to repository: %s", err.Error())
+	}
+	repos.Orders = metrics.InstrumentOrderRepository(repos.Orders)
+
+	// Create an admin user from the configured credentials if there are no users
+	seeded, err := auth.SeedAdmin(repos.Users, cfg.HTTP.Auth)
+	if err != nil {
+		return fmt.Errorf("Unable to create admin user: %s", err.Error())
+	}
+	if seeded {
+		log.Info().Str("user", cfg.HTTP.Auth.User).Msg("Created admin user from HTTP auth credentials.")
+	}
+
+	// Create or replace the configured stations
+	err = syncStations(repos.Stations, cfg.Stations)
+	if err != nil {
+		return fmt.Errorf("Unable to save configured stations: %s", err.Error())
+	}
+
+	userCount, err := repos.Users.Count()
+	if err != nil {
+		return fmt.Errorf("Unable to load users: %s", err.Error())
+	}
+	if userCount == 0 {
+		log.Warn().Msg("There are no users, so anyone can use the application without logging in. Create an admin user to require logging in.")
+	}
+
+	// Create the scheduler of exports before starting any background work, as the schedule may be invalid
+	exportScheduler, err := scheduler.New(cfg.Export, repos.Orders, repos.ExportProfiles)
+	if err != nil {
+		return err
+	}
+
+	hooks := webhook.New(cfg.Webhook, repos.Webhooks, repos.Deliveries)
+	importWatcher := watcher.New(cfg.ImportWatch, importer.New(repos.Orders, validator.New()), repos.ImportProfiles, hooks)
+
+	// Create an HTTP handler before starting any background work, as the templates may be invalid
+	handler, err := handlers.NewHTTPHandler(cfg, repos, importWatcher, exportScheduler, hooks)
+	if err != nil {
+		return err
+	}
+
+	// Start delivering webhook events
+	hooks.Start()
+
+	// Start importing files dropped in to the watched directory, if one is configured
+	watcherCtx, stopWatcher := context.WithCancel(context.Background())
+	watcherDone := make(chan struct{})
+	go func() {
+		importWatcher.Run(watcherCtx)
+		close(watcherDone)
+	}()
+
+	// Start exporting completed orders on a schedule, if one is configured
+	exportScheduler.Start()
+
+	// Load the router
+	r := router.NewRouter(cfg, handler)
+
+	// Start the server. Requests are derived from a context which is cancelled when shutting down, so
+	// long requests such as exports stop if they do not finish in time
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	var requests sync.WaitGroup
+
+	srv := &http.Server{
+		Addr:              fmt.Sprintf("%s:%d", cfg.HTTP.Hostname, cfg.HTTP.Port),
+		Handler:           trackRequests(r, &requests),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+		BaseContext: func(net.Listener) context.Context {
+			return requestCtx
+		},
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Info().Str("on", srv.Addr).Msg("Server started")
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	// Wait for a signal to stop, or for the server to fail, in which case everything else is stopped
+	// before the error is returned
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	var serveErr error
+	select {
+	case sig := <-quit:
+		log.Info().Str("signal", sig.String()).Msg("Shutting down")
+	case serveErr = <-serverErr:
+		log.Error().Err(serveErr).Msg("Server terminated")
+		serveErr = fmt.Errorf("Unable to serve: %s", serveErr.Error())
+	}
+
+	// Stop accepting requests and wait for those in flight to finish. Requests still running after
+	// the timeout are cancelled, and their handlers must return before the database is disconnected
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	err = srv.Shutdown(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to finish in-flight requests before shutting down, so they are being cancelled")
+	}
+	cancelRequests()
+	requests.Wait()
+
+	// Stop the background workers, waiting for their work in progress to finish
+	stopWatcher()
+	<-watcherDone
+	exportScheduler.Stop()
+	hooks.Stop()
+
+	// Disconnect from the database once nothing is using it
+	err = repos.Orders.Close()
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to disconnect from the database")
+	}
+
+	log.Info().Msg("Server stopped")
+
+	return serveErr
+}
+
+// trackRequests wraps a handler so the requests it is handling can be waited for
+func trackRequests(next http.Handler, requests *sync.WaitGroup) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		defer requests.Done()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// syncStations saves the configured stations, keeping the last scan of those that already exist.
+// Stations that are no longer configured are kept, but can then be changed from the stations page
+func syncStations(stations repository.StationRepository, configured []config.StationConfig) error {
+	existing, err := stations.LoadAll()
+	if err != nil {
+		return err
+	}
+
+	byName := make(map[string]models.Station, len(existing))
+	for _, station := range existing {
+		byName[station.Name] = station
+	}
+
+	for _, c := range configured {
+		station := models.Station{
+			Name:       c.Name,
+			Service:    c.Service,
+			Account:    c.Account,
+			UnitSystem: c.UnitSystem,
+			Scale:      c.Scale,
+			Printer:    c.Printer,
+			Configured: true,
+			LastScan:   byName[c.Name].LastScan,
+		}
+		if station.UnitSystem == "" {
+			station.UnitSystem = models.UnitSystemImperial
+		}
+
+		err = stations.Save(&station)
+		if err != nil {
+			return err
+		}
+		delete(byName, c.Name)
+	}
+
+	for _, station := range byName {
+		if !station.Configured {
+			continue
+		}
+
+		station.Configured = false
+		err = stations.Save(&station)
+		if err != nil {
+			return err
+		}
+		log.Info().Str("station", station.Name).Msg("Station is no longer configured, so it can be changed from the stations page.")
+	}
+
+	if len(configured) > 0 {
+		log.Info().Int("count", len(configured)).Msg("Saved configured stations.")
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTrackRequests(t *testing.T) {
+	tests := []struct {
+		name         string
+		work         time.Duration
+		timeout      time.Duration
+		wantShutdown bool
+		wantStatus   int
+	}{
+		{
+			name:         "request finishes before the timeout",
+			work:         50 * time.Millisecond,
+			timeout:      time.Second,
+			wantShutdown: true,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:       "request is cancelled after the timeout",
+			work:       time.Minute,
+			timeout:    50 * time.Millisecond,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			requestCtx, cancelRequests := context.WithCancel(context.Background())
+			defer cancelRequests()
+			var requests sync.WaitGroup
+
+			started := make(chan struct{})
+			var finished bool
+			srv := httptest.NewUnstartedServer(trackRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				select {
+				case <-time.After(tc.work):
+					w.WriteHeader(http.StatusOK)
+				case <-r.Context().Done():
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+				finished = true
+			}), &requests))
+			srv.Config.BaseContext = func(net.Listener) context.Context {
+				return requestCtx
+			}
+			srv.Start()
+			defer srv.Close()
+
+			status := make(chan int, 1)
+			go func() {
+				resp, err := http.Get(srv.URL)
+				if err != nil {
+					status <- 0
+					return
+				}
+				resp.Body.Close()
+				status <- resp.StatusCode
+			}()
+			<-started
+
+			// Shut down as the server does, then wait for the handler to return
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			err := srv.Config.Shutdown(ctx)
+			if (err == nil) != tc.wantShutdown {
+				t.Errorf("expected shutdown to finish in time: %v, got error %v", tc.wantShutdown, err)
+			}
+			cancelRequests()
+			requests.Wait()
+
+			if !finished {
+				t.Fatal("expected the handler to return before waiting finished")
+			}
+			if got := <-status; got != tc.wantStatus {
+				t.Errorf("expected status %d, got %d", tc.wantStatus, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+//go:build ignore
+
+// This program downloads the third party files listed in lib/VERSIONS in to the lib directory and
+// checks them against their pinned hashes. Files which are already present and match their hash are
+// not downloaded again. Run it with "go generate ./static" after changing a version, then commit the
+// files, as they are not downloaded when the application is built
+package main
+
+import (
+	"bufio"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// unpinned is the hash given for files whose hash has not been pinned yet
+const unpinned = "-"
+
+// libDir is the directory the files are written to
+const libDir = "lib"
+
+// file is a third party file listed in lib/VERSIONS
+type file struct {
+	name string
+	url  string
+	hash string
+}
+
+func main() {
+	files, err := readVersions(filepath.Join(libDir, "VERSIONS"))
+	if err != nil {
+		fail(err)
+	}
+
+	client := &http.Client{Timeout: time.Minute}
+
+	for _, f := range files {
+		path := filepath.Join(libDir, f.name)
+
+		if f.hash != unpinned {
+			data, err := os.ReadFile(path)
+			if err == nil && hash(data) == f.hash {
+				continue
+			}
+		}
+
+		data, err := download(client, f.url)
+		if err != nil {
+			fail(fmt.Errorf("Unable to download %s: %s", f.name, err.Error()))
+		}
+
+		if f.hash == unpinned {
+			fmt.Printf("%s is not pinned; its hash is %s\n", f.name, hash(data))
+		} else if hash(data) != f.hash {
+			fail(fmt.Errorf("%s does not match its pinned hash: got %s, want %s", f.name, hash(data), f.hash))
+		}
+
+		err = os.WriteFile(path, data, 0644)
+		if err != nil {
+			fail(err)
+		}
+
+		fmt.Printf("Downloaded %s\n", f.name)
+	}
+}
+
+// readVersions reads the files listed in a versions file, skipping blank lines and comments
+func readVersions(path string) ([]file, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	var files []file
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("Invalid line in %s: %s", path, line)
+		}
+		files = append(files, file{name: fields[0], url: fields[1], hash: fields[2]})
+	}
+
+	return files, scanner.Err()
+}
+
+// download returns the body of a URL
+func download(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// hash returns the hash of a file in the format used by subresource integrity attributes
+func hash(data []byte) string {
+	sum := sha512.Sum384(data)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err.Error())
+	os.Exit(1)
+}
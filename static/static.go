@@ -0,0 +1,15 @@
+// Package static contains the CSS, JavaScript and other files served from /static, which are
+// embedded in the binary so pages do not depend on any other host
+package static
+
+import "embed"
+
+// The third party files in the lib directory are committed along with their hashes in lib/VERSIONS,
+// which are checked when the application starts. When a version changes, they are downloaded again with
+// "go generate ./static", which prints the hash to pin for files whose hash is "-"
+//go:generate go run fetch.go
+
+// FS contains the application's own files in the css directory and third party files in the lib directory
+//
+//go:embed css lib
+var FS embed.FS
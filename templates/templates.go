@@ -0,0 +1,11 @@
+// Package templates contains the HTML templates of the web application, which are embedded in the
+// binary so it can be run from any directory
+package templates
+
+import "embed"
+
+// FS contains the page templates and, in the global directory, the layout and partials every page
+// template is parsed with
+//
+//go:embed *.html global/*.html
+var FS embed.FS
@@ -0,0 +1,49 @@
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Version is the released version of the application, which is set when building with
+// -ldflags "-X github.com/mikestefanello/otcscanner/version.Version=v1.2.3"
+var Version = "dev"
+
+// Info describes the build of the running application
+type Info struct {
+	Version string `json:"version"`
+
+	// Revision, Time and Modified describe the commit the application was built from, if it was built
+	// from a version control checkout
+	Revision string `json:"revision,omitempty"`
+	Time     string `json:"time,omitempty"`
+	Modified bool   `json:"modified,omitempty"`
+
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns the build information of the running application
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		GoVersion: runtime.Version(),
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	for _, s := range build.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.Time = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+
+	return info
+}
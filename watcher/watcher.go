@@ -0,0 +1,388 @@
+package watcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikestefanello/otcscanner/config"
+	"github.com/mikestefanello/otcscanner/importer"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+	"github.com/mikestefanello/otcscanner/webhook"
+	"github.com/rs/zerolog/log"
+)
+
+// Subdirectories of the watched directory that files are moved to once they have been imported
+const (
+	ProcessedDir = "processed"
+	FailedDir    = "failed"
+)
+
+// maxRecentFiles is the number of recently imported files included in the status
+const maxRecentFiles = 20
+
+// reportSuffix is appended to the name of a failed file to name its error report
+const reportSuffix = ".errors.txt"
+
+// formats contains the file formats that are imported, keyed by file extension
+var formats = map[string]bool{
+	"csv":    true,
+	"xlsx":   true,
+	"jsonl":  true,
+	"ndjson": true,
+}
+
+// Status describes the state of a watcher
+type Status struct {
+	// Enabled determines if a directory is being watched
+	Enabled  bool
+	Dir      string
+	Interval time.Duration
+
+	// LastScan is the time the directory was last checked for new files
+	LastScan time.Time
+
+	// LastError describes the problem with the last scan of the directory, if any
+	LastError string
+
+	// Files contains the most recently imported files, most recent first
+	Files []FileResult
+}
+
+// FileResult describes the outcome of importing a single file
+type FileResult struct {
+	Name      string
+	Time      time.Time
+	Added     int
+	Skipped   int
+	Profile   string
+	Unmatched []string
+
+	// Error describes why the file failed to import, if it did
+	Error string
+
+	// Report is the name of the error report written alongside a failed file
+	Report string
+}
+
+// Failed determines if the file failed to import
+func (f FileResult) Failed() bool {
+	return f.Error != ""
+}
+
+// unmovedFile is a file that was imported but could not be moved afterwards
+type unmovedFile struct {
+	// hash is the hash of the file's contents when it was imported
+	hash   string
+	dest   string
+	result FileResult
+	err    error
+}
+
+// Watcher periodically imports order files dropped in to a directory. Each file is imported using
+// the same pipeline as uploaded files, then moved to the processed or failed subdirectory. An error
+// report is written alongside each failed file
+type Watcher struct {
+	config   config.ImportWatchConfig
+	importer *importer.Importer
+	profiles repository.ImportProfileRepository
+	hooks    *webhook.Dispatcher
+	mu       sync.Mutex
+	status   Status
+
+	// unmoved contains the files that could not be moved once imported, keyed by name. It is only
+	// used by the goroutine scanning the directory, so it is not guarded by the mutex
+	unmoved map[string]unmovedFile
+}
+
+// New creates a new watcher
+func New(cfg config.ImportWatchConfig, imp *importer.Importer, profiles repository.ImportProfileRepository, hooks *webhook.Dispatcher) *Watcher {
+	return &Watcher{
+		config:   cfg,
+		importer: imp,
+		profiles: profiles,
+		hooks:    hooks,
+		unmoved:  make(map[string]unmovedFile),
+		status: Status{
+			Enabled:  cfg.Dir != "",
+			Dir:      cfg.Dir,
+			Interval: cfg.Interval,
+		},
+	}
+}
+
+// Run checks the directory for new files at the configured interval until the context is done.
+// It returns immediately if no directory is configured
+func (w *Watcher) Run(ctx context.Context) {
+	if w.config.Dir == "" {
+		return
+	}
+
+	log.Info().Str("dir", w.config.Dir).Dur("interval", w.config.Interval).Msg("Watching directory for order files.")
+
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.scan(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status returns the current status of the watcher
+func (w *Watcher) Status() Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := w.status
+	status.Files = append([]FileResult(nil), w.status.Files...)
+	return status
+}
+
+// scan imports every file in the directory that is ready to be imported
+func (w *Watcher) scan(ctx context.Context) {
+	names, err := w.readyFiles()
+
+	w.mu.Lock()
+	w.status.LastScan = time.Now()
+	w.status.LastError = ""
+	if err != nil {
+		w.status.LastError = err.Error()
+	}
+	w.mu.Unlock()
+
+	if err != nil {
+		log.Error().Err(err).Str("dir", w.config.Dir).Msg("Unable to check watched directory for order files.")
+		return
+	}
+
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if w.retryMove(name) {
+			continue
+		}
+
+		result := w.importFile(name)
+
+		w.mu.Lock()
+		w.status.Files = append([]FileResult{result}, w.status.Files...)
+		if len(w.status.Files) > maxRecentFiles {
+			w.status.Files = w.status.Files[:maxRecentFiles]
+		}
+		w.mu.Unlock()
+	}
+}
+
+// readyFiles returns the names of the files in the directory which have a supported format and have not
+// been modified recently, sorted by name. The processed and failed subdirectories are created if needed
+func (w *Watcher) readyFiles() ([]string, error) {
+	for _, dir := range []string{ProcessedDir, FailedDir} {
+		err := os.MkdirAll(filepath.Join(w.config.Dir, dir), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := os.ReadDir(w.config.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		if !formats[importer.FormatFromFilename(entry.Name())] {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < w.config.Settle {
+			continue
+		}
+
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// importFile imports a single file and moves it to the processed or failed subdirectory. If the file
+// cannot be moved, it is recorded so it is not imported again while moving it is retried
+func (w *Watcher) importFile(name string) FileResult {
+	result := FileResult{
+		Name: name,
+		Time: time.Now(),
+	}
+
+	path := filepath.Join(w.config.Dir, name)
+	hash, hashErr := fileHash(path)
+
+	importResult, err := w.importPath(path)
+	result.Added = importResult.Added
+	result.Skipped = importResult.Skipped
+	result.Profile = importResult.Profile
+	result.Unmatched = importResult.Unmatched
+
+	// Files are renamed when moved so files with the same name dropped at different times are all kept
+	dest := fmt.Sprintf("%s-%s", result.Time.Format("20060102-150405"), name)
+
+	if err == nil {
+		log.Info().Str("file", name).Int("count", result.Added).Str("profile", result.Profile).Msg("Imported orders from watched directory.")
+		w.hooks.Trigger(models.WebhookEventOrdersImported, webhook.ImportEvent{
+			Source:   webhook.ImportSourceWatch,
+			Filename: name,
+			Count:    result.Added,
+			Profile:  result.Profile,
+		})
+	} else {
+		result.Error = err.Error()
+		log.Error().Err(err).Str("file", name).Int("added", result.Added).Msg("Unable to import orders from watched directory.")
+	}
+
+	if !w.finish(name, dest, &result, err) && hashErr == nil {
+		w.unmoved[name] = unmovedFile{hash: hash, dest: dest, result: result, err: err}
+	}
+
+	return result
+}
+
+// retryMove moves a file that could not be moved once it was imported, and reports if the file was
+// already imported. A file whose contents have changed since is imported again
+func (w *Watcher) retryMove(name string) bool {
+	pending, ok := w.unmoved[name]
+	if !ok {
+		return false
+	}
+
+	hash, err := fileHash(filepath.Join(w.config.Dir, name))
+	if err != nil || hash != pending.hash {
+		delete(w.unmoved, name)
+		return false
+	}
+
+	result := pending.result
+	if w.finish(name, pending.dest, &result, pending.err) {
+		delete(w.unmoved, name)
+		log.Info().Str("file", name).Msg("Moved previously imported file in watched directory.")
+	}
+
+	return true
+}
+
+// finish moves an imported file to the processed or failed subdirectory, depending on whether the
+// import failed, and writes the error report of a failed file. It reports if the file was moved
+func (w *Watcher) finish(name, dest string, result *FileResult, importErr error) bool {
+	if importErr == nil {
+		return w.move(name, filepath.Join(ProcessedDir, dest), result)
+	}
+
+	if !w.move(name, filepath.Join(FailedDir, dest), result) {
+		return false
+	}
+
+	result.Report = dest + reportSuffix
+	reportErr := w.writeReport(filepath.Join(w.config.Dir, FailedDir, result.Report), *result, importErr)
+	if reportErr != nil {
+		log.Error().Err(reportErr).Str("file", name).Msg("Unable to write import error report.")
+		result.Report = ""
+	}
+
+	return true
+}
+
+// importPath imports the orders in a file, detecting the import profile from the file's columns
+func (w *Watcher) importPath(path string) (importer.Result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return importer.Result{}, err
+	}
+	defer file.Close()
+
+	opts := importer.Options{
+		Format: importer.FormatFromFilename(path),
+	}
+
+	opts.Profiles, err = w.profiles.LoadAll()
+	if err != nil {
+		return importer.Result{}, fmt.Errorf("Unable to load import profiles: %s", err.Error())
+	}
+
+	// The import is not cancelled when the watcher stops, so a file is never left partly imported
+	return w.importer.Import(context.Background(), file, opts)
+}
+
+// move moves a file within the directory, recording any failure on the result, and reports if it succeeded.
+// A file that cannot be moved stays in the directory until it is moved on a later scan, so this is always logged
+func (w *Watcher) move(name, dest string, result *FileResult) bool {
+	err := os.Rename(filepath.Join(w.config.Dir, name), filepath.Join(w.config.Dir, dest))
+	if err != nil {
+		log.Error().Err(err).Str("file", name).Str("dest", dest).Msg("Unable to move file in watched directory.")
+		if result.Error == "" {
+			result.Error = fmt.Sprintf("Unable to move file: %s", err.Error())
+		}
+		return false
+	}
+	return true
+}
+
+// writeReport writes a report describing why a file failed to import
+func (w *Watcher) writeReport(path string, result FileResult, err error) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "File: %s\n", result.Name)
+	fmt.Fprintf(&b, "Time: %s\n", result.Time.Format(time.RFC3339))
+	if result.Profile != "" {
+		fmt.Fprintf(&b, "Import profile: %s\n", result.Profile)
+	}
+	if result.Added > 0 {
+		fmt.Fprintf(&b, "Orders added before the failure: %d\n", result.Added)
+	}
+	if len(result.Unmatched) > 0 {
+		fmt.Fprintf(&b, "Columns not imported: %s\n", strings.Join(result.Unmatched, ", "))
+	}
+
+	b.WriteString("\nErrors:\n")
+	for _, msg := range importer.ErrorMessages(err, 0) {
+		fmt.Fprintf(&b, "%s\n", msg)
+	}
+
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// fileHash returns the hash of a file's contents
+func fileHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
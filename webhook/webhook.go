@@ -0,0 +1,456 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mikestefanello/otcscanner/config"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+	"github.com/rs/zerolog/log"
+)
+
+// Headers sent with every delivery. The signature is the hex encoded HMAC-SHA256 of the timestamp,
+// a period and the body, keyed by the subscription's secret, prefixed with "sha256="
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// queueSize is the number of deliveries that can wait for a worker
+const queueSize = 1000
+
+// maxResponseLength is the number of bytes of each response that are kept in the delivery log
+const maxResponseLength = 1024
+
+// OrderEvent is the data sent for events about a single order
+type OrderEvent struct {
+	Order *models.Order `json:"order"`
+	Actor string        `json:"actor,omitempty"`
+}
+
+// ImportEvent is the data sent when orders are imported
+type ImportEvent struct {
+	// Source is where the orders were imported from: an upload, the watched directory or the command line
+	Source   string `json:"source"`
+	Filename string `json:"filename"`
+	Count    int    `json:"count"`
+	Profile  string `json:"profile,omitempty"`
+	Actor    string `json:"actor,omitempty"`
+}
+
+// Import sources
+const (
+	ImportSourceUpload  = "upload"
+	ImportSourceWatch   = "watch"
+	ImportSourceCommand = "command"
+)
+
+// DeleteEvent is the data sent when orders are deleted
+type DeleteEvent struct {
+	Operation string `json:"operation"`
+	Count     int64  `json:"count"`
+	Reason    string `json:"reason"`
+	Actor     string `json:"actor,omitempty"`
+	Approver  string `json:"approver,omitempty"`
+}
+
+// Dispatcher delivers events to the webhook subscriptions that receive them. Every delivery is logged,
+// and failed deliveries are retried with an exponential backoff until the maximum number of attempts
+// is reached, after which they can be redelivered manually. Pending deliveries are also loaded from the
+// database periodically, so those that could not be queued are delivered
+type Dispatcher struct {
+	config        config.WebhookConfig
+	subscriptions repository.WebhookRepository
+	deliveries    repository.WebhookDeliveryRepository
+	client        *http.Client
+	queue         chan string
+	done          chan struct{}
+	wg            sync.WaitGroup
+	stopOnce      sync.Once
+
+	// triggers tracks the events whose deliveries are being created
+	triggers sync.WaitGroup
+
+	// queued contains the IDs of the deliveries that are queued or being delivered, so a delivery is
+	// never queued twice
+	mu     sync.Mutex
+	queued map[string]bool
+}
+
+// New creates a new dispatcher
+func New(cfg config.WebhookConfig, subscriptions repository.WebhookRepository, deliveries repository.WebhookDeliveryRepository) *Dispatcher {
+	return &Dispatcher{
+		config:        cfg,
+		subscriptions: subscriptions,
+		deliveries:    deliveries,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+		},
+		queue:  make(chan string, queueSize),
+		done:   make(chan struct{}),
+		queued: make(map[string]bool),
+	}
+}
+
+// Start starts the workers that deliver events, queues deliveries that were pending when the
+// application last stopped, and starts polling for pending deliveries
+func (d *Dispatcher) Start() {
+	workers := d.config.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	for i := 0; i < workers; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+
+	d.enqueuePending()
+
+	d.wg.Add(1)
+	go d.poll()
+}
+
+// Stop waits for triggered events to be logged, then stops delivering events and waits for deliveries
+// in progress to finish. Queued deliveries remain pending and are delivered when the dispatcher is
+// next started
+func (d *Dispatcher) Stop() {
+	d.triggers.Wait()
+	d.stopOnce.Do(func() {
+		close(d.done)
+	})
+	d.wg.Wait()
+}
+
+// DeliverQueued makes an attempt to deliver every queued delivery and returns when the queue is empty.
+// It is used by short lived processes which do not start the dispatcher. Deliveries that fail remain
+// pending and are retried when a dispatcher is next started
+func (d *Dispatcher) DeliverQueued() {
+	d.triggers.Wait()
+
+	for {
+		select {
+		case id := <-d.queue:
+			d.deliver(id)
+		default:
+			return
+		}
+	}
+}
+
+// Trigger sends an event with given data to every active subscription that receives it. The deliveries
+// are logged in the background, so the caller is not held up by the database
+func (d *Dispatcher) Trigger(event string, data interface{}) {
+	// The data is encoded now, as the caller may change it once this returns
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		log.Error().Err(err).Str("event", event).Msg("Unable to encode webhook event.")
+		return
+	}
+
+	d.triggers.Add(1)
+	go func() {
+		defer d.triggers.Done()
+		d.createDeliveries(event, json.RawMessage(encoded))
+	}()
+}
+
+// createDeliveries logs and queues a delivery of an event to every active subscription that receives it
+func (d *Dispatcher) createDeliveries(event string, data json.RawMessage) {
+	subscriptions, err := d.subscriptions.LoadAll()
+	if err != nil {
+		log.Error().Err(err).Str("event", event).Msg("Unable to load webhook subscriptions.")
+		return
+	}
+
+	for _, s := range subscriptions {
+		if !s.Subscribes(event) {
+			continue
+		}
+
+		delivery, err := d.newDelivery(s, event, data)
+		if err != nil {
+			log.Error().Err(err).Str("event", event).Str("subscription", s.Name).Msg("Unable to create webhook delivery.")
+			continue
+		}
+
+		d.enqueue(delivery.ID)
+	}
+}
+
+// Redeliver resets a delivery's attempts and queues it to be delivered again
+func (d *Dispatcher) Redeliver(id string) error {
+	delivery, err := d.deliveries.LoadByID(id)
+	if err != nil {
+		return err
+	}
+
+	delivery.Status = models.WebhookDeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttempt = time.Time{}
+
+	err = d.deliveries.UpdateOne(delivery)
+	if err != nil {
+		return err
+	}
+
+	d.enqueue(delivery.ID)
+	return nil
+}
+
+// newDelivery creates and logs a delivery of an event to a subscription
+func (d *Dispatcher) newDelivery(s models.WebhookSubscription, event string, data interface{}) (*models.WebhookDelivery, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	payload, err := json.Marshal(models.WebhookPayload{
+		ID:    id,
+		Event: event,
+		Time:  now,
+		Data:  data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := &models.WebhookDelivery{
+		ID:           id,
+		Subscription: s.Name,
+		Event:        event,
+		URL:          s.URL,
+		Payload:      string(payload),
+		Status:       models.WebhookDeliveryPending,
+		Created:      now,
+	}
+
+	return delivery, d.deliveries.InsertOne(delivery)
+}
+
+// enqueue queues a delivery for a worker, unless it is already queued. If the queue is full the
+// delivery remains pending until it is next polled
+func (d *Dispatcher) enqueue(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.queued[id] {
+		return
+	}
+
+	select {
+	case d.queue <- id:
+		d.queued[id] = true
+	default:
+		log.Warn().Str("delivery", id).Msg("Webhook delivery queue is full.")
+	}
+}
+
+// dequeue records that a delivery is no longer queued or being delivered
+func (d *Dispatcher) dequeue(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.queued, id)
+}
+
+// enqueuePending queues every pending delivery that is due to be attempted
+func (d *Dispatcher) enqueuePending() {
+	pending, err := d.deliveries.LoadPending()
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to load pending webhook deliveries.")
+		return
+	}
+
+	now := time.Now()
+	for _, delivery := range pending {
+		if delivery.NextAttempt.After(now) {
+			continue
+		}
+		d.enqueue(delivery.ID)
+	}
+}
+
+// poll queues pending deliveries at the configured interval until the dispatcher is stopped
+func (d *Dispatcher) poll() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			d.enqueuePending()
+		}
+	}
+}
+
+// work delivers queued deliveries until the dispatcher is stopped
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case id := <-d.queue:
+			d.deliver(id)
+		}
+	}
+}
+
+// deliver makes an attempt to deliver a delivery, logs the outcome and schedules a retry if it failed
+func (d *Dispatcher) deliver(id string) {
+	defer d.dequeue(id)
+
+	delivery, err := d.deliveries.LoadByID(id)
+	if err != nil {
+		log.Error().Err(err).Str("delivery", id).Msg("Unable to load webhook delivery.")
+		return
+	}
+
+	if delivery.Status != models.WebhookDeliveryPending {
+		return
+	}
+
+	delivery.Attempts++
+	delivery.LastAttempt = time.Now()
+	delivery.ResponseCode = 0
+	delivery.Response = ""
+	delivery.Error = ""
+
+	err = d.send(delivery)
+
+	switch {
+	case err == nil:
+		delivery.Status = models.WebhookDeliveryDelivered
+	case delivery.Attempts >= d.config.MaxAttempts:
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.Error = err.Error()
+	default:
+		delivery.Error = err.Error()
+		delivery.NextAttempt = delivery.LastAttempt.Add(d.retryDelay(delivery.Attempts))
+	}
+
+	log.Info().
+		Str("delivery", delivery.ID).
+		Str("subscription", delivery.Subscription).
+		Str("event", delivery.Event).
+		Int("attempt", delivery.Attempts).
+		Str("status", delivery.Status).
+		Str("error", delivery.Error).
+		Msg("Attempted webhook delivery.")
+
+	err = d.deliveries.UpdateOne(delivery)
+	if err != nil {
+		log.Error().Err(err).Str("delivery", id).Msg("Unable to update webhook delivery.")
+		return
+	}
+
+	if delivery.Status == models.WebhookDeliveryPending {
+		d.retry(delivery)
+	}
+}
+
+// retryDelay returns the delay before retrying a delivery after a given number of attempts, which
+// doubles with each attempt
+func (d *Dispatcher) retryDelay(attempts int) time.Duration {
+	return d.config.Backoff << uint(attempts-1)
+}
+
+// retry queues a failed delivery again once it is due to be attempted
+func (d *Dispatcher) retry(delivery *models.WebhookDelivery) {
+	time.AfterFunc(time.Until(delivery.NextAttempt), func() {
+		select {
+		case <-d.done:
+		default:
+			d.enqueue(delivery.ID)
+		}
+	})
+}
+
+// send posts a delivery's payload to its URL, signed with the subscription's current secret
+func (d *Dispatcher) send(delivery *models.WebhookDelivery) error {
+	s, err := d.subscriptions.LoadByName(delivery.Subscription)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return errors.New("The subscription no longer exists")
+		}
+		return fmt.Errorf("Unable to load subscription: %s", err.Error())
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(s.Secret, timestamp, []byte(delivery.Payload)))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseLength))
+	delivery.ResponseCode = resp.StatusCode
+	delivery.Response = string(body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Unexpected response status: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Sign returns the signature of a payload sent at a given timestamp, for the signature header
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret generates a random secret for signing payloads
+func NewSecret() (string, error) {
+	return randomHex(32)
+}
+
+// newID generates a random delivery ID
+func newID() (string, error) {
+	return randomHex(16)
+}
+
+// randomHex returns a given number of random bytes, hex encoded
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,364 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikestefanello/otcscanner/config"
+	"github.com/mikestefanello/otcscanner/models"
+	"github.com/mikestefanello/otcscanner/repository"
+	"github.com/rs/zerolog"
+)
+
+func TestMain(m *testing.M) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+// fakeSubscriptions is a webhook subscription repository which stores subscriptions in memory
+type fakeSubscriptions struct {
+	repository.WebhookRepository
+	subscriptions []models.WebhookSubscription
+}
+
+func (f *fakeSubscriptions) LoadAll() ([]models.WebhookSubscription, error) {
+	return f.subscriptions, nil
+}
+
+func (f *fakeSubscriptions) LoadByName(name string) (*models.WebhookSubscription, error) {
+	for _, s := range f.subscriptions {
+		if s.Name == name {
+			return &s, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+// fakeDeliveries is a webhook delivery repository which stores deliveries in memory. It is used by
+// the dispatcher's workers and the test at the same time, so it is guarded by a mutex
+type fakeDeliveries struct {
+	mu         sync.Mutex
+	deliveries []models.WebhookDelivery
+}
+
+func (f *fakeDeliveries) InsertOne(delivery *models.WebhookDelivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.deliveries = append(f.deliveries, *delivery)
+	return nil
+}
+
+func (f *fakeDeliveries) UpdateOne(delivery *models.WebhookDelivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range f.deliveries {
+		if f.deliveries[i].ID == delivery.ID {
+			f.deliveries[i] = *delivery
+			return nil
+		}
+	}
+	return repository.ErrNotFound
+}
+
+func (f *fakeDeliveries) LoadByID(id string) (*models.WebhookDelivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, delivery := range f.deliveries {
+		if delivery.ID == id {
+			return &delivery, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (f *fakeDeliveries) LoadRecent(status string, limit int) ([]models.WebhookDelivery, error) {
+	return f.all(), nil
+}
+
+func (f *fakeDeliveries) LoadPending() ([]models.WebhookDelivery, error) {
+	pending := []models.WebhookDelivery{}
+	for _, delivery := range f.all() {
+		if delivery.Status == models.WebhookDeliveryPending {
+			pending = append(pending, delivery)
+		}
+	}
+	return pending, nil
+}
+
+func (f *fakeDeliveries) all() []models.WebhookDelivery {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]models.WebhookDelivery(nil), f.deliveries...)
+}
+
+// receiver is a webhook endpoint which responds with a given sequence of statuses, repeating the last
+// one, and records the requests it receives
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedRequest
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	status := rc.statuses[0]
+	if len(rc.statuses) > 1 {
+		rc.statuses = rc.statuses[1:]
+	}
+	rc.requests = append(rc.requests, receivedRequest{header: r.Header.Clone(), body: body})
+
+	w.WriteHeader(status)
+	w.Write([]byte("ok"))
+}
+
+func (rc *receiver) received() []receivedRequest {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return append([]receivedRequest(nil), rc.requests...)
+}
+
+// waitFor waits for a condition to be met, failing the test if it is not met within a few seconds
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for webhook deliveries")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		secret    string
+		timestamp string
+		payload   string
+		want      string
+	}{
+		{"secret", "1614870367", `{"id":"1"}`, "sha256=7da42cf948bb21bbc317204f5d1ee7d5b6acda47ff0795c8b6e94f0327870537"},
+		{"", "0", "", "sha256=b849d5a581847b281957065739df36df2463d1977ea8d6e1e4e6cf33fadc68c3"},
+		{"s3cr3t", "1700000000", "héllo", "sha256=9399e56579951139a59ceca3d0e52d35d75a7ad64d6a7bd27dcce8198936e175"},
+	}
+
+	for _, tc := range tests {
+		if got := Sign(tc.secret, tc.timestamp, []byte(tc.payload)); got != tc.want {
+			t.Errorf("Sign(%q, %q, %q) = %s, expected %s", tc.secret, tc.timestamp, tc.payload, got, tc.want)
+		}
+	}
+}
+
+func TestDeliverQueued(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantStatus   string
+		wantAttempts int
+		wantError    string
+	}{
+		{"delivered", http.StatusOK, models.WebhookDeliveryDelivered, 1, ""},
+		{"retried", http.StatusBadGateway, models.WebhookDeliveryPending, 1, "Unexpected response status: 502 Bad Gateway"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rc := &receiver{statuses: []int{tc.status}}
+			server := httptest.NewServer(rc)
+			defer server.Close()
+
+			subscriptions := &fakeSubscriptions{subscriptions: []models.WebhookSubscription{
+				{Name: "erp", URL: server.URL, Events: []string{models.WebhookEventOrdersDeleted}, Secret: "erp-secret", Active: true},
+				{Name: "inactive", URL: server.URL, Events: []string{models.WebhookEventOrdersDeleted}, Secret: "secret"},
+				{Name: "scans", URL: server.URL, Events: []string{models.WebhookEventScanCompleted}, Secret: "secret", Active: true},
+			}}
+			deliveries := &fakeDeliveries{}
+			d := New(config.WebhookConfig{MaxAttempts: 3, Backoff: time.Hour, Timeout: 5 * time.Second}, subscriptions, deliveries)
+
+			event := DeleteEvent{Operation: "all", Count: 3, Reason: "end of season", Actor: "sam"}
+			d.Trigger(models.WebhookEventOrdersDeleted, event)
+
+			// Changing the data once triggered does not change what is sent
+			event.Count = 4
+
+			d.DeliverQueued()
+			d.Stop()
+
+			requests := rc.received()
+			if len(requests) != 1 {
+				t.Fatalf("expected one request, got %d", len(requests))
+			}
+			req := requests[0]
+
+			timestamp := req.header.Get(HeaderTimestamp)
+			if want := Sign("erp-secret", timestamp, req.body); req.header.Get(HeaderSignature) != want {
+				t.Errorf("expected signature %s, got %s", want, req.header.Get(HeaderSignature))
+			}
+			if req.header.Get(HeaderEvent) != models.WebhookEventOrdersDeleted {
+				t.Errorf("unexpected event header %s", req.header.Get(HeaderEvent))
+			}
+
+			var payload struct {
+				ID    string      `json:"id"`
+				Event string      `json:"event"`
+				Data  DeleteEvent `json:"data"`
+			}
+			if err := json.Unmarshal(req.body, &payload); err != nil {
+				t.Fatal(err)
+			}
+			if payload.Data != (DeleteEvent{Operation: "all", Count: 3, Reason: "end of season", Actor: "sam"}) {
+				t.Errorf("unexpected event data %+v", payload.Data)
+			}
+			if payload.ID != req.header.Get(HeaderDelivery) {
+				t.Errorf("expected the payload ID %s to match the delivery header %s", payload.ID, req.header.Get(HeaderDelivery))
+			}
+
+			logged := deliveries.all()
+			if len(logged) != 1 {
+				t.Fatalf("expected one delivery, got %d", len(logged))
+			}
+			delivery := logged[0]
+			if delivery.Subscription != "erp" || delivery.Status != tc.wantStatus || delivery.Attempts != tc.wantAttempts || delivery.Error != tc.wantError {
+				t.Errorf("unexpected delivery %+v", delivery)
+			}
+			if delivery.ResponseCode != tc.status || delivery.Response != "ok" {
+				t.Errorf("expected the response to be logged, got %d %q", delivery.ResponseCode, delivery.Response)
+			}
+
+			wantNext := time.Time{}
+			if tc.wantStatus == models.WebhookDeliveryPending {
+				wantNext = delivery.LastAttempt.Add(time.Hour)
+			}
+			if !delivery.NextAttempt.Equal(wantNext) {
+				t.Errorf("expected the next attempt at %s, got %s", wantNext, delivery.NextAttempt)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		maxAttempts  int
+		wantStatus   string
+		wantAttempts int
+	}{
+		{"delivered after retries", []int{500, 503, 200}, 5, models.WebhookDeliveryDelivered, 3},
+		{"failed after the maximum attempts", []int{500}, 3, models.WebhookDeliveryFailed, 3},
+		{"not retried once delivered", []int{200, 500}, 3, models.WebhookDeliveryDelivered, 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rc := &receiver{statuses: tc.statuses}
+			server := httptest.NewServer(rc)
+			defer server.Close()
+
+			subscriptions := &fakeSubscriptions{subscriptions: []models.WebhookSubscription{
+				{Name: "erp", URL: server.URL, Events: []string{models.WebhookEventOrdersDeleted}, Secret: "erp-secret", Active: true},
+				{Name: "inactive", URL: server.URL, Events: []string{models.WebhookEventOrdersDeleted}, Secret: "secret"},
+				{Name: "scans", URL: server.URL, Events: []string{models.WebhookEventScanCompleted}, Secret: "secret", Active: true},
+			}}
+			deliveries := &fakeDeliveries{}
+			d := New(config.WebhookConfig{Workers: 2, MaxAttempts: tc.maxAttempts, Backoff: 5 * time.Millisecond, PollInterval: time.Hour, Timeout: 5 * time.Second}, subscriptions, deliveries)
+
+			d.Start()
+			d.Trigger(models.WebhookEventOrdersDeleted, DeleteEvent{Operation: "completed", Count: 1, Reason: "archived"})
+
+			waitFor(t, func() bool {
+				logged := deliveries.all()
+				return len(logged) == 1 && logged[0].Status != models.WebhookDeliveryPending
+			})
+			d.Stop()
+
+			delivery := deliveries.all()[0]
+			if delivery.Status != tc.wantStatus || delivery.Attempts != tc.wantAttempts {
+				t.Errorf("expected %s after %d attempts, got %s after %d", tc.wantStatus, tc.wantAttempts, delivery.Status, delivery.Attempts)
+			}
+			if len(rc.received()) != tc.wantAttempts {
+				t.Errorf("expected %d requests, got %d", tc.wantAttempts, len(rc.received()))
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	d := New(config.WebhookConfig{Backoff: 30 * time.Second}, nil, nil)
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+	}
+
+	for _, tc := range tests {
+		if got := d.retryDelay(tc.attempts); got != tc.want {
+			t.Errorf("expected a delay of %s after %d attempts, got %s", tc.want, tc.attempts, got)
+		}
+	}
+}
+
+func TestPollPending(t *testing.T) {
+	rc := &receiver{statuses: []int{http.StatusOK}}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	subscriptions := &fakeSubscriptions{subscriptions: []models.WebhookSubscription{
+		{Name: "erp", URL: server.URL, Events: []string{models.WebhookEventOrdersDeleted}, Secret: "erp-secret", Active: true},
+		{Name: "inactive", URL: server.URL, Events: []string{models.WebhookEventOrdersDeleted}, Secret: "secret"},
+		{Name: "scans", URL: server.URL, Events: []string{models.WebhookEventScanCompleted}, Secret: "secret", Active: true},
+	}}
+	deliveries := &fakeDeliveries{}
+	d := New(config.WebhookConfig{Workers: 1, MaxAttempts: 3, Backoff: time.Hour, PollInterval: 5 * time.Millisecond, Timeout: 5 * time.Second}, subscriptions, deliveries)
+
+	// Deliveries which were logged but never queued are picked up by polling, unless they are not due
+	due := models.WebhookDelivery{ID: "due", Subscription: "erp", Payload: "{}", Status: models.WebhookDeliveryPending}
+	notDue := due
+	notDue.ID, notDue.NextAttempt = "not-due", time.Now().Add(time.Hour)
+	for _, delivery := range []models.WebhookDelivery{due, notDue} {
+		delivery.URL = server.URL
+		deliveries.InsertOne(&delivery)
+	}
+
+	d.Start()
+	waitFor(t, func() bool {
+		delivery, _ := deliveries.LoadByID("due")
+		return delivery.Status == models.WebhookDeliveryDelivered
+	})
+
+	// Allow a few more polls to make sure the delivery which is not due is skipped
+	time.Sleep(25 * time.Millisecond)
+	d.Stop()
+
+	if delivery, _ := deliveries.LoadByID("not-due"); delivery.Status != models.WebhookDeliveryPending || delivery.Attempts != 0 {
+		t.Errorf("expected the delivery which is not due to be skipped, got %+v", delivery)
+	}
+	if len(rc.received()) != 1 {
+		t.Errorf("expected one request, got %d", len(rc.received()))
+	}
+}